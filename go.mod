@@ -1,11 +1,13 @@
 module github.com/GannettDigital/jstransform
 
+go 1.16
+
 require (
 	github.com/GannettDigital/msgp v1.0.3-0.20180910162652-7b6c807760d7
-	github.com/PaesslerAG/gval v0.1.1 // indirect
+	github.com/PaesslerAG/gval v0.1.1
 	github.com/PaesslerAG/jsonpath v0.1.0
 	github.com/antchfx/xmlquery v1.0.0
-	github.com/antchfx/xpath v0.0.0-20190319080838-ce1d48779e67 // indirect
+	github.com/antchfx/xpath v0.0.0-20190319080838-ce1d48779e67
 	github.com/buger/jsonparser v0.0.0-20181115193947-bf1c66bbce23
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/franela/goblin v0.0.0-20181003173013-ead4ad1d2727 // indirect
@@ -19,8 +21,10 @@ require (
 	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f // indirect
 	github.com/xeipuuv/gojsonreference v0.0.0-20180127040603-bd5ef7bd5415 // indirect
 	github.com/xeipuuv/gojsonschema v1.1.0
+	golang.org/x/net v0.0.0-20190213061140-3a22650c66bd
 	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4 // indirect
 	golang.org/x/sys v0.0.0-20190221075227-b4e8571b14e0 // indirect
+	golang.org/x/text v0.3.0
 	golang.org/x/tools v0.0.0-20190221180947-9c8c5aeafa05 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v2 v2.2.2 // indirect
@@ -35,6 +35,7 @@ type Schema struct {
 }
 
 // Validate will check that the given json is validate according the schema.
+// If the JSON is invalid the error returned is a *ValidationError detailing each violation.
 func (s *Schema) Validate(raw json.RawMessage) (bool, error) {
 	return s.validator.Validate(raw)
 }
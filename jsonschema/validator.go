@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 
 	"github.com/xeipuuv/gojsonschema"
 )
@@ -52,6 +53,7 @@ func loadSchema(schemasDir string) (*gojsonschema.Schema, error) {
 }
 
 // Validate will check that the given json is validate according the schema loaded by the Validator.
+// If the JSON is invalid the error returned is a *ValidationError detailing each violation.
 func (v *validator) Validate(raw json.RawMessage) (bool, error) {
 	l := gojsonschema.NewBytesLoader(raw)
 
@@ -63,8 +65,142 @@ func (v *validator) Validate(raw json.RawMessage) (bool, error) {
 		sort.Slice(result.Errors(), func(i, j int) bool {
 			return result.Errors()[i].String() < result.Errors()[j].String()
 		})
-		return false, fmt.Errorf("invalid schema: %v", result.Errors())
+		verr := &ValidationError{}
+		for _, resultErr := range result.Errors() {
+			verr.Violations = append(verr.Violations, newViolation(resultErr))
+		}
+		return false, verr
 	}
 
 	return result.Valid(), nil
 }
+
+// ValidationError is the error returned by Validate when the JSON does not match the schema.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return fmt.Sprintf("invalid schema: [%s]", strings.Join(violations, " "))
+}
+
+// Violation describes a single way in which JSON does not match the schema.
+type Violation struct {
+	// Pointer is the JSON Pointer (RFC 6901) to the invalid value, for a missing property it points to that property.
+	Pointer string
+	// Keyword is the JSON schema keyword which failed validation, ie "required", "type" or "enum".
+	Keyword string
+	// Value is the invalid value, for a missing property this is the object it is missing from.
+	// Numbers within the value are represented as json.Number.
+	Value interface{}
+	// Description is a human readable description of the violation.
+	Description string
+
+	message string
+}
+
+// String returns the violation formatted the same as the underlying validation library.
+func (v Violation) String() string {
+	return v.message
+}
+
+func newViolation(resultErr gojsonschema.ResultError) Violation {
+	var pointer string
+	// the context starts with the root, "(root)", and with a unique delimiter the splits are the unescaped keys
+	const delimiter = "\x00"
+	for _, key := range strings.Split(resultErr.Context().String(delimiter), delimiter)[1:] {
+		pointer += "/" + escapePointer(key)
+	}
+	switch resultErr.(type) {
+	case *gojsonschema.RequiredError, *gojsonschema.AdditionalPropertyNotAllowedError:
+		if property, ok := resultErr.Details()["property"].(string); ok {
+			pointer += "/" + escapePointer(property)
+		}
+	}
+
+	return Violation{
+		Pointer:     pointer,
+		Keyword:     schemaKeyword(resultErr),
+		Value:       resultErr.Value(),
+		Description: resultErr.Description(),
+		message:     resultErr.String(),
+	}
+}
+
+// escapePointer escapes a key for use within a JSON Pointer.
+func escapePointer(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
+
+// schemaKeyword returns the JSON schema keyword which caused the given error. The error types of the validation
+// library don't all match the keywords so they are translated.
+func schemaKeyword(resultErr gojsonschema.ResultError) string {
+	switch resultErr.(type) {
+	case *gojsonschema.RequiredError:
+		return "required"
+	case *gojsonschema.InvalidTypeError:
+		return "type"
+	case *gojsonschema.NumberAnyOfError:
+		return "anyOf"
+	case *gojsonschema.NumberOneOfError:
+		return "oneOf"
+	case *gojsonschema.NumberAllOfError:
+		return "allOf"
+	case *gojsonschema.NumberNotError:
+		return "not"
+	case *gojsonschema.MissingDependencyError:
+		return "dependencies"
+	case *gojsonschema.ConstError:
+		return "const"
+	case *gojsonschema.EnumError:
+		return "enum"
+	case *gojsonschema.ArrayNoAdditionalItemsError:
+		return "additionalItems"
+	case *gojsonschema.ArrayMinItemsError:
+		return "minItems"
+	case *gojsonschema.ArrayMaxItemsError:
+		return "maxItems"
+	case *gojsonschema.ItemsMustBeUniqueError:
+		return "uniqueItems"
+	case *gojsonschema.ArrayContainsError:
+		return "contains"
+	case *gojsonschema.ArrayMinPropertiesError:
+		return "minProperties"
+	case *gojsonschema.ArrayMaxPropertiesError:
+		return "maxProperties"
+	case *gojsonschema.AdditionalPropertyNotAllowedError:
+		return "additionalProperties"
+	case *gojsonschema.InvalidPropertyPatternError:
+		return "patternProperties"
+	case *gojsonschema.InvalidPropertyNameError:
+		return "propertyNames"
+	case *gojsonschema.StringLengthGTEError:
+		return "minLength"
+	case *gojsonschema.StringLengthLTEError:
+		return "maxLength"
+	case *gojsonschema.DoesNotMatchPatternError:
+		return "pattern"
+	case *gojsonschema.DoesNotMatchFormatError:
+		return "format"
+	case *gojsonschema.MultipleOfError:
+		return "multipleOf"
+	case *gojsonschema.NumberGTEError:
+		return "minimum"
+	case *gojsonschema.NumberGTError:
+		return "exclusiveMinimum"
+	case *gojsonschema.NumberLTEError:
+		return "maximum"
+	case *gojsonschema.NumberLTError:
+		return "exclusiveMaximum"
+	case *gojsonschema.ConditionThenError:
+		return "then"
+	case *gojsonschema.ConditionElseError:
+		return "else"
+	}
+	return resultErr.Type()
+}
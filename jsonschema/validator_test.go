@@ -1,8 +1,10 @@
 package jsonschema
 
 import (
+	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"reflect"
 	"testing"
 )
 
@@ -63,3 +65,40 @@ func TestValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestValidationError(t *testing.T) {
+	v, err := SchemaFromFile("test_data/image.json", "")
+	if err != nil {
+		t.Fatalf("failed to load schema: %v", err)
+	}
+
+	_, err = v.Validate([]byte(`{"type": "video", "URL": {"absolute": "absolute", "publish": 1}}`))
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("got error %v, want a *ValidationError", err)
+	}
+
+	want := map[string]Violation{
+		"/URL/publish": {Pointer: "/URL/publish", Keyword: "type", Value: json.Number("1"), Description: "Invalid type. Expected: string, given: integer"},
+		"/caption":     {Pointer: "/caption", Keyword: "required", Description: "caption is required"},
+		"/type":        {Pointer: "/type", Keyword: "enum", Value: "video", Description: `type must be one of the following: "image"`},
+	}
+	for _, violation := range verr.Violations {
+		wantViolation, ok := want[violation.Pointer]
+		if !ok {
+			continue
+		}
+		violation.message = ""
+		if violation.Keyword == "required" {
+			// the value is the whole object the property is missing from
+			violation.Value = nil
+		}
+		if !reflect.DeepEqual(violation, wantViolation) {
+			t.Errorf("got violation %#v, want %#v", violation, wantViolation)
+		}
+		delete(want, violation.Pointer)
+	}
+	for pointer := range want {
+		t.Errorf("missing violation for %q", pointer)
+	}
+}
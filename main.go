@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/GannettDigital/jstransform/generate"
+	"github.com/GannettDigital/jstransform/jsonschema"
+	"github.com/GannettDigital/jstransform/transform"
 )
 
 // mapFlags allows for "-opt key=value" flags.
@@ -36,6 +40,10 @@ func (mf *mapFlags) Set(value string) error {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "transform" {
+		os.Exit(transformCommand(os.Args[2:]))
+	}
+
 	renameStructs := mapFlags{kv: make(map[string]string)}
 	renameFields := mapFlags{kv: make(map[string]string)}
 	var useMessagePack bool
@@ -50,6 +58,7 @@ func main() {
 
 	if len(args) < 1 {
 		fmt.Printf("Usage: %s [-msgp] [-rename k=v] [-renameFields k=v] <JSON Schema Path> [output directory]\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s transform -schema <JSON Schema Path> -id <transform identifier> [input file]...\n", path.Base(os.Args[0]))
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -79,3 +88,99 @@ func main() {
 		os.Exit(4)
 	}
 }
+
+// transformCommand runs the transform subcommand, transforming newline delimited JSON or JSON array input from the
+// files given or stdin and writing newline delimited JSON to stdout. It returns the exit code.
+func transformCommand(args []string) int {
+	flags := flag.NewFlagSet("transform", flag.ContinueOnError)
+	schemaPath := flags.String("schema", "", "path of the JSON schema with transform sections")
+	transformIdentifier := flags.String("id", "", "transform identifier used to select the transform sections")
+	oneOfType := flags.String("oneOfType", "", "oneOf type to use from the schema")
+	workers := flags.Int("workers", 0, "number of records to transform concurrently, defaults to the number of CPUs")
+	validation := flags.String("validation", "on", "validation of transformed records; on, off or log")
+	strict := flags.Bool("strict", false, "fail records with values which can't be converted to the schema type")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s transform -schema <JSON Schema Path> -id <transform identifier> [input file]...\n", path.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+
+	if *schemaPath == "" || *transformIdentifier == "" {
+		flags.Usage()
+		return 1
+	}
+
+	options := []transform.Option{}
+	switch *validation {
+	case "on":
+	case "off":
+		options = append(options, transform.WithValidation(transform.ValidationOff))
+	case "log":
+		options = append(options, transform.WithValidation(transform.ValidationLogOnly))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown validation mode %q\n", *validation)
+		return 1
+	}
+	if *strict {
+		options = append(options, transform.WithStrictConversion())
+	}
+
+	schema, err := jsonschema.SchemaFromFile(*schemaPath, *oneOfType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Loading schema failed: %v\n", err)
+		return 2
+	}
+	tr, err := transform.NewTransformerWithOptions(schema, *transformIdentifier, options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Creating transformer failed: %v\n", err)
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		return transformInput(tr, "stdin", os.Stdin, *workers)
+	}
+	var exitCode int
+	for _, name := range flags.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Opening input failed: %v\n", err)
+			return 3
+		}
+		code := transformInput(tr, name, f, *workers)
+		f.Close()
+		switch code {
+		case 0:
+		case 5:
+			// failed records don't stop the remaining inputs
+			exitCode = code
+		default:
+			return code
+		}
+	}
+	return exitCode
+}
+
+// transformInput streams a single input through the transformer to stdout, returning the exit code.
+func transformInput(tr *transform.Transformer, name string, r io.Reader, workers int) int {
+	var failed int
+	opts := transform.StreamOptions{
+		Workers: workers,
+		OnError: func(record int, err error) {
+			failed++
+			fmt.Fprintf(os.Stderr, "Record %d of %s failed: %v\n", record, name, err)
+		},
+	}
+	if err := tr.TransformStream(context.Background(), r, os.Stdout, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Transform of %s failed: %v\n", name, err)
+		return 4
+	}
+	if failed > 0 {
+		return 5
+	}
+	return 0
+}
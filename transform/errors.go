@@ -0,0 +1,94 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GannettDigital/jstransform/jsonschema"
+)
+
+// ValidationError is returned by Transform when the transformed result does not validate against the schema.
+// Use errors.As to retrieve it and report on the individual violations.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return fmt.Sprintf("schema validation of the transformed result reports invalid: %s", strings.Join(violations, "; "))
+}
+
+// Violation is a single failure of the transformed result to validate against the schema. Pointer, Keyword, Value and
+// Description describe the failure within the transformed result.
+type Violation struct {
+	jsonschema.Violation
+
+	// SourcePath is the JSONPath or XPath in the input the invalid value was transformed from. When no value was found
+	// it lists the paths which were tried separated by ", ". It is empty if the value did not come from the input,
+	// for example for a schema default.
+	SourcePath string
+}
+
+// String returns a description of the violation including the source path when known.
+func (v Violation) String() string {
+	if v.SourcePath == "" {
+		return fmt.Sprintf("%s: %s", v.Pointer, v.Description)
+	}
+	return fmt.Sprintf("%s (from %s): %s", v.Pointer, v.SourcePath, v.Description)
+}
+
+// LimitError is returned when a transform exceeds one of the Limits configured for the Transformer.
+// Use errors.As to retrieve it.
+type LimitError struct {
+	// Limit is the name of the field of Limits which was exceeded, ie "MaxArrayLength".
+	Limit string
+	// Max is the configured limit and Actual the value which exceeded it.
+	Max, Actual int
+	// Path is the location in the output being transformed when the limit was exceeded, if known.
+	Path string
+}
+
+// Error implements the error interface.
+func (e *LimitError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("transform limit %s of %d exceeded: %d", e.Limit, e.Max, e.Actual)
+	}
+	return fmt.Sprintf("transform limit %s of %d exceeded at %s: %d", e.Limit, e.Max, e.Path, e.Actual)
+}
+
+// FieldError is the failure to transform a single field of the output, ie an operation failing on a malformed value.
+// With Transformer.TransformPartial the failure of each field is returned as a FieldError rather than stopping the
+// transform, otherwise the error from the transform wraps the FieldError of the first failure.
+type FieldError struct {
+	// SchemaPath is the JSONPath of the field in the output, with the index of each enclosing array.
+	SchemaPath string
+	// SourcePath is the JSONPath or XPath in the input the value was read from, if known.
+	SourcePath string
+	// Operation is the type of the operation which failed, it is empty if the failure was not from an operation.
+	Operation string
+	Err       error
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	msg := "failed transform"
+	if e.Operation != "" {
+		msg = fmt.Sprintf("failed operation %q", e.Operation)
+	}
+	if e.SourcePath != "" {
+		msg += fmt.Sprintf(" on value from %q", e.SourcePath)
+	}
+	if e.SchemaPath != "" {
+		msg += " for " + e.SchemaPath
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
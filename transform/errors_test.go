@@ -0,0 +1,60 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestValidationError(t *testing.T) {
+	tr, err := NewTransformer(imageSchema, "cumulo")
+	if err != nil {
+		t.Fatalf("failed to initialize transformer: %v", err)
+	}
+
+	_, err = tr.Transform(json.RawMessage(`
+		{
+			"type": "video",
+			"crops": [
+				{
+					"height": 0,
+					"path": "path",
+					"relativePath": "",
+					"width": "wide"
+				}
+			],
+			"publishUrl": "publishURL"
+		}`))
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got error %v, want a *ValidationError", err)
+	}
+
+	want := map[string]struct {
+		keyword    string
+		sourcePath string
+	}{
+		"/type":          {keyword: "enum", sourcePath: "$.type"},
+		"/URL/absolute":  {keyword: "required", sourcePath: "$.absoluteUrl"},
+		"/crops/0/width": {keyword: "required", sourcePath: "$.crops[0].width"},
+	}
+
+	for _, v := range verr.Violations {
+		wantViolation, ok := want[v.Pointer]
+		if !ok {
+			t.Errorf("unexpected violation %s", v)
+			continue
+		}
+		if v.Keyword != wantViolation.keyword {
+			t.Errorf("Violation %q - got keyword %q, want %q", v.Pointer, v.Keyword, wantViolation.keyword)
+		}
+		if v.SourcePath != wantViolation.sourcePath {
+			t.Errorf("Violation %q - got source path %q, want %q", v.Pointer, v.SourcePath, wantViolation.sourcePath)
+		}
+		delete(want, v.Pointer)
+	}
+	for pointer := range want {
+		t.Errorf("missing violation for %q", pointer)
+	}
+}
@@ -1,39 +1,135 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 
-	"github.com/PaesslerAG/jsonpath"
 	"github.com/antchfx/xmlquery"
 	"github.com/buger/jsonparser"
 )
 
-// pathModifier is used to modify the JSON path of an instance to indicate
-type pathModifier func(string) string
-
-func pathReplace(old, new string, modifier pathModifier) pathModifier {
-	return func(path string) string {
-		if modifier != nil {
-			path = modifier(path)
-		}
-		path = strings.Replace(path, old, new, 1)
-		return path
-	}
-}
-
 // instanceTransformer represents a JSON schema instance with transform details in it.
 // The primary function it performs is to transform (or not) data given as input.
 // In some cases instances contain other instances, in such a case the children transformers are called as needed to
 // build up each value depth first.
+//
+// The tree of instanceTransformers is built by newTransformer and must not be modified after that, transform is called
+// concurrently for all inputs to a Transformer so any per call state must be kept out of the instanceTransformers.
 type instanceTransformer interface {
 	addChild(instanceTransformer) error
 	child() instanceTransformer // Arrays return a child object all others nil
 	path() string
 	selectChild(string) instanceTransformer // This returns nil for everything except objects
-	transform(interface{}, pathModifier) (interface{}, error)
+	// transform is given the index of the current item of each enclosing array, outermost first, these are bound to
+	// the compiled JSONPaths of the instance.
+	transform(interface{}, []int, *transformState) (interface{}, error)
+}
+
+// transformState holds the state for a single transform of an input. The instanceTransformers are shared by all
+// transforms so anything specific to one input is kept here. A nil *transformState is valid and records nothing.
+type transformState struct {
+	// sources maps the JSON Pointer of each value in the output to the input path(s) it was transformed from.
+	sources map[string]string
+	// strict makes any failure to convert a value to the type of its schema field an error.
+	strict bool
+	// ctx is checked between child transforms so a transform can be canceled.
+	ctx    context.Context
+	limits Limits
+	// partial keeps the transform going when a field fails, the failure is added to fieldErrors and the field is
+	// left at its default.
+	partial     bool
+	fieldErrors []*FieldError
+	// xmlParents maps each XML array item to the node its array was found from, the item of the enclosing array or the
+	// input document, for the @parent path anchor.
+	xmlParents map[*xmlquery.Node]*xmlquery.Node
+}
+
+// err returns the context error once the context of the transform is done.
+func (state *transformState) err() error {
+	if state == nil || state.ctx == nil {
+		return nil
+	}
+	select {
+	case <-state.ctx.Done():
+		return state.ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// fieldFailed handles the failure to transform the field at path. In partial results mode the failure is recorded and
+// nil is returned so the caller leaves the field at its default, otherwise the error is returned. Limit and context
+// errors always stop the transform.
+func (state *transformState) fieldFailed(err error, path *compiledPath, indexes []int) error {
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) && fieldErr.SchemaPath == "" {
+		fieldErr.SchemaPath = path.render(indexes)
+	}
+
+	if state == nil || !state.partial || stopsTransform(err) {
+		return err
+	}
+
+	if fieldErr == nil {
+		fieldErr = &FieldError{SchemaPath: path.render(indexes), Err: err}
+	}
+	state.fieldErrors = append(state.fieldErrors, fieldErr)
+	return nil
+}
+
+// stopsTransform reports whether the error must stop the transform regardless of partial results or onError, this is
+// the case for exceeded limits and a done context.
+func stopsTransform(err error) bool {
+	var limitErr *LimitError
+	return errors.As(err, &limitErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// limit returns the limits for the transform.
+func (state *transformState) limit() Limits {
+	if state == nil {
+		return Limits{}
+	}
+	return state.limits
+}
+
+// strictConversion reports whether conversion failures should be returned as errors.
+func (state *transformState) strictConversion() bool {
+	return state != nil && state.strict
+}
+
+// recordXMLParent saves the parent of the XML array item for the @parent path anchor.
+func (state *transformState) recordXMLParent(item, parent *xmlquery.Node) {
+	if state == nil {
+		return
+	}
+	if state.xmlParents == nil {
+		state.xmlParents = make(map[*xmlquery.Node]*xmlquery.Node)
+	}
+	state.xmlParents[item] = parent
+}
+
+// xmlParent returns the parent recorded for the XML array item or nil if there is none.
+func (state *transformState) xmlParent(item *xmlquery.Node) *xmlquery.Node {
+	if state == nil {
+		return nil
+	}
+	return state.xmlParents[item]
+}
+
+// recording reports whether the sources of the output values are being recorded.
+func (state *transformState) recording() bool {
+	return state != nil && state.sources != nil
+}
+
+// recordSource saves the source of the value at the given output path if the state is recording sources.
+func (state *transformState) recordSource(path *compiledPath, indexes []int, source string) {
+	if !state.recording() || source == "" {
+		return
+	}
+	state.sources[pointerFromPath(path.render(indexes))] = source
 }
 
 // arrayTransformer represents a JSON instance type array in the case of a JSON transform or an array of xmlquery.Node in the case of an XML transform.
@@ -42,18 +138,23 @@ type arrayTransformer struct {
 	childTransformer instanceTransformer
 	defaultValue     []interface{}
 	jsonPath         string
-	format           inputFormat
+	compiledPath     *compiledPath
+	format           InputFormat
 	transforms       *transformInstructions
 }
 
-func newArrayTransformer(path, transformIdentifier string, raw json.RawMessage, format inputFormat) (*arrayTransformer, error) {
+func newArrayTransformer(path, transformIdentifier string, raw json.RawMessage, format InputFormat, operations *OperationRegistry) (*arrayTransformer, error) {
 	at := &arrayTransformer{
 		jsonPath: path,
 		format:   format,
 	}
 
 	var err error
-	at.transforms, err = extractTransformInstructions(raw, transformIdentifier, path)
+	at.compiledPath, err = compileJSONPath(path, path)
+	if err != nil {
+		return nil, err
+	}
+	at.transforms, err = extractTransformInstructions(raw, transformIdentifier, path, format, operations)
 	if err != nil {
 		return nil, err
 	}
@@ -78,13 +179,17 @@ func (at *arrayTransformer) addChild(child instanceTransformer) error {
 	return nil
 }
 
-func (at *arrayTransformer) baseValueJSON(in interface{}, path string, modifier pathModifier) ([]interface{}, bool, error) {
+func (at *arrayTransformer) baseValueJSON(in interface{}, indexes []int, state *transformState) ([]interface{}, bool, error) {
 	// 1. Use a transform if it exists
 	if at.transforms != nil {
-		rawValue, err := at.transforms.transform(in, "array", modifier, at.format)
+		rawValue, source, err := at.transforms.transform(in, "array", indexes, at.format, state)
 		if err != nil {
-			return nil, false, err
+			if useDefault, err := at.transforms.failed(err, at.compiledPath, indexes, state); err != nil || !useDefault {
+				return nil, false, err
+			}
+			return at.defaultBase()
 		}
+		state.recordSource(at.compiledPath, indexes, source)
 		if rawValue != nil {
 			newValue, ok := rawValue.([]interface{})
 			if !ok {
@@ -95,8 +200,9 @@ func (at *arrayTransformer) baseValueJSON(in interface{}, path string, modifier
 	}
 
 	// 2. Look for the same jsonPath in the input and use directly if possible.
-	rawValue, err := jsonpath.Get(path, in)
+	rawValue, err := at.compiledPath.get(in, indexes)
 	if err == nil && rawValue != nil {
+		state.recordSource(at.compiledPath, indexes, at.compiledPath.render(indexes))
 		newValue, ok := rawValue.([]interface{})
 		if !ok {
 			newValue = []interface{}{rawValue}
@@ -105,19 +211,20 @@ func (at *arrayTransformer) baseValueJSON(in interface{}, path string, modifier
 	}
 
 	// 3. Fall back to the JSON Schema default value.
-	if at.defaultValue != nil {
-		return at.defaultValue, true, nil
-	}
-	return nil, false, nil
+	return at.defaultBase()
 }
 
-func (at *arrayTransformer) baseValueXML(in interface{}, path string, modifier pathModifier) ([]interface{}, bool, error) {
+func (at *arrayTransformer) baseValueXML(in interface{}, indexes []int, state *transformState) ([]interface{}, bool, error) {
 	// 1. Use a transform if it exists
 	if at.transforms != nil {
-		rawValue, err := at.transforms.transform(in, "array", modifier, at.format)
+		rawValue, source, err := at.transforms.transform(in, "array", indexes, at.format, state)
 		if err != nil {
-			return nil, false, err
+			if useDefault, err := at.transforms.failed(err, at.compiledPath, indexes, state); err != nil || !useDefault {
+				return nil, false, err
+			}
+			return at.defaultBase()
 		}
+		state.recordSource(at.compiledPath, indexes, source)
 
 		//if rawValue is an array of xml nodes we need to append them to newValue for return as []interface{}
 		xmlNodeArray, ok := rawValue.([]*xmlquery.Node)
@@ -139,19 +246,24 @@ func (at *arrayTransformer) baseValueXML(in interface{}, path string, modifier p
 	}
 
 	// 2. Fall back to the JSON Schema default value.
+	return at.defaultBase()
+}
+
+// defaultBase returns a copy of the JSON Schema default value for the array, if any.
+func (at *arrayTransformer) defaultBase() ([]interface{}, bool, error) {
 	if at.defaultValue != nil {
-		return at.defaultValue, true, nil
+		return deepCopy(at.defaultValue).([]interface{}), true, nil
 	}
 	return nil, false, nil
 }
 
 // baseValue routes to the correct arrayTransformer.baseValue format
-func (at *arrayTransformer) baseValue(in interface{}, path string, modifier pathModifier) ([]interface{}, bool, error) {
-	if at.format == jsonInput {
-		return at.baseValueJSON(in, path, modifier)
+func (at *arrayTransformer) baseValue(in interface{}, indexes []int, state *transformState) ([]interface{}, bool, error) {
+	if at.format == JSONInput {
+		return at.baseValueJSON(in, indexes, state)
 	}
-	if at.format == xmlInput {
-		return at.baseValueXML(in, path, modifier)
+	if at.format == XMLInput {
+		return at.baseValueXML(in, indexes, state)
 	}
 	return nil, false, errors.New("unknown transform type in arrayTransformer baseValue")
 }
@@ -162,42 +274,46 @@ func (at *arrayTransformer) selectChild(key string) instanceTransformer { return
 
 // arrayTransformJSON retrieves the value for this object by building the value for the base object and then adding in any
 // transforms for all defined child fields.
-func (at *arrayTransformer) arrayTransformJSON(in interface{}, modifier pathModifier) (interface{}, error) {
-	path := at.jsonPath
-	if modifier != nil {
-		path = modifier(path)
-	}
-	base, changed, err := at.baseValue(in, path, modifier)
+func (at *arrayTransformer) arrayTransformJSON(in interface{}, indexes []int, state *transformState) (interface{}, error) {
+	base, changed, err := at.baseValue(in, indexes, state)
 	if err != nil {
 		return nil, err
 	}
 
 	if changed {
 		// save the array base to in as children will use the value from this for their transforms
-		if path == "$" {
+		if at.jsonPath == "$" {
 			in = base
 		} else {
 			inMap, ok := in.(map[string]interface{})
 			if !ok {
 				return nil, errors.New("input is neither a JSON array nor object")
 			}
-			if err := saveInTree(inMap, path, base); err != nil {
+			if err := saveInTree(inMap, at.compiledPath.render(indexes), base); err != nil {
 				return nil, fmt.Errorf("failed to save array transform to input data: %v", err)
 			}
 		}
 	}
 
+	if err := state.limit().checkArrayLength(len(base), at.compiledPath.render(indexes)); err != nil {
+		return nil, err
+	}
+
 	if at.childTransformer == nil {
 		return base, nil
 	}
 
-	oldPath := path + "[*]"
+	childIndexes := make([]int, len(indexes)+1)
+	copy(childIndexes, indexes)
 	newArray := make([]interface{}, 0, len(base))
 
 	for i := range base {
-		currentPath := path + fmt.Sprintf("[%d]", i)
+		if err := state.err(); err != nil {
+			return nil, err
+		}
+		childIndexes[len(indexes)] = i
 
-		childValue, err := at.childTransformer.transform(in, pathReplace(oldPath, currentPath, modifier))
+		childValue, err := at.childTransformer.transform(in, childIndexes, state)
 		if err != nil {
 			return nil, err
 		}
@@ -214,28 +330,35 @@ func (at *arrayTransformer) arrayTransformJSON(in interface{}, modifier pathModi
 
 // arrayTransformXML retrieves the value for this object by building the value for the base object and then adding in any
 // transforms for all defined child fields.
-func (at *arrayTransformer) arrayTransformXML(in interface{}, modifier pathModifier) (interface{}, error) {
-	path := at.jsonPath
-	if modifier != nil {
-		path = modifier(path)
-	}
-	base, _, err := at.baseValue(in, path, modifier)
+func (at *arrayTransformer) arrayTransformXML(in interface{}, indexes []int, state *transformState) (interface{}, error) {
+	base, _, err := at.baseValue(in, indexes, state)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := state.limit().checkArrayLength(len(base), at.compiledPath.render(indexes)); err != nil {
+		return nil, err
+	}
+
 	if at.childTransformer == nil {
 		return base, nil
 	}
 
-	oldPath := path + "[*]"
+	childIndexes := make([]int, len(indexes)+1)
+	copy(childIndexes, indexes)
 	newArray := make([]interface{}, 0, len(base))
 
 	for i := range base {
-		currentPath := path + fmt.Sprintf("[%d]", i)
+		if err := state.err(); err != nil {
+			return nil, err
+		}
+		childIndexes[len(indexes)] = i
 		childValue := base[i]
-		if _, ok := childValue.(*xmlquery.Node); ok {
-			childValue, err = at.childTransformer.transform(childValue, pathReplace(oldPath, currentPath, modifier))
+		if node, ok := childValue.(*xmlquery.Node); ok {
+			if parent, ok := in.(*xmlquery.Node); ok {
+				state.recordXMLParent(node, parent)
+			}
+			childValue, err = at.childTransformer.transform(childValue, childIndexes, state)
 			if err != nil {
 				return nil, err
 			}
@@ -252,12 +375,12 @@ func (at *arrayTransformer) arrayTransformXML(in interface{}, modifier pathModif
 }
 
 // transform routes to the correct array transform type
-func (at *arrayTransformer) transform(in interface{}, modifier pathModifier) (interface{}, error) {
-	if at.format == jsonInput {
-		return at.arrayTransformJSON(in, modifier)
+func (at *arrayTransformer) transform(in interface{}, indexes []int, state *transformState) (interface{}, error) {
+	if at.format == JSONInput {
+		return at.arrayTransformJSON(in, indexes, state)
 	}
-	if at.format == xmlInput {
-		return at.arrayTransformXML(in, modifier)
+	if at.format == XMLInput {
+		return at.arrayTransformXML(in, indexes, state)
 	}
 	return nil, fmt.Errorf("Unrecognized transform type %s in arraytransformer transform, must be 'JSON' or 'XML' ", at.format)
 }
@@ -267,11 +390,12 @@ type objectTransformer struct {
 	children     map[string]instanceTransformer
 	defaultValue map[string]interface{}
 	jsonPath     string
-	format       inputFormat
+	compiledPath *compiledPath
+	format       InputFormat
 	transforms   *transformInstructions
 }
 
-func newObjectTransformer(path, transformIdentifier string, raw json.RawMessage, format inputFormat) (*objectTransformer, error) {
+func newObjectTransformer(path, transformIdentifier string, raw json.RawMessage, format InputFormat, operations *OperationRegistry) (*objectTransformer, error) {
 	ot := &objectTransformer{
 		children: make(map[string]instanceTransformer),
 		jsonPath: path,
@@ -279,7 +403,11 @@ func newObjectTransformer(path, transformIdentifier string, raw json.RawMessage,
 	}
 
 	var err error
-	ot.transforms, err = extractTransformInstructions(raw, transformIdentifier, path)
+	ot.compiledPath, err = compileJSONPath(path, path)
+	if err != nil {
+		return nil, err
+	}
+	ot.transforms, err = extractTransformInstructions(raw, transformIdentifier, path, format, operations)
 	if err != nil {
 		return nil, err
 	}
@@ -317,24 +445,26 @@ func (ot *objectTransformer) selectChild(key string) instanceTransformer { retur
 
 // transform retrieves the value for this object by building the value for the base object and then adding in any
 // transforms for all defined child fields.
-func (ot *objectTransformer) transform(in interface{}, modifier pathModifier) (interface{}, error) {
-	path := ot.jsonPath
-	if modifier != nil {
-		path = modifier(path)
-	}
+func (ot *objectTransformer) transform(in interface{}, indexes []int, state *transformState) (interface{}, error) {
 	var newValue map[string]interface{}
 
 	// For the object use a transform if it exists or the default or an empty map
 	if ot.transforms != nil {
-		rawValue, err := ot.transforms.transform(in, "object", modifier, ot.format)
-		if err != nil {
-			return nil, err
+		rawValue, source, err := ot.transforms.transform(in, "object", indexes, ot.format, state)
+		if err == nil && rawValue != nil {
+			if _, ok := rawValue.(map[string]interface{}); !ok {
+				err = errors.New("transform returned non-object value")
+			}
 		}
-		if rawValue != nil {
-			var ok bool
-			newValue, ok = rawValue.(map[string]interface{})
-			if !ok {
-				return nil, errors.New("transform returned non-object value")
+		if err != nil {
+			if useDefault, err := ot.transforms.failed(err, ot.compiledPath, indexes, state); err != nil || !useDefault {
+				return nil, err
+			}
+		} else {
+			state.recordSource(ot.compiledPath, indexes, source)
+			if rawValue != nil {
+				// the children are saved into newValue so it must not be the map from the input
+				newValue = deepCopy(rawValue).(map[string]interface{})
 			}
 		}
 	}
@@ -342,13 +472,17 @@ func (ot *objectTransformer) transform(in interface{}, modifier pathModifier) (i
 		if ot.defaultValue == nil {
 			newValue = make(map[string]interface{})
 		} else {
-			newValue = ot.defaultValue
+			// the default is shared by all transforms so the children are saved into a copy
+			newValue = deepCopy(ot.defaultValue).(map[string]interface{})
 		}
 	}
 
 	// Add each child value to the paren
 	for _, child := range ot.children {
-		childValue, err := child.transform(in, modifier)
+		if err := state.err(); err != nil {
+			return nil, err
+		}
+		childValue, err := child.transform(in, indexes, state)
 		if err != nil {
 			return nil, err
 		}
@@ -372,11 +506,12 @@ type scalarTransformer struct {
 	defaultValue interface{}
 	jsonType     string
 	jsonPath     string
-	format       inputFormat
+	compiledPath *compiledPath
+	format       InputFormat
 	transforms   *transformInstructions
 }
 
-func newScalarTransformer(path, transformIdentifier string, raw json.RawMessage, instanceType string, format inputFormat) (*scalarTransformer, error) {
+func newScalarTransformer(path, transformIdentifier string, raw json.RawMessage, instanceType string, format InputFormat, operations *OperationRegistry) (*scalarTransformer, error) {
 	st := &scalarTransformer{
 		jsonType: instanceType,
 		jsonPath: path,
@@ -388,13 +523,18 @@ func newScalarTransformer(path, transformIdentifier string, raw json.RawMessage,
 		if err != nil && err != jsonparser.KeyPathNotFoundError {
 			return nil, fmt.Errorf("failed to extract instance format: %v", err)
 		}
-		if instanceFormat == "date-time" {
-			st.jsonType = "date-time"
+		switch instanceFormat {
+		case "date-time", "date", "time":
+			st.jsonType = instanceFormat
 		}
 	}
 
 	var err error
-	st.transforms, err = extractTransformInstructions(raw, transformIdentifier, path)
+	st.compiledPath, err = compileJSONPath(path, path)
+	if err != nil {
+		return nil, err
+	}
+	st.transforms, err = extractTransformInstructions(raw, transformIdentifier, path, format, operations)
 	if err != nil {
 		return nil, err
 	}
@@ -419,29 +559,48 @@ func (st *scalarTransformer) selectChild(string) instanceTransformer { return ni
 // 2. Look for the same jsonPath in the input and use directly if possible.
 //
 // 3. Fall back to the JSON Schema default value.
-func (st *scalarTransformer) transformScalarJSON(in interface{}, modifier pathModifier) (interface{}, error) {
-	path := st.jsonPath
-	if modifier != nil {
-		path = modifier(path)
-	}
+func (st *scalarTransformer) transformScalarJSON(in interface{}, indexes []int, state *transformState) (interface{}, error) {
 	// 1. Use a transform if it exists
 	if st.transforms != nil {
-		newValue, err := st.transforms.transform(in, st.jsonType, modifier, st.format)
+		newValue, source, err := st.transforms.transform(in, st.jsonType, indexes, st.format, state)
 		if err != nil {
-			return nil, err
+			if useDefault, err := st.transforms.failed(err, st.compiledPath, indexes, state); err != nil || !useDefault {
+				return nil, err
+			}
+			return st.defaultValue, nil
 		}
+		state.recordSource(st.compiledPath, indexes, source)
 		if newValue != nil {
 			return newValue, nil
 		}
 	}
 
 	// 2. Look for the same jsonPath in the input and use directly if possible.
-	rawValue, err := jsonpath.Get(path, in)
+	rawValue, err := st.compiledPath.get(in, indexes)
 	if err == nil {
+		if rawValue != nil {
+			state.recordSource(st.compiledPath, indexes, st.compiledPath.render(indexes))
+		}
 		newValue, err := convert(rawValue, st.jsonType)
+		if err != nil && state.strictConversion() {
+			err = &FieldError{
+				SourcePath: st.compiledPath.render(indexes),
+				Err:        fmt.Errorf("failed to convert value to %s: %v", st.jsonType, err),
+			}
+			if err := state.fieldFailed(err, st.compiledPath, indexes); err != nil {
+				return nil, err
+			}
+			return st.defaultValue, nil
+		}
 		// if there is a conversion error fall through to the default
 		if newValue != nil {
-			return newValue, err
+			if err != nil {
+				if err := state.fieldFailed(err, st.compiledPath, indexes); err != nil {
+					return nil, err
+				}
+				return st.defaultValue, nil
+			}
+			return newValue, nil
 		}
 	}
 
@@ -454,17 +613,17 @@ func (st *scalarTransformer) transformScalarJSON(in interface{}, modifier pathMo
 // 1. Use a Transform if it exists.
 //
 // 2. Fall back to the JSON Schema default value.
-func (st *scalarTransformer) transformScalarXML(in interface{}, modifier pathModifier) (interface{}, error) {
-	path := st.jsonPath
-	if modifier != nil {
-		path = modifier(path)
-	}
+func (st *scalarTransformer) transformScalarXML(in interface{}, indexes []int, state *transformState) (interface{}, error) {
 	// 1. Use a transform if it exists
 	if st.transforms != nil {
-		newValue, err := st.transforms.transform(in, st.jsonType, modifier, st.format)
+		newValue, source, err := st.transforms.transform(in, st.jsonType, indexes, st.format, state)
 		if err != nil {
-			return nil, err
+			if useDefault, err := st.transforms.failed(err, st.compiledPath, indexes, state); err != nil || !useDefault {
+				return nil, err
+			}
+			return st.defaultValue, nil
 		}
+		state.recordSource(st.compiledPath, indexes, source)
 		if newValue != nil {
 			return newValue, nil
 		}
@@ -475,12 +634,12 @@ func (st *scalarTransformer) transformScalarXML(in interface{}, modifier pathMod
 }
 
 // transform routes to the correct scalar transform type
-func (st *scalarTransformer) transform(in interface{}, modifier pathModifier) (interface{}, error) {
-	if st.format == jsonInput {
-		return st.transformScalarJSON(in, modifier)
+func (st *scalarTransformer) transform(in interface{}, indexes []int, state *transformState) (interface{}, error) {
+	if st.format == JSONInput {
+		return st.transformScalarJSON(in, indexes, state)
 	}
-	if st.format == xmlInput {
-		return st.transformScalarXML(in, modifier)
+	if st.format == XMLInput {
+		return st.transformScalarXML(in, indexes, state)
 	}
 	return nil, fmt.Errorf("Unrecognized transform type %s in scalartransformer transform, must be 'JSON' or 'XML' ", st.format)
 }
@@ -67,12 +67,47 @@ var (
 	testBadTimeStr = "2000-10-15"
 )
 
+// compileTestTransformers compiles the paths of instanceTransformers built directly by the tests, as is done for those
+// built by the Transformer.
+func compileTestTransformers(t *testing.T, it instanceTransformer) {
+	var (
+		compiled   **compiledPath
+		transforms *transformInstructions
+	)
+	switch it := it.(type) {
+	case *arrayTransformer:
+		compiled, transforms = &it.compiledPath, it.transforms
+		if it.childTransformer != nil {
+			compileTestTransformers(t, it.childTransformer)
+		}
+	case *objectTransformer:
+		compiled, transforms = &it.compiledPath, it.transforms
+		for _, child := range it.children {
+			compileTestTransformers(t, child)
+		}
+	case *scalarTransformer:
+		compiled, transforms = &it.compiledPath, it.transforms
+	default:
+		return
+	}
+
+	var err error
+	if *compiled, err = compileJSONPath(it.path(), it.path()); err != nil {
+		t.Fatal(err)
+	}
+	if transforms != nil {
+		if err := transforms.compile(it.path(), JSONInput); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestArrayTransform(t *testing.T) {
 	var nilSlice []interface{}
 
 	tests := []struct {
 		description string
-		format      inputFormat
+		format      InputFormat
 		child       instanceTransformer
 		path        string
 		raw         json.RawMessage
@@ -80,14 +115,14 @@ func TestArrayTransform(t *testing.T) {
 	}{
 		{
 			description: "empty",
-			format:      jsonInput,
+			format:      JSONInput,
 			path:        "$.empty",
 			raw:         json.RawMessage(`{"type":"array"}`),
 			want:        nilSlice,
 		},
 		{
 			description: "default with no child",
-			format:      jsonInput,
+			format:      JSONInput,
 			path:        "$.crops",
 			raw:         json.RawMessage(`{"type":"array"}`),
 			want: []interface{}{
@@ -108,7 +143,7 @@ func TestArrayTransform(t *testing.T) {
 		},
 		{
 			description: "transform with no child",
-			format:      jsonInput,
+			format:      JSONInput,
 			path:        "$.crops",
 			raw:         json.RawMessage(`{"type":"object","transform":{"test":{"from":[{"jsonPath":"$.otherCrops[0]"}]}}}`),
 			want: []interface{}{
@@ -129,10 +164,10 @@ func TestArrayTransform(t *testing.T) {
 		},
 		{
 			description: "scalar child",
-			format:      jsonInput,
+			format:      JSONInput,
 			child: &scalarTransformer{
 				defaultValue: "name",
-				format:       jsonInput,
+				format:       JSONInput,
 				jsonType:     "string",
 				jsonPath:     "$.crops[*]",
 				transforms: &transformInstructions{
@@ -146,16 +181,16 @@ func TestArrayTransform(t *testing.T) {
 		},
 		{
 			description: "object child",
-			format:      jsonInput,
+			format:      JSONInput,
 			child: &objectTransformer{
 				jsonPath: "$.crops[*]",
-				format:   jsonInput,
+				format:   JSONInput,
 				children: map[string]instanceTransformer{
 					"name": &scalarTransformer{
 						defaultValue: "name",
 						jsonType:     "string",
 						jsonPath:     "$.crops[*].name",
-						format:       jsonInput,
+						format:       JSONInput,
 						transforms: &transformInstructions{
 							From:   []*transformInstruction{{jsonPath: "$.crops[*].name"}},
 							Method: 0,
@@ -164,7 +199,7 @@ func TestArrayTransform(t *testing.T) {
 					"height": &scalarTransformer{
 						jsonType: "number",
 						jsonPath: "$.crops[*].height",
-						format:   jsonInput,
+						format:   JSONInput,
 						transforms: &transformInstructions{
 							From:   []*transformInstruction{{jsonPath: "$.crops[*].height"}},
 							Method: 0,
@@ -173,7 +208,7 @@ func TestArrayTransform(t *testing.T) {
 					"path": &scalarTransformer{
 						jsonType: "string",
 						jsonPath: "$.crops[*].path",
-						format:   jsonInput,
+						format:   JSONInput,
 						transforms: &transformInstructions{
 							From:   []*transformInstruction{{jsonPath: "$.crops[*].path"}},
 							Method: 0,
@@ -182,7 +217,7 @@ func TestArrayTransform(t *testing.T) {
 					"relativePath": &scalarTransformer{
 						jsonType: "string",
 						jsonPath: "$.crops[*].relativePath",
-						format:   jsonInput,
+						format:   JSONInput,
 						transforms: &transformInstructions{
 							From:   []*transformInstruction{{jsonPath: "$.crops[*].relativePath"}},
 							Method: 0,
@@ -191,7 +226,7 @@ func TestArrayTransform(t *testing.T) {
 					"width": &scalarTransformer{
 						jsonType: "number",
 						jsonPath: "$.crops[*].width",
-						format:   jsonInput,
+						format:   JSONInput,
 						transforms: &transformInstructions{
 							From:   []*transformInstruction{{jsonPath: "$.crops[*].width"}},
 							Method: 0,
@@ -220,10 +255,10 @@ func TestArrayTransform(t *testing.T) {
 		},
 		{
 			description: "nested array",
-			format:      jsonInput,
+			format:      JSONInput,
 			child: &arrayTransformer{
 				jsonPath: "$.otherCrops[*]",
-				format:   jsonInput,
+				format:   JSONInput,
 				childTransformer: &objectTransformer{
 					jsonPath: "$.otherCrops[*][*]",
 					children: map[string]instanceTransformer{
@@ -231,27 +266,27 @@ func TestArrayTransform(t *testing.T) {
 							defaultValue: "name",
 							jsonType:     "string",
 							jsonPath:     "$.otherCrops[*][*].name",
-							format:       jsonInput,
+							format:       JSONInput,
 						},
 						"height": &scalarTransformer{
 							jsonType: "number",
 							jsonPath: "$.otherCrops[*][*].height",
-							format:   jsonInput,
+							format:   JSONInput,
 						},
 						"path": &scalarTransformer{
 							jsonType: "string",
 							jsonPath: "$.otherCrops[*][*].path",
-							format:   jsonInput,
+							format:   JSONInput,
 						},
 						"relativePath": &scalarTransformer{
 							jsonType: "string",
 							jsonPath: "$.otherCrops[*][*].relativePath",
-							format:   jsonInput,
+							format:   JSONInput,
 						},
 						"width": &scalarTransformer{
 							jsonType: "number",
 							jsonPath: "$.otherCrops[*][*].width",
-							format:   jsonInput,
+							format:   JSONInput,
 						},
 					},
 				},
@@ -289,18 +324,19 @@ func TestArrayTransform(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		at, err := newArrayTransformer(test.path, "test", test.raw, test.format)
+		at, err := newArrayTransformer(test.path, "test", test.raw, test.format, nil)
 		if err != nil {
 			t.Fatalf("Test %q - failed to initialize array transformer: %v", test.description, err)
 		}
 
 		at.childTransformer = test.child
+		compileTestTransformers(t, at)
 
 		testInCopy := make(map[string]interface{})
 		for k, v := range testIn {
 			testInCopy[k] = v
 		}
-		got, err := at.transform(testInCopy, nil)
+		got, err := at.transform(testInCopy, nil, nil)
 		if err != nil {
 			t.Errorf("Test %q - failed transform: %v", test.description, err)
 		}
@@ -315,7 +351,7 @@ func TestObjectTransform(t *testing.T) {
 	tests := []struct {
 		description string
 		in          interface{}
-		format      inputFormat
+		format      InputFormat
 		children    map[string]instanceTransformer
 		path        string
 		raw         json.RawMessage
@@ -324,7 +360,7 @@ func TestObjectTransform(t *testing.T) {
 		{
 			description: "empty",
 			in:          testIn,
-			format:      jsonInput,
+			format:      JSONInput,
 			path:        "$",
 			raw:         json.RawMessage(`{"type":"object"}`),
 			want:        nil,
@@ -332,13 +368,13 @@ func TestObjectTransform(t *testing.T) {
 		{
 			description: "with scalar children",
 			in:          testIn,
-			format:      jsonInput,
+			format:      JSONInput,
 			children: map[string]instanceTransformer{
 				"name": &scalarTransformer{
 					defaultValue: "name",
 					jsonType:     "string",
 					jsonPath:     "$.firstCrop.name",
-					format:       jsonInput,
+					format:       JSONInput,
 					transforms: &transformInstructions{
 						From:   []*transformInstruction{{jsonPath: "$.crops[0].name"}},
 						Method: 0,
@@ -347,7 +383,7 @@ func TestObjectTransform(t *testing.T) {
 				"height": &scalarTransformer{
 					jsonType: "number",
 					jsonPath: "$.firstCrop.height",
-					format:   jsonInput,
+					format:   JSONInput,
 					transforms: &transformInstructions{
 						From:   []*transformInstruction{{jsonPath: "$.crops[0].height"}},
 						Method: 0,
@@ -356,7 +392,7 @@ func TestObjectTransform(t *testing.T) {
 				"path": &scalarTransformer{
 					jsonType: "string",
 					jsonPath: "$.firstCrop.path",
-					format:   jsonInput,
+					format:   JSONInput,
 					transforms: &transformInstructions{
 						From:   []*transformInstruction{{jsonPath: "$.crops[0].path"}},
 						Method: 0,
@@ -365,7 +401,7 @@ func TestObjectTransform(t *testing.T) {
 				"relativePath": &scalarTransformer{
 					jsonType: "string",
 					jsonPath: "$.firstCrop.relativePath",
-					format:   jsonInput,
+					format:   JSONInput,
 					transforms: &transformInstructions{
 						From:   []*transformInstruction{{jsonPath: "$.crops[0].relativePath"}},
 						Method: 0,
@@ -374,7 +410,7 @@ func TestObjectTransform(t *testing.T) {
 				"width": &scalarTransformer{
 					jsonType: "number",
 					jsonPath: "$.firstCrop.width",
-					format:   jsonInput,
+					format:   JSONInput,
 					transforms: &transformInstructions{
 						From:   []*transformInstruction{{jsonPath: "$.crops[0].width"}},
 						Method: 0,
@@ -394,13 +430,13 @@ func TestObjectTransform(t *testing.T) {
 		{
 			description: "with nil value after transform",
 			in:          testIn,
-			format:      jsonInput,
+			format:      JSONInput,
 			children: map[string]instanceTransformer{
 				"name": &scalarTransformer{
 					defaultValue: "name",
 					jsonType:     "string",
 					jsonPath:     "$.firstCrop.name",
-					format:       jsonInput,
+					format:       JSONInput,
 					transforms: &transformInstructions{
 						From:   []*transformInstruction{{jsonPath: "$.crops[0].name"}},
 						Method: 0,
@@ -416,14 +452,15 @@ func TestObjectTransform(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		ot, err := newObjectTransformer(test.path, "test", test.raw, test.format)
+		ot, err := newObjectTransformer(test.path, "test", test.raw, test.format, nil)
 		if err != nil {
 			t.Fatalf("Test %q - failed to initialize object transformer: %v", test.description, err)
 		}
 
 		ot.children = test.children
+		compileTestTransformers(t, ot)
 
-		got, err := ot.transform(test.in, nil)
+		got, err := ot.transform(test.in, nil, nil)
 		if err != nil {
 			t.Errorf("Test %q - failed transform: %v", test.description, err)
 		}
@@ -445,7 +482,7 @@ func TestScalarTransform(t *testing.T) {
 		in           interface{}
 		path         string
 		instanceType string
-		format       inputFormat
+		format       InputFormat
 		raw          json.RawMessage
 		want         interface{}
 		wantError    string
@@ -455,7 +492,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.type",
 			instanceType: "string",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{"type":"string","enum":["image"]}`),
 			want:         "image",
 		},
@@ -464,7 +501,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.crops[0].height",
 			instanceType: "number",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "number" }`),
 			want:         0,
 		},
@@ -473,7 +510,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.date",
 			instanceType: "string",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "string", "format": "date-time" }`),
 			want:         testTime,
 		},
@@ -482,7 +519,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.published",
 			instanceType: "boolean",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "boolean"}`),
 			want:         true,
 		},
@@ -491,7 +528,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.type2",
 			instanceType: "string",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{"type":"string","enum":["image"],"default":"type2"}`),
 			want:         "type2",
 		},
@@ -500,7 +537,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.crops[0].multiplier",
 			instanceType: "number",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "number", "default": 10 }`),
 			want:         float64(10),
 		},
@@ -509,7 +546,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.date2",
 			instanceType: "string",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(fmt.Sprintf(`{ "type": "string", "format": "date-time", "default": "%s" }`, testTimeStr)),
 			want:         testTimeStr,
 		},
@@ -518,7 +555,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.deleted",
 			instanceType: "boolean",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "boolean", "default":true}`),
 			want:         true,
 		},
@@ -527,7 +564,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.type",
 			instanceType: "string",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{"type":"string","enum":["image"],"transform":{"test":{"from":[{"jsonPath":"$.publishUrl"}]}}}`),
 			want:         "publishURL",
 		},
@@ -536,7 +573,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.crops[0].height",
 			instanceType: "number",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "number" ,"transform":{"test":{"from":[{"jsonPath":"$.crops[0].width"}]}}}`),
 			want:         1,
 		},
@@ -545,7 +582,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.anotherDate",
 			instanceType: "string",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "string", "format": "date-time" ,"transform":{"test":{"from":[{"jsonPath":"$.date"}]}}}`),
 			want:         testTime,
 		},
@@ -554,7 +591,7 @@ func TestScalarTransform(t *testing.T) {
 			in:           testIn,
 			path:         "$.WantToPublish",
 			instanceType: "boolean",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "boolean","transform":{"test":{"from":[{"jsonPath":"$.published"}]}}}`),
 			want:         true,
 		},
@@ -563,19 +600,136 @@ func TestScalarTransform(t *testing.T) {
 			in:           testInBadTime,
 			path:         "$.date",
 			instanceType: "string",
-			format:       jsonInput,
+			format:       JSONInput,
 			raw:          json.RawMessage(`{ "type": "string", "format": "date-time"}`),
 			wantError:    "parsing time \"2000-10-15\" as \"2006-01-02T15:04:05Z07:00\": cannot parse \"\" as \"T\"",
 		},
+		{
+			description:  "date transform",
+			in:           testIn,
+			path:         "$.day",
+			instanceType: "string",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "string", "format": "date", "transform": {"test": {"from": [{"jsonPath": "$.date"}]}}}`),
+			want:         "2018-01-01",
+		},
+		{
+			description:  "time transform from a dateTime operation",
+			in:           testIn,
+			path:         "$.at",
+			instanceType: "string",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "string", "format": "time", "transform": {"test": {"from": [{"jsonPath": "$.date", "operations": [{"type": "dateTime"}]}]}}}`),
+			want:         "01:01:00Z",
+		},
+		{
+			description:  "dateTime operation is given the unconverted input",
+			in:           testIn,
+			path:         "$.anotherDate",
+			instanceType: "string",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "string", "format": "date-time", "transform": {"test": {"from": [{"jsonPath": "$.crops[0].width", "operations": [{"type": "dateTime", "args": {"epochUnit": "ms"}}]}]}}}`),
+			want:         time.Unix(0, int64(time.Millisecond)).UTC(),
+		},
+		{
+			description:  "numeric operations return the integer field type",
+			in:           testIn,
+			path:         "$.seconds",
+			instanceType: "integer",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "integer", "transform": {"test": {"from": [{"jsonPath": "$.crops[0].width", "operations": [{"type": "multiply", "args": {"by": "90"}}, {"type": "divide", "args": {"by": "60"}}, {"type": "ceil"}]}]}}}`),
+			want:         2,
+		},
+		{
+			description:  "numeric operations round a fraction for an integer field",
+			in:           testIn,
+			path:         "$.seconds",
+			instanceType: "integer",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "integer", "transform": {"test": {"from": [{"jsonPath": "$.crops[0].width", "operations": [{"type": "multiply", "args": {"by": "1.5"}}]}]}}}`),
+			want:         2,
+		},
+		{
+			description:  "numeric operations before the last are not rounded for an integer field",
+			in:           testIn,
+			path:         "$.seconds",
+			instanceType: "integer",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "integer", "transform": {"test": {"from": [{"jsonPath": "$.crops[0].width", "operations": [{"type": "multiply", "args": {"by": "90"}}, {"type": "divide", "args": {"by": "60"}}, {"type": "floor"}]}]}}}`),
+			want:         1,
+		},
+		{
+			description:  "array operations are given the unconverted array",
+			in:           testIn,
+			path:         "$.paths",
+			instanceType: "string",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "string", "transform": {"test": {"from": [{"jsonPath": "$.crops[*].path", "operations": [{"type": "sort"}, {"type": "join", "args": {"delimiter": ","}}]}]}}}`),
+			want:         "empty,path",
+		},
+		{
+			description:  "extract without a match tries the next instruction",
+			in:           testIn,
+			path:         "$.id",
+			instanceType: "string",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "string", "transform": {"test": {"from": [{"jsonPath": "$.type", "operations": [{"type": "extract", "args": {"regex": "^video-(\\d+)$"}}, {"type": "changeCase", "args": {"to": "upper"}}]}, {"jsonPath": "$.crops[0].path", "operations": [{"type": "extract", "args": {"regex": "p(?P<rest>.*)", "group": "rest"}}]}]}}}`),
+			want:         "ath",
+		},
+		{
+			description:  "expr with operations",
+			in:           testIn,
+			path:         "$.id",
+			instanceType: "string",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "string", "transform": {"test": {"from": [{"expr": "$.type + \"-\" + string($.crops[1].width + 2)", "operations": [{"type": "changeCase", "args": {"to": "upper"}}]}]}}}`),
+			want:         "IMAGE-2",
+		},
+		{
+			description:  "expr which can't be evaluated tries the next instruction",
+			in:           testIn,
+			path:         "$.length",
+			instanceType: "number",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "number", "transform": {"test": {"from": [{"expr": "$.missing * 2"}, {"expr": "$.crops[0].width / $.crops[1].width"}, {"expr": "$.crops[0].width * 10"}]}}}`),
+			want:         10.0,
+		},
+		{
+			description:  "failed operation, onError skip",
+			in:           testIn,
+			path:         "$.length",
+			instanceType: "number",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "number", "transform": {"test": {"from": [{"jsonPath": "$.publishUrl", "operations": [{"type": "duration"}]}, {"jsonPath": "$.crops[0].width"}], "onError": "skip"}}}`),
+			want:         1,
+		},
+		{
+			description:  "failed operation, onError default",
+			in:           testIn,
+			path:         "$.length",
+			instanceType: "number",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "number", "default": 5, "transform": {"test": {"from": [{"jsonPath": "$.publishUrl", "operations": [{"type": "duration"}]}, {"jsonPath": "$.crops[0].width"}], "onError": "default"}}}`),
+			want:         5.0,
+		},
+		{
+			description:  "failed operation, onError null",
+			in:           testIn,
+			path:         "$.length",
+			instanceType: "number",
+			format:       JSONInput,
+			raw:          json.RawMessage(`{"type": "number", "default": 5, "transform": {"test": {"from": [{"jsonPath": "$.publishUrl", "operations": [{"type": "duration"}]}], "onError": "null"}}}`),
+			want:         nil,
+		},
 	}
 
 	for _, test := range tests {
-		st, err := newScalarTransformer(test.path, "test", test.raw, test.instanceType, test.format)
+		st, err := newScalarTransformer(test.path, "test", test.raw, test.instanceType, test.format, nil)
 		if err != nil {
 			t.Fatalf("Test %q - failed to initialize scalar transformer: %v", test.description, err)
 		}
 
-		got, err := st.transform(test.in, nil)
+		got, err := st.transform(test.in, nil, nil)
 
 		if err != nil {
 			if err.Error() == test.wantError {
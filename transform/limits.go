@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"regexp"
+	"regexp/syntax"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// Limits are safeguards against pathological input, a zero value for any limit means it is not enforced.
+// Exceeding a limit causes the transform to fail with a *LimitError.
+type Limits struct {
+	// MaxInputBytes is the largest raw input accepted.
+	MaxInputBytes int
+	// MaxDepth is the deepest nesting of objects and arrays, or XML elements, accepted in the input.
+	MaxDepth int
+	// MaxArrayLength is the most items an array instance will transform.
+	MaxArrayLength int
+	// MaxRegexWork caps the work of a single regular expression operation, such as replace. The work is estimated as
+	// the length of the input string multiplied by the size of the compiled expression which bounds the time taken
+	// by the Go regexp engine.
+	MaxRegexWork int
+}
+
+// checkInputBytes returns a *LimitError if size is over MaxInputBytes.
+func (l Limits) checkInputBytes(size int) error {
+	if l.MaxInputBytes > 0 && size > l.MaxInputBytes {
+		return &LimitError{Limit: "MaxInputBytes", Max: l.MaxInputBytes, Actual: size}
+	}
+	return nil
+}
+
+// checkDepth returns a *LimitError if the decoded input is nested deeper than MaxDepth.
+func (l Limits) checkDepth(in interface{}) error {
+	if l.MaxDepth <= 0 {
+		return nil
+	}
+	var depth int
+	if node, ok := in.(*xmlquery.Node); ok {
+		depth = xmlDepth(node, l.MaxDepth)
+	} else {
+		depth = valueDepth(in, l.MaxDepth)
+	}
+	if depth > l.MaxDepth {
+		return &LimitError{Limit: "MaxDepth", Max: l.MaxDepth, Actual: depth}
+	}
+	return nil
+}
+
+// checkArrayLength returns a *LimitError if length is over MaxArrayLength.
+func (l Limits) checkArrayLength(length int, path string) error {
+	if l.MaxArrayLength > 0 && length > l.MaxArrayLength {
+		return &LimitError{Limit: "MaxArrayLength", Max: l.MaxArrayLength, Actual: length, Path: path}
+	}
+	return nil
+}
+
+// checkRegexWork returns a *LimitError if running a regular expression of the given size over the input would exceed
+// MaxRegexWork.
+func (l Limits) checkRegexWork(size int, in string) error {
+	if l.MaxRegexWork <= 0 {
+		return nil
+	}
+	if work := size * len(in); work > l.MaxRegexWork {
+		return &LimitError{Limit: "MaxRegexWork", Max: l.MaxRegexWork, Actual: work}
+	}
+	return nil
+}
+
+// regexSize returns the number of instructions in the compiled program for the regular expression.
+func regexSize(re *regexp.Regexp) int {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return len(re.String())
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return len(re.String())
+	}
+	return len(prog.Inst)
+}
+
+// valueDepth returns the nesting depth of the decoded JSON value, it stops counting once past max.
+func valueDepth(value interface{}, max int) int {
+	var deepest int
+	switch t := value.(type) {
+	case map[string]interface{}:
+		for _, v := range t {
+			if d := valueDepth(v, max-1); d > deepest {
+				deepest = d
+			}
+			if deepest >= max {
+				break
+			}
+		}
+	case []interface{}:
+		for _, v := range t {
+			if d := valueDepth(v, max-1); d > deepest {
+				deepest = d
+			}
+			if deepest >= max {
+				break
+			}
+		}
+	default:
+		return 0
+	}
+	return deepest + 1
+}
+
+// xmlDepth returns the nesting depth of elements within the XML node, it stops counting once past max.
+func xmlDepth(node *xmlquery.Node, max int) int {
+	var deepest int
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != xmlquery.ElementNode {
+			continue
+		}
+		if d := xmlDepth(child, max-1) + 1; d > deepest {
+			deepest = d
+		}
+		if deepest > max {
+			break
+		}
+	}
+	return deepest
+}
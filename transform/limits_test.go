@@ -0,0 +1,123 @@
+package transform
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+)
+
+func TestLimitsCheckDepth(t *testing.T) {
+	xmlDoc := func(raw string) interface{} {
+		doc, err := xmlquery.Parse(strings.NewReader(raw))
+		if err != nil {
+			t.Fatalf("failed to parse XML: %v", err)
+		}
+		return doc
+	}
+
+	tests := []struct {
+		description string
+		maxDepth    int
+		in          interface{}
+		wantErr     bool
+	}{
+		{
+			description: "Unlimited",
+			in:          map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1}}},
+		},
+		{
+			description: "Scalar",
+			maxDepth:    1,
+			in:          "a",
+		},
+		{
+			description: "JSON at the limit",
+			maxDepth:    3,
+			in:          map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1}}},
+		},
+		{
+			description: "JSON over the limit",
+			maxDepth:    2,
+			in:          map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1}}},
+			wantErr:     true,
+		},
+		{
+			description: "JSON array over the limit",
+			maxDepth:    2,
+			in:          []interface{}{"a", []interface{}{[]interface{}{}}},
+			wantErr:     true,
+		},
+		{
+			description: "XML at the limit",
+			maxDepth:    3,
+			in:          xmlDoc(`<a><b>text<c/></b><d/></a>`),
+		},
+		{
+			description: "XML over the limit",
+			maxDepth:    2,
+			in:          xmlDoc(`<a><b>text<c/></b><d/></a>`),
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		err := Limits{MaxDepth: test.maxDepth}.checkDepth(test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		}
+	}
+}
+
+func TestLimitsCheckRegexWork(t *testing.T) {
+	simple := regexSize(regexp.MustCompile(`a`))
+	repeated := regexSize(regexp.MustCompile(`(a|b|c)*[0-9]{1,5}x`))
+	if repeated <= simple {
+		t.Fatalf("got size %d for a complex regex, want more than the %d of a simple one", repeated, simple)
+	}
+
+	tests := []struct {
+		description string
+		limits      Limits
+		size        int
+		in          string
+		wantErr     bool
+	}{
+		{
+			description: "Unlimited",
+			size:        repeated,
+			in:          strings.Repeat("a", 1000),
+		},
+		{
+			description: "Within the limit",
+			limits:      Limits{MaxRegexWork: 100 * simple},
+			size:        simple,
+			in:          strings.Repeat("a", 100),
+		},
+		{
+			description: "Over the limit",
+			limits:      Limits{MaxRegexWork: 100 * simple},
+			size:        repeated,
+			in:          strings.Repeat("a", 100),
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.limits.checkRegexWork(test.size, test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// loadLookupFiles reads each named lookup table file, a JSON object of input value to output value.
+func loadLookupFiles(files map[string]string) (map[string]map[string]interface{}, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lookups := make(map[string]map[string]interface{}, len(files))
+	for _, name := range names {
+		raw, err := ioutil.ReadFile(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lookup table %q: %v", name, err)
+		}
+		var table map[string]interface{}
+		if err := json.Unmarshal(raw, &table); err != nil || table == nil {
+			return nil, fmt.Errorf("lookup table %q from %s must be a JSON object: %v", name, files[name], err)
+		}
+		lookups[name] = table
+	}
+	return lookups, nil
+}
+
+// withLookups returns a registry based on operations, which may be nil for the operations registered with
+// RegisterOperation, whose map operation can use the lookup tables. If map doesn't resolve to the built-in operation
+// it has been replaced so operations is returned as is.
+func withLookups(operations *OperationRegistry, lookups map[string]map[string]interface{}) *OperationRegistry {
+	if op, err := operations.newOperation("map"); err != nil {
+		return operations
+	} else if _, ok := op.(*mapValue); !ok {
+		return operations
+	}
+
+	registry := NewOperationRegistry()
+	if operations != nil {
+		registry.parent = operations
+	}
+	registry.Register("map", func() Operation { return &mapValue{lookups: lookups} })
+	return registry
+}
@@ -1,29 +1,51 @@
 package transform
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/PaesslerAG/gval"
 	"github.com/PaesslerAG/jsonpath"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
 )
 
 var durationRe = regexp.MustCompile(`^([\d]*?):?([\d]*):([\d]*)$`)
 
-// duration is a transformOperation which changes from a string duration like "MM:SS" to a number of seconds as
+// duration is an Operation which changes from a string duration like "MM:SS" to a number of seconds as
 // an integer.
 type duration struct {
 	re *regexp.Regexp
 }
 
-func (c *duration) init(args map[string]string) error {
+func (c *duration) Init(args map[string]string) error {
 	c.re = durationRe
 	return nil
 }
 
-func (c *duration) transform(raw interface{}) (interface{}, error) {
+func (c *duration) Transform(raw interface{}) (interface{}, error) {
 	if array, ok := raw.([]interface{}); ok && len(array) == 1 {
 		raw = array[0]
 	}
@@ -56,12 +78,12 @@ func (c *duration) transform(raw interface{}) (interface{}, error) {
 	return seconds, nil
 }
 
-// changeCase is a transformOperation which changes the case of strings.
+// changeCase is an Operation which changes the case of strings.
 type changeCase struct {
 	Args map[string]string
 }
 
-func (c *changeCase) init(args map[string]string) error {
+func (c *changeCase) Init(args map[string]string) error {
 	if err := requiredArgs([]string{"to"}, args); err != nil {
 		return err
 	}
@@ -74,7 +96,7 @@ func (c *changeCase) init(args map[string]string) error {
 	return nil
 }
 
-func (c *changeCase) transform(raw interface{}) (interface{}, error) {
+func (c *changeCase) Transform(raw interface{}) (interface{}, error) {
 	in, ok := raw.(string)
 	if !ok {
 		return nil, errors.New("changeCase only supports strings")
@@ -89,16 +111,16 @@ func (c *changeCase) transform(raw interface{}) (interface{}, error) {
 	return nil, errors.New("unknown error in changeCase")
 }
 
-// inverse is a transformOperation which flips the value of a boolean.
+// inverse is an Operation which flips the value of a boolean.
 type inverse struct {
 	args map[string]string
 }
 
-func (i *inverse) init(args map[string]string) error {
+func (i *inverse) Init(args map[string]string) error {
 	return nil
 }
 
-func (i *inverse) transform(raw interface{}) (interface{}, error) {
+func (i *inverse) Transform(raw interface{}) (interface{}, error) {
 	in, ok := raw.(bool)
 	if !ok {
 		return nil, errors.New("inverse only supports booleans")
@@ -106,64 +128,200 @@ func (i *inverse) transform(raw interface{}) (interface{}, error) {
 	return !in, nil
 }
 
-// max is a transformOperation which retrieves a field from the maximum item in an array.
-// The maxiumum item is determined by comparing values in a defined number field on the array items.
-type max struct {
-	Args map[string]string
+// aggregate is an Operation which combines a number from each item of an array, optionally only the items matching
+// a where predicate. Items without a number are ignored and an empty array results in nil.
+//
+// The kind is one of min, max, sum, avg, argmin or argmax. The argmin and argmax kinds return the item with the
+// smallest or largest number, or with the return arg a value from that item. The min and max kinds return the number
+// itself unless the return arg is given.
+type aggregate struct {
+	arrayOperation
+	kind  string
+	Args  map[string]string
+	by    *itemPath
+	ret   *itemPath
+	where *itemPredicate
+	// skipInvalid passes over items without a number rather than failing
+	skipInvalid bool
+}
+
+// aggregateKinds describes the result of each kind of aggregate and whether it selects an item.
+var aggregateKinds = map[string]struct {
+	description string
+	selects     bool
+}{
+	"min":    {"Accepts an array, returns the smallest number or with return a value of the item with the smallest number", true},
+	"max":    {"Accepts an array, returns the largest number or with return a value of the item with the largest number", true},
+	"sum":    {"Accepts an array, returns the sum of the numbers", false},
+	"avg":    {"Accepts an array, returns the average of the numbers", false},
+	"argmin": {"Accepts an array, returns the item with the smallest number or with return a value of that item", true},
+	"argmax": {"Accepts an array, returns the item with the largest number or with return a value of that item", true},
 }
 
-func (m *max) init(args map[string]string) error {
-	if err := requiredArgs([]string{"by", "return"}, args); err != nil {
+func (a *aggregate) Init(args map[string]string) error {
+	kind, ok := aggregateKinds[a.kind]
+	if !ok {
+		return fmt.Errorf("unknown aggregate %q", a.kind)
+	}
+	known := []string{"by", "where", "skipInvalid"}
+	if kind.selects {
+		known = append(known, "return")
+	}
+	if err := knownArgs(known, args); err != nil {
 		return err
 	}
-	m.Args = args
+
+	if _, ok := args["return"]; ok {
+		if _, ok := args["by"]; !ok {
+			return errors.New("the argument 'by' is required with 'return'")
+		}
+	}
+
+	var err error
+	if by, ok := args["by"]; ok {
+		if a.by, err = newItemPath(by); err != nil {
+			return err
+		}
+	}
+	if ret, ok := args["return"]; ok {
+		if a.ret, err = newItemPath(ret); err != nil {
+			return err
+		}
+	}
+	if where, ok := args["where"]; ok {
+		if a.where, err = newItemPredicate(where); err != nil {
+			return err
+		}
+	}
+	if skip, ok := args["skipInvalid"]; ok {
+		if a.skipInvalid, err = strconv.ParseBool(skip); err != nil {
+			return errors.New("the argument 'skipInvalid' must be either 'true' or 'false'")
+		}
+	}
+	a.Args = args
 	return nil
 }
 
-func (m *max) transform(in interface{}) (interface{}, error) {
-	inArray, ok := in.([]interface{})
-	if !ok {
+func (a *aggregate) Transform(in interface{}) (interface{}, error) {
+	return a.transformField(in, "number")
+}
+
+func (a *aggregate) transformField(in interface{}, fieldType string) (interface{}, error) {
+	switch in.(type) {
+	case []interface{}, []*xmlquery.Node:
+	default:
 		return nil, errors.New("input must be an array")
 	}
-	byArg := strings.Replace(m.Args["by"], "@", "$", 1)
-	returnArg := strings.Replace(m.Args["return"], "@", "$", 1)
+	items, _ := arrayItems(in)
+
+	var (
+		found    int
+		sum      float64
+		selected interface{}
+		extreme  float64
+	)
+	for _, item := range items {
+		if a.where != nil {
+			match, err := a.where.match(item)
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+		}
 
-	var largest float64
-	var largestIndex int
-	for i, item := range inArray {
-		byRaw, err := jsonpath.Get(byArg, item)
+		number, err := a.itemNumber(item)
 		if err != nil {
-			return nil, fmt.Errorf("failed extracting 'by' field: %v", err)
+			if a.skipInvalid {
+				continue
+			}
+			return nil, err
 		}
-		by, ok := byRaw.(float64)
-		if !ok {
-			byInt, ok := byRaw.(int)
-			if !ok {
-				return nil, errors.New("by field is not a number")
+
+		found++
+		sum += number
+		smaller := a.kind == "min" || a.kind == "argmin"
+		if found == 1 || (smaller && number < extreme) || (!smaller && number > extreme) {
+			extreme = number
+			selected = item
+		}
+	}
+	if found == 0 {
+		return nil, nil
+	}
+
+	var result float64
+	switch a.kind {
+	case "sum":
+		result = sum
+	case "avg":
+		result = sum / float64(found)
+	default:
+		if a.ret != nil {
+			value, err := a.ret.get(selected)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				return nil, fmt.Errorf("failed extracting 'return' field %q", a.ret.path)
 			}
-			by = float64(byInt)
+			return value, nil
 		}
-		if by > largest {
-			largest = by
-			largestIndex = i
+		if a.kind == "argmin" || a.kind == "argmax" {
+			return selected, nil
 		}
+		result = extreme
 	}
+	return transformNumber(a.kind, result, fieldType, func(f float64) float64 { return f })
+}
 
-	rawReturn, err := jsonpath.Get(returnArg, inArray[largestIndex])
-	if err != nil {
-		return nil, fmt.Errorf("failed extracting 'return' field: %v", err)
+// itemNumber returns the number of an item to aggregate or an error if it has none.
+func (a *aggregate) itemNumber(item interface{}) (float64, error) {
+	value := item
+	if a.by != nil {
+		var err error
+		if value, err = a.by.get(item); err != nil {
+			return 0, err
+		}
+	}
+
+	switch t := value.(type) {
+	case nil:
+		if a.by != nil {
+			return 0, fmt.Errorf("%s by field %q not found", a.kind, a.by.path)
+		}
+		return 0, fmt.Errorf("%s item is null", a.kind)
+	case *xmlquery.Node:
+		value = t.InnerText()
+	}
+	if text, ok := value.(string); ok {
+		if _, isNode := item.(*xmlquery.Node); isNode {
+			// XML values are always text
+			text = strings.TrimSpace(text)
+		}
+		converted, err := convertNumber(text)
+		if err != nil || converted == nil {
+			return 0, fmt.Errorf("%s by value %q is not a number", a.kind, text)
+		}
+		value = converted
 	}
 
-	return rawReturn, nil
+	number, ok := numberValue(value)
+	if !ok {
+		return 0, fmt.Errorf("%s by field is not a number", a.kind)
+	}
+	return number, nil
 }
 
-// replace is a transformOperation which performs a regex based find/replace on a string value.
+// replace is an Operation which performs a regex based find/replace on a string value.
 type replace struct {
-	Args  map[string]string
-	regex *regexp.Regexp
+	Args      map[string]string
+	regex     *regexp.Regexp
+	regexSize int
 }
 
-func (r *replace) init(args map[string]string) error {
+func (r *replace) Init(args map[string]string) error {
 	if err := requiredArgs([]string{"regex", "new"}, args); err != nil {
 		return err
 	}
@@ -173,11 +331,17 @@ func (r *replace) init(args map[string]string) error {
 	}
 
 	r.regex = re
+	r.regexSize = regexSize(re)
 	r.Args = args
 	return nil
 }
 
-func (r *replace) transform(raw interface{}) (interface{}, error) {
+func (r *replace) Transform(raw interface{}) (interface{}, error) {
+	return r.transformLimited(raw, Limits{})
+}
+
+// transformLimited implements the limitedOperation interface enforcing MaxRegexWork.
+func (r *replace) transformLimited(raw interface{}, limits Limits) (interface{}, error) {
 	if r.regex == nil {
 		return nil, errors.New("init was not run")
 	}
@@ -185,16 +349,118 @@ func (r *replace) transform(raw interface{}) (interface{}, error) {
 	if !ok {
 		return nil, errors.New("replace only supports strings")
 	}
+	if err := limits.checkRegexWork(r.regexSize, in); err != nil {
+		return nil, err
+	}
 
 	return r.regex.ReplaceAllString(in, r.Args["new"]), nil
 }
 
-// split is a transformOperation which splits a string based on a given split string.
+// extract is an Operation which returns the text captured by a regex group from a string, or with the all arg the
+// captured text of every match. A string which doesn't match results in nil.
+type extract struct {
+	Args      map[string]string
+	regex     *regexp.Regexp
+	regexSize int
+	group     int
+	all       bool
+}
+
+func (e *extract) Init(args map[string]string) error {
+	if err := knownArgs([]string{"regex", "group", "all"}, args); err != nil {
+		return err
+	}
+	if _, ok := args["regex"]; !ok {
+		return errors.New("argument \"regex\" is required")
+	}
+	re, err := regexp.Compile(args["regex"])
+	if err != nil {
+		return fmt.Errorf("failed to parse regex %q: %v", args["regex"], err)
+	}
+
+	// the default is the first capture group or the whole match if there are none
+	e.group = 0
+	if re.NumSubexp() > 0 {
+		e.group = 1
+	}
+	if group, ok := args["group"]; ok {
+		if e.group, err = regexGroup(re, group); err != nil {
+			return err
+		}
+	}
+
+	if all, ok := args["all"]; ok {
+		if e.all, err = strconv.ParseBool(all); err != nil {
+			return errors.New("the argument 'all' must be either 'true' or 'false'")
+		}
+	}
+
+	e.regex = re
+	e.regexSize = regexSize(re)
+	e.Args = args
+	return nil
+}
+
+// regexGroup returns the index of the group of the regex given by index or name.
+func regexGroup(re *regexp.Regexp, group string) (int, error) {
+	if index, err := strconv.Atoi(group); err == nil {
+		if index < 0 || index > re.NumSubexp() {
+			return 0, fmt.Errorf("the regex has no group %d", index)
+		}
+		return index, nil
+	}
+	for index, name := range re.SubexpNames() {
+		if name != "" && name == group {
+			return index, nil
+		}
+	}
+	return 0, fmt.Errorf("the regex has no group named %q", group)
+}
+
+func (e *extract) Transform(raw interface{}) (interface{}, error) {
+	return e.transformLimited(raw, Limits{})
+}
+
+// transformLimited implements the limitedOperation interface enforcing MaxRegexWork.
+func (e *extract) transformLimited(raw interface{}, limits Limits) (interface{}, error) {
+	if e.regex == nil {
+		return nil, errors.New("init was not run")
+	}
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("extract only supports strings")
+	}
+	if err := limits.checkRegexWork(e.regexSize, in); err != nil {
+		return nil, err
+	}
+
+	if !e.all {
+		match := e.regex.FindStringSubmatchIndex(in)
+		if match == nil || match[2*e.group] < 0 {
+			return nil, nil
+		}
+		return in[match[2*e.group]:match[2*e.group+1]], nil
+	}
+
+	var found []interface{}
+	for _, match := range e.regex.FindAllStringSubmatchIndex(in, -1) {
+		if match[2*e.group] < 0 {
+			continue
+		}
+		found = append(found, in[match[2*e.group]:match[2*e.group+1]])
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return found, nil
+}
+
+// split is an Operation which splits a string based on a given split string.
 type split struct {
 	Args map[string]string
 }
 
-func (s *split) init(args map[string]string) error {
+func (s *split) Init(args map[string]string) error {
 	if err := requiredArgs([]string{"on"}, args); err != nil {
 		return err
 	}
@@ -203,7 +469,7 @@ func (s *split) init(args map[string]string) error {
 	return nil
 }
 
-func (s *split) transform(raw interface{}) (interface{}, error) {
+func (s *split) Transform(raw interface{}) (interface{}, error) {
 	in, ok := raw.(string)
 	if !ok {
 		return nil, errors.New("split only supports strings")
@@ -219,6 +485,2395 @@ func (s *split) transform(raw interface{}) (interface{}, error) {
 	return interfaceSplits, nil
 }
 
+// dateTime is an Operation which parses a date-time from a string in one of a set of layouts or from a number of
+// seconds, or other unit, since the Unix epoch. The result is a time.Time or a string if an output layout is given.
+type dateTime struct {
+	Args         map[string]string
+	layouts      []string
+	epochUnit    time.Duration
+	source       *time.Location
+	target       *time.Location
+	outputLayout string
+}
+
+// epochUnits are the units of a numeric input to the dateTime operation.
+var epochUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+func (d *dateTime) Init(args map[string]string) error {
+	if err := knownArgs([]string{"inputLayouts", "epochUnit", "sourceTimezone", "targetTimezone", "outputLayout"}, args); err != nil {
+		return err
+	}
+
+	d.layouts = []string{time.RFC3339Nano}
+	if args["inputLayouts"] != "" {
+		d.layouts = nil
+		for _, layout := range strings.Split(args["inputLayouts"], "|") {
+			goLayout, err := timeLayout(layout)
+			if err != nil {
+				return err
+			}
+			d.layouts = append(d.layouts, goLayout)
+		}
+	}
+
+	d.epochUnit = time.Second
+	if unit, ok := args["epochUnit"]; ok {
+		if d.epochUnit, ok = epochUnits[unit]; !ok {
+			return fmt.Errorf("the argument 'epochUnit' must be one of 's', 'ms', 'us' or 'ns' not %q", unit)
+		}
+	}
+
+	var err error
+	d.source = time.UTC
+	if tz, ok := args["sourceTimezone"]; ok {
+		if d.source, err = time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("invalid sourceTimezone: %v", err)
+		}
+	}
+	if tz, ok := args["targetTimezone"]; ok {
+		if d.target, err = time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("invalid targetTimezone: %v", err)
+		}
+	}
+	if layout, ok := args["outputLayout"]; ok {
+		if d.outputLayout, err = timeLayout(layout); err != nil {
+			return err
+		}
+	}
+
+	d.Args = args
+	return nil
+}
+
+// rawInput implements the rawInputOperation interface, a number converted to a date-time before the operation would
+// always be taken as seconds.
+func (d *dateTime) rawInput() {}
+
+func (d *dateTime) Transform(raw interface{}) (interface{}, error) {
+	if array, ok := raw.([]interface{}); ok && len(array) == 1 {
+		raw = array[0]
+	}
+
+	var t time.Time
+	switch in := raw.(type) {
+	case time.Time:
+		t = in
+	case string:
+		parsed, err := d.parse(in)
+		if err != nil {
+			return nil, err
+		}
+		t = parsed
+	case int:
+		epoch, err := d.fromEpoch(int64(in))
+		if err != nil {
+			return nil, err
+		}
+		t = epoch
+	case float64:
+		epoch, err := d.fromEpochFloat(in)
+		if err != nil {
+			return nil, err
+		}
+		t = epoch
+	default:
+		return nil, fmt.Errorf("dateTime only supports strings, numbers and date-times not %T", raw)
+	}
+
+	if d.target != nil {
+		t = t.In(d.target)
+	}
+
+	if d.outputLayout != "" {
+		return t.Format(d.outputLayout), nil
+	}
+	return t, nil
+}
+
+// parse parses the string with the first matching layout, a string of digits is taken as a number since the epoch.
+func (d *dateTime) parse(in string) (time.Time, error) {
+	for _, layout := range d.layouts {
+		if t, err := time.ParseInLocation(layout, in, d.source); err == nil {
+			return t, nil
+		}
+	}
+	if epoch, err := strconv.ParseInt(in, 10, 64); err == nil {
+		return d.fromEpoch(epoch)
+	}
+	return time.Time{}, fmt.Errorf("dateTime input %q did not match any of the layouts %q", in, d.layouts)
+}
+
+// The range of seconds since the Unix epoch accepted as input to dateTime, the years 0000 to 9999 of an RFC 3339
+// date-time.
+const (
+	minEpochSeconds = -62167219200
+	maxEpochSeconds = 253402300799
+)
+
+// fromEpoch returns the time of a number of epoch units since the Unix epoch, splitting it into whole seconds and
+// nanoseconds so it can't overflow.
+func (d *dateTime) fromEpoch(epoch int64) (time.Time, error) {
+	perSecond := int64(time.Second / d.epochUnit)
+	seconds, remainder := epoch/perSecond, epoch%perSecond
+	if remainder < 0 {
+		seconds--
+		remainder += perSecond
+	}
+	if seconds < minEpochSeconds || seconds > maxEpochSeconds {
+		return time.Time{}, fmt.Errorf("dateTime input %d is outside the years 0000 to 9999", epoch)
+	}
+	return time.Unix(seconds, remainder*int64(d.epochUnit)).UTC(), nil
+}
+
+// fromEpochFloat is fromEpoch for a number of epoch units which may have a fraction.
+func (d *dateTime) fromEpochFloat(epoch float64) (time.Time, error) {
+	whole := math.Floor(epoch)
+	if math.IsNaN(epoch) || whole < math.MinInt64 || whole >= math.MaxInt64 {
+		return time.Time{}, fmt.Errorf("dateTime input %v is outside the years 0000 to 9999", epoch)
+	}
+	t, err := d.fromEpoch(int64(whole))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(time.Duration(math.Round((epoch - whole) * float64(d.epochUnit)))), nil
+}
+
+// strftimeDirectives maps strftime conversion specifications to the Go time layout equivalent.
+var strftimeDirectives = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'B': "January",
+	'd': "02",
+	'D': "01/02/06",
+	'e': "_2",
+	'F': "2006-01-02",
+	'h': "Jan",
+	'H': "15",
+	'I': "03",
+	'j': "002",
+	'm': "01",
+	'M': "04",
+	'p': "PM",
+	'R': "15:04",
+	'S': "05",
+	'T': "15:04:05",
+	'y': "06",
+	'Y': "2006",
+	'z': "-0700",
+	'Z': "MST",
+	'%': "%",
+}
+
+// timeLayout returns the Go time layout for a layout in either Go or strftime syntax, a layout containing a '%' is
+// taken to be strftime.
+func timeLayout(layout string) (string, error) {
+	if !strings.Contains(layout, "%") {
+		return layout, nil
+	}
+
+	var goLayout strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			goLayout.WriteByte(layout[i])
+			continue
+		}
+		i++
+		if i == len(layout) {
+			return "", fmt.Errorf("strftime layout %q ends with '%%'", layout)
+		}
+		directive, ok := strftimeDirectives[layout[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported strftime directive %%%c in layout %q", layout[i], layout)
+		}
+		goLayout.WriteString(directive)
+	}
+	return goLayout.String(), nil
+}
+
+// add is an Operation which adds a value to a number.
+type add struct {
+	Args  map[string]string
+	value float64
+}
+
+func (a *add) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"value"}, args); err != nil {
+		return err
+	}
+	var err error
+	if a.value, err = numberArg(args, "value"); err != nil {
+		return err
+	}
+	a.Args = args
+	return nil
+}
+
+func (a *add) Transform(raw interface{}) (interface{}, error) {
+	return a.transformField(raw, "number")
+}
+
+// transformField implements the fieldTypedOperation interface.
+func (a *add) transformField(raw interface{}, fieldType string) (interface{}, error) {
+	return transformNumber("add", raw, fieldType, func(in float64) float64 { return in + a.value })
+}
+
+// multiply is an Operation which multiplies a number by a value.
+type multiply struct {
+	Args map[string]string
+	by   float64
+}
+
+func (m *multiply) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"by"}, args); err != nil {
+		return err
+	}
+	var err error
+	if m.by, err = numberArg(args, "by"); err != nil {
+		return err
+	}
+	m.Args = args
+	return nil
+}
+
+func (m *multiply) Transform(raw interface{}) (interface{}, error) {
+	return m.transformField(raw, "number")
+}
+
+// transformField implements the fieldTypedOperation interface.
+func (m *multiply) transformField(raw interface{}, fieldType string) (interface{}, error) {
+	return transformNumber("multiply", raw, fieldType, func(in float64) float64 { return in * m.by })
+}
+
+// divide is an Operation which divides a number by a value.
+type divide struct {
+	Args map[string]string
+	by   float64
+}
+
+func (d *divide) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"by"}, args); err != nil {
+		return err
+	}
+	var err error
+	if d.by, err = numberArg(args, "by"); err != nil {
+		return err
+	}
+	if d.by == 0 {
+		return errors.New("the argument 'by' must not be zero")
+	}
+	d.Args = args
+	return nil
+}
+
+func (d *divide) Transform(raw interface{}) (interface{}, error) {
+	return d.transformField(raw, "number")
+}
+
+// transformField implements the fieldTypedOperation interface.
+func (d *divide) transformField(raw interface{}, fieldType string) (interface{}, error) {
+	return transformNumber("divide", raw, fieldType, func(in float64) float64 { return in / d.by })
+}
+
+// round is an Operation which rounds a number, halves are rounded away from zero.
+type round struct {
+	Args      map[string]string
+	precision float64
+}
+
+func (r *round) Init(args map[string]string) error {
+	if err := knownArgs([]string{"precision"}, args); err != nil {
+		return err
+	}
+	if raw, ok := args["precision"]; ok {
+		precision, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("the argument 'precision' must be an integer: %v", err)
+		}
+		r.precision = float64(precision)
+	}
+	r.Args = args
+	return nil
+}
+
+func (r *round) Transform(raw interface{}) (interface{}, error) {
+	return r.transformField(raw, "number")
+}
+
+// transformField implements the fieldTypedOperation interface.
+func (r *round) transformField(raw interface{}, fieldType string) (interface{}, error) {
+	scale := math.Pow(10, r.precision)
+	return transformNumber("round", raw, fieldType, func(in float64) float64 { return math.Round(in*scale) / scale })
+}
+
+// floor is an Operation which rounds a number down to the nearest integer.
+type floor struct{}
+
+func (f *floor) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (f *floor) Transform(raw interface{}) (interface{}, error) {
+	return f.transformField(raw, "number")
+}
+
+// transformField implements the fieldTypedOperation interface.
+func (f *floor) transformField(raw interface{}, fieldType string) (interface{}, error) {
+	return transformNumber("floor", raw, fieldType, math.Floor)
+}
+
+// ceil is an Operation which rounds a number up to the nearest integer.
+type ceil struct{}
+
+func (c *ceil) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (c *ceil) Transform(raw interface{}) (interface{}, error) {
+	return c.transformField(raw, "number")
+}
+
+// transformField implements the fieldTypedOperation interface.
+func (c *ceil) transformField(raw interface{}, fieldType string) (interface{}, error) {
+	return transformNumber("ceil", raw, fieldType, math.Ceil)
+}
+
+// clamp is an Operation which limits a number to a minimum and/or maximum.
+type clamp struct {
+	Args     map[string]string
+	min, max float64
+}
+
+func (c *clamp) Init(args map[string]string) error {
+	if err := knownArgs([]string{"min", "max"}, args); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("at least one of the arguments 'min' and 'max' is required")
+	}
+
+	var err error
+	c.min, c.max = math.Inf(-1), math.Inf(1)
+	if _, ok := args["min"]; ok {
+		if c.min, err = numberArg(args, "min"); err != nil {
+			return err
+		}
+	}
+	if _, ok := args["max"]; ok {
+		if c.max, err = numberArg(args, "max"); err != nil {
+			return err
+		}
+	}
+	if c.min > c.max {
+		return errors.New("the argument 'min' must not be greater than 'max'")
+	}
+	c.Args = args
+	return nil
+}
+
+func (c *clamp) Transform(raw interface{}) (interface{}, error) {
+	return c.transformField(raw, "number")
+}
+
+// transformField implements the fieldTypedOperation interface.
+func (c *clamp) transformField(raw interface{}, fieldType string) (interface{}, error) {
+	return transformNumber("clamp", raw, fieldType, func(in float64) float64 { return math.Max(c.min, math.Min(c.max, in)) })
+}
+
+// abs is an Operation which returns the absolute value of a number.
+type abs struct{}
+
+func (a *abs) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (a *abs) Transform(raw interface{}) (interface{}, error) {
+	return a.transformField(raw, "number")
+}
+
+// transformField implements the fieldTypedOperation interface.
+func (a *abs) transformField(raw interface{}, fieldType string) (interface{}, error) {
+	return transformNumber("abs", raw, fieldType, math.Abs)
+}
+
+// trim is an Operation which removes leading and trailing whitespace, or the characters in a cutset, from a string.
+type trim struct {
+	Args map[string]string
+}
+
+func (t *trim) Init(args map[string]string) error {
+	if err := knownArgs([]string{"cutset"}, args); err != nil {
+		return err
+	}
+	if cutset, ok := args["cutset"]; ok && cutset == "" {
+		return errors.New("the argument 'cutset' must not be empty")
+	}
+	t.Args = args
+	return nil
+}
+
+func (t *trim) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("trim only supports strings")
+	}
+	if cutset, ok := t.Args["cutset"]; ok {
+		return strings.Trim(in, cutset), nil
+	}
+	return strings.TrimSpace(in), nil
+}
+
+// trimPrefix is an Operation which removes a prefix from a string.
+type trimPrefix struct {
+	Args map[string]string
+}
+
+func (t *trimPrefix) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"prefix"}, args); err != nil {
+		return err
+	}
+	t.Args = args
+	return nil
+}
+
+func (t *trimPrefix) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("trimPrefix only supports strings")
+	}
+	return strings.TrimPrefix(in, t.Args["prefix"]), nil
+}
+
+// trimSuffix is an Operation which removes a suffix from a string.
+type trimSuffix struct {
+	Args map[string]string
+}
+
+func (t *trimSuffix) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"suffix"}, args); err != nil {
+		return err
+	}
+	t.Args = args
+	return nil
+}
+
+func (t *trimSuffix) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("trimSuffix only supports strings")
+	}
+	return strings.TrimSuffix(in, t.Args["suffix"]), nil
+}
+
+// substring is an Operation which returns the characters of a string from start up to end.
+type substring struct {
+	Args       map[string]string
+	start, end int
+	hasEnd     bool
+}
+
+func (s *substring) Init(args map[string]string) error {
+	if err := knownArgs([]string{"start", "end"}, args); err != nil {
+		return err
+	}
+	if _, ok := args["start"]; !ok {
+		return errors.New("argument \"start\" is required")
+	}
+
+	var err error
+	if s.start, err = intArg(args, "start"); err != nil {
+		return err
+	}
+	if _, s.hasEnd = args["end"]; s.hasEnd {
+		if s.end, err = intArg(args, "end"); err != nil {
+			return err
+		}
+	}
+	s.Args = args
+	return nil
+}
+
+func (s *substring) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("substring only supports strings")
+	}
+
+	runes := []rune(in)
+	end := len(runes)
+	if s.hasEnd {
+		end = s.end
+	}
+	start, end := sliceBounds(s.start, end, len(runes))
+	return string(runes[start:end]), nil
+}
+
+// truncate is an Operation which shortens a string to a maximum length, breaking at a word boundary where possible
+// and ending with an ellipsis.
+type truncate struct {
+	Args     map[string]string
+	length   int
+	ellipsis string
+}
+
+func (t *truncate) Init(args map[string]string) error {
+	if err := knownArgs([]string{"length", "ellipsis"}, args); err != nil {
+		return err
+	}
+	if _, ok := args["length"]; !ok {
+		return errors.New("argument \"length\" is required")
+	}
+
+	var err error
+	if t.length, err = intArg(args, "length"); err != nil {
+		return err
+	}
+	t.ellipsis = "…"
+	if ellipsis, ok := args["ellipsis"]; ok {
+		t.ellipsis = ellipsis
+	}
+	if t.length <= utf8.RuneCountInString(t.ellipsis) {
+		return errors.New("the argument 'length' must be greater than the length of the ellipsis")
+	}
+	t.Args = args
+	return nil
+}
+
+func (t *truncate) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("truncate only supports strings")
+	}
+
+	runes := []rune(in)
+	if len(runes) <= t.length {
+		return in, nil
+	}
+
+	cut := runes[:t.length-utf8.RuneCountInString(t.ellipsis)]
+	// break at the last space if the cut is within a word
+	if !unicode.IsSpace(runes[len(cut)]) {
+		for i := len(cut) - 1; i > 0; i-- {
+			if unicode.IsSpace(cut[i]) {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+	return strings.TrimRightFunc(string(cut), unicode.IsSpace) + t.ellipsis, nil
+}
+
+// pad is an Operation which pads a string to a minimum length.
+type pad struct {
+	Args   map[string]string
+	length int
+	char   string
+	right  bool
+}
+
+func (p *pad) Init(args map[string]string) error {
+	if err := knownArgs([]string{"length", "char", "side"}, args); err != nil {
+		return err
+	}
+	if _, ok := args["length"]; !ok {
+		return errors.New("argument \"length\" is required")
+	}
+
+	var err error
+	if p.length, err = intArg(args, "length"); err != nil {
+		return err
+	}
+	p.char = " "
+	if char, ok := args["char"]; ok {
+		if utf8.RuneCountInString(char) != 1 {
+			return errors.New("the argument 'char' must be a single character")
+		}
+		p.char = char
+	}
+	switch args["side"] {
+	case "", "left":
+	case "right":
+		p.right = true
+	default:
+		return errors.New("the argument 'side' must be either 'left' or 'right'")
+	}
+	p.Args = args
+	return nil
+}
+
+func (p *pad) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("pad only supports strings")
+	}
+
+	n := p.length - utf8.RuneCountInString(in)
+	if n <= 0 {
+		return in, nil
+	}
+	if p.right {
+		return in + strings.Repeat(p.char, n), nil
+	}
+	return strings.Repeat(p.char, n) + in, nil
+}
+
+// titleCase is an Operation which changes a string to title case, the first letter of each word upper case and the
+// rest lower case.
+type titleCase struct{}
+
+func (t *titleCase) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (t *titleCase) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("titleCase only supports strings")
+	}
+	// a Caser is not safe for concurrent use so a new one is made for each call
+	return cases.Title(language.Und).String(in), nil
+}
+
+// normalizeWhitespace is an Operation which replaces each run of whitespace in a string with a single space and trims
+// leading and trailing whitespace.
+type normalizeWhitespace struct{}
+
+func (n *normalizeWhitespace) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (n *normalizeWhitespace) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("normalizeWhitespace only supports strings")
+	}
+	return strings.Join(strings.Fields(in), " "), nil
+}
+
+// normalizationForms are the Unicode normalization forms supported by the normalize operation.
+var normalizationForms = map[string]norm.Form{
+	"NFC":  norm.NFC,
+	"NFD":  norm.NFD,
+	"NFKC": norm.NFKC,
+	"NFKD": norm.NFKD,
+}
+
+// normalize is an Operation which applies Unicode normalization to a string.
+type normalize struct {
+	Args map[string]string
+	form norm.Form
+}
+
+func (n *normalize) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"form"}, args); err != nil {
+		return err
+	}
+	form, ok := normalizationForms[args["form"]]
+	if !ok {
+		return errors.New("the argument 'form' must be one of 'NFC', 'NFD', 'NFKC' or 'NFKD'")
+	}
+	n.form = form
+	n.Args = args
+	return nil
+}
+
+func (n *normalize) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("normalize only supports strings")
+	}
+	return n.form.String(in), nil
+}
+
+// stripHTML is an Operation which returns the text content of an HTML fragment with entities decoded and whitespace
+// normalized. The content of script and style elements is removed.
+type stripHTML struct{}
+
+func (h *stripHTML) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (h *stripHTML) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("stripHTML only supports strings")
+	}
+	nodes, err := parseHTMLFragment(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	var text strings.Builder
+	for _, node := range nodes {
+		writeHTMLText(&text, node)
+	}
+	return strings.Join(strings.Fields(text.String()), " "), nil
+}
+
+// writeHTMLText writes the text of the node, elements which break the text such as paragraphs are separated by a
+// space.
+func writeHTMLText(text *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		text.WriteString(node.Data)
+		return
+	case html.ElementNode:
+		if htmlDroppedElements[node.DataAtom] {
+			return
+		}
+		if !htmlInlineElements[node.DataAtom] {
+			text.WriteString(" ")
+			defer text.WriteString(" ")
+		}
+	case html.CommentNode:
+		return
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeHTMLText(text, child)
+	}
+}
+
+// Defaults for the allowlists of sanitizeHTML.
+const (
+	defaultSanitizeTags       = "a,b,blockquote,br,code,em,h1,h2,h3,h4,h5,h6,i,li,ol,p,pre,strong,u,ul"
+	defaultSanitizeAttributes = "href,title"
+)
+
+// sanitizeHTML is an Operation which removes any HTML elements and attributes not in an allowlist. The content of a
+// removed element is kept except for elements such as script whose content is never safe. URLs are limited to the
+// http, https and mailto schemes.
+type sanitizeHTML struct {
+	Args       map[string]string
+	tags       map[string]bool
+	attributes map[string]bool
+}
+
+func (h *sanitizeHTML) Init(args map[string]string) error {
+	if err := knownArgs([]string{"tags", "attributes"}, args); err != nil {
+		return err
+	}
+
+	tags, ok := args["tags"]
+	if !ok {
+		tags = defaultSanitizeTags
+	}
+	h.tags = make(map[string]bool)
+	for _, tag := range splitList(tags) {
+		if htmlDroppedElements[atom.Lookup([]byte(tag))] {
+			return fmt.Errorf("the argument 'tags' must not include %q", tag)
+		}
+		h.tags[tag] = true
+	}
+
+	attributes, ok := args["attributes"]
+	if !ok {
+		attributes = defaultSanitizeAttributes
+	}
+	h.attributes = make(map[string]bool)
+	for _, attribute := range splitList(attributes) {
+		if strings.HasPrefix(attribute, "on") || attribute == "style" {
+			return fmt.Errorf("the argument 'attributes' must not include %q", attribute)
+		}
+		h.attributes[attribute] = true
+	}
+
+	h.Args = args
+	return nil
+}
+
+func (h *sanitizeHTML) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("sanitizeHTML only supports strings")
+	}
+	nodes, err := parseHTMLFragment(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	var out strings.Builder
+	for _, node := range nodes {
+		h.write(&out, node)
+	}
+	return out.String(), nil
+}
+
+// write writes the allowed parts of the node as HTML.
+func (h *sanitizeHTML) write(out *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		out.WriteString(html.EscapeString(node.Data))
+		return
+	case html.CommentNode:
+		return
+	case html.ElementNode:
+		if htmlDroppedElements[node.DataAtom] {
+			return
+		}
+		if h.tags[node.Data] {
+			out.WriteString("<" + node.Data)
+			for _, attr := range node.Attr {
+				if attr.Namespace != "" || !h.attributes[attr.Key] {
+					continue
+				}
+				if htmlURLAttributes[attr.Key] && !safeURL(attr.Val) {
+					continue
+				}
+				fmt.Fprintf(out, ` %s="%s"`, attr.Key, html.EscapeString(attr.Val))
+			}
+			out.WriteString(">")
+			if htmlVoidElements[node.DataAtom] {
+				return
+			}
+			defer out.WriteString("</" + node.Data + ">")
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		h.write(out, child)
+	}
+}
+
+// htmlToMarkdown is an Operation which converts an HTML fragment to Markdown. Headings, paragraphs, emphasis, links,
+// images, lists, quotes and code are converted, other elements are replaced by their content.
+type htmlToMarkdown struct{}
+
+func (h *htmlToMarkdown) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (h *htmlToMarkdown) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("htmlToMarkdown only supports strings")
+	}
+	nodes, err := parseHTMLFragment(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	var out markdownWriter
+	for _, node := range nodes {
+		writeMarkdown(&out, node)
+	}
+	return tidyMarkdown(out.String()), nil
+}
+
+// markdownWriter builds Markdown keeping the last byte written, so whether a text node follows a space or line
+// break is known without materialising the output.
+type markdownWriter struct {
+	strings.Builder
+	last byte
+}
+
+// WriteString appends s to the Markdown.
+func (w *markdownWriter) WriteString(s string) {
+	if s == "" {
+		return
+	}
+	w.Builder.WriteString(s)
+	w.last = s[len(s)-1]
+}
+
+// writeMarkdown writes the node as Markdown.
+func writeMarkdown(out *markdownWriter, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		text := collapseSpace(node.Data)
+		lineStart := out.last == 0 || out.last == '\n'
+		if lineStart || out.last == ' ' {
+			text = strings.TrimLeft(text, " ")
+		}
+		out.WriteString(escapeMarkdown(text, lineStart))
+		return
+	case html.CommentNode:
+		return
+	case html.ElementNode:
+	default:
+		writeMarkdownChildren(out, node)
+		return
+	}
+
+	switch node.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Template, atom.Iframe, atom.Object, atom.Embed, atom.Noscript:
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(node.Data[1] - '0')
+		out.WriteString("\n\n" + strings.Repeat("#", level) + " " + inlineMarkdown(node) + "\n\n")
+	case atom.Br:
+		out.WriteString("\n")
+	case atom.Hr:
+		out.WriteString("\n\n---\n\n")
+	case atom.Strong, atom.B:
+		if text := inlineMarkdown(node); text != "" {
+			out.WriteString("**" + text + "**")
+		}
+	case atom.Em, atom.I:
+		if text := inlineMarkdown(node); text != "" {
+			out.WriteString("*" + text + "*")
+		}
+	case atom.Code:
+		out.WriteString("`" + htmlNodeText(node) + "`")
+	case atom.Pre:
+		out.WriteString("\n\n```\n" + strings.Trim(htmlNodeText(node), "\n") + "\n```\n\n")
+	case atom.A:
+		text := inlineMarkdown(node)
+		if href := strings.TrimSpace(htmlAttr(node, "href")); href != "" && safeURL(href) {
+			text = "[" + text + "](" + markdownURL(href) + ")"
+		}
+		out.WriteString(text)
+	case atom.Img:
+		if src := strings.TrimSpace(htmlAttr(node, "src")); src != "" && safeURL(src) {
+			out.WriteString("![" + escapeMarkdown(htmlAttr(node, "alt"), false) + "](" + markdownURL(src) + ")")
+		}
+	case atom.Ul, atom.Ol:
+		out.WriteString("\n\n")
+		index := 0
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.DataAtom != atom.Li {
+				continue
+			}
+			index++
+			marker := "-"
+			if node.DataAtom == atom.Ol {
+				marker = strconv.Itoa(index) + "."
+			}
+			var item markdownWriter
+			writeMarkdownChildren(&item, child)
+			content := strings.Replace(tidyMarkdown(item.String()), "\n", "\n"+strings.Repeat(" ", len(marker)+1), -1)
+			out.WriteString(marker + " " + content + "\n")
+		}
+		out.WriteString("\n")
+	case atom.Blockquote:
+		var quote markdownWriter
+		writeMarkdownChildren(&quote, node)
+		out.WriteString("\n\n> " + strings.Replace(tidyMarkdown(quote.String()), "\n", "\n> ", -1) + "\n\n")
+	default:
+		if htmlInlineElements[node.DataAtom] {
+			writeMarkdownChildren(out, node)
+			return
+		}
+		out.WriteString("\n\n")
+		writeMarkdownChildren(out, node)
+		out.WriteString("\n\n")
+	}
+}
+
+func writeMarkdownChildren(out *markdownWriter, node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeMarkdown(out, child)
+	}
+}
+
+// inlineMarkdown returns the Markdown of the children of the node on a single line.
+func inlineMarkdown(node *html.Node) string {
+	var out markdownWriter
+	writeMarkdownChildren(&out, node)
+	return strings.Join(strings.Fields(out.String()), " ")
+}
+
+// tidyMarkdown removes trailing spaces and repeated blank lines outside of code blocks.
+func tidyMarkdown(markdown string) string {
+	var (
+		lines  []string
+		inCode bool
+		blank  bool
+	)
+	for _, line := range strings.Split(markdown, "\n") {
+		if strings.TrimSpace(line) == "```" {
+			inCode = !inCode
+		}
+		if !inCode {
+			line = strings.TrimRight(line, " \t")
+			if line == "" {
+				if blank {
+					continue
+				}
+				blank = true
+			} else {
+				blank = false
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+var (
+	// htmlDroppedElements are elements whose content is removed along with the element.
+	htmlDroppedElements = map[atom.Atom]bool{
+		atom.Script: true, atom.Style: true, atom.Head: true, atom.Template: true, atom.Iframe: true,
+		atom.Object: true, atom.Embed: true, atom.Noscript: true,
+	}
+	// htmlInlineElements are elements which don't break the flow of text.
+	htmlInlineElements = map[atom.Atom]bool{
+		atom.A: true, atom.Abbr: true, atom.B: true, atom.Cite: true, atom.Code: true, atom.Em: true, atom.I: true,
+		atom.Img: true, atom.Kbd: true, atom.Mark: true, atom.Q: true, atom.S: true, atom.Small: true, atom.Span: true,
+		atom.Strong: true, atom.Sub: true, atom.Sup: true, atom.Time: true, atom.U: true,
+	}
+	// htmlVoidElements are elements without content or an end tag.
+	htmlVoidElements = map[atom.Atom]bool{
+		atom.Area: true, atom.Br: true, atom.Col: true, atom.Hr: true, atom.Img: true, atom.Input: true,
+		atom.Source: true, atom.Track: true, atom.Wbr: true,
+	}
+	// htmlURLAttributes are attributes whose value is a URL.
+	htmlURLAttributes = map[string]bool{"href": true, "src": true, "cite": true, "action": true, "poster": true}
+
+	markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+	// markdownURLEscaper escapes the characters which would end a Markdown link destination.
+	markdownURLEscaper = strings.NewReplacer("(", `\(`, ")", `\)`, "<", "%3C", ">", "%3E", " ", "%20", "\t", "%09",
+		"\n", "%0A", "\r", "%0D")
+	markdownOrderedRe = regexp.MustCompile(`^\d+[.)]`)
+	spaceRe           = regexp.MustCompile(`\s+`)
+)
+
+// parseHTMLFragment parses HTML as the content of a body element.
+func parseHTMLFragment(in string) ([]*html.Node, error) {
+	return html.ParseFragment(strings.NewReader(in), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+}
+
+// htmlNodeText returns the text of the node and its descendants as is.
+func htmlNodeText(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	var text strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(htmlNodeText(child))
+	}
+	return text.String()
+}
+
+// htmlAttr returns the value of the named attribute of the node or "" if it is not set.
+func htmlAttr(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if attr.Namespace == "" && attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// safeURL reports whether the URL is relative or has the http, https or mailto scheme.
+func safeURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// splitList splits a comma separated list ignoring empty entries and whitespace.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func collapseSpace(text string) string {
+	return spaceRe.ReplaceAllString(text, " ")
+}
+
+// escapeMarkdown escapes the Markdown characters in text, at the start of a line this includes the markers of
+// headings, quotes and lists.
+func escapeMarkdown(text string, lineStart bool) string {
+	text = markdownEscaper.Replace(text)
+	if !lineStart || text == "" {
+		return text
+	}
+	if strings.IndexByte("#>-+", text[0]) >= 0 {
+		return `\` + text
+	}
+	if marker := markdownOrderedRe.FindString(text); marker != "" {
+		return marker[:len(marker)-1] + `\` + text[len(marker)-1:]
+	}
+	return text
+}
+
+// markdownURL returns the URL escaped for use as a Markdown link destination.
+func markdownURL(raw string) string {
+	return markdownURLEscaper.Replace(raw)
+}
+
+// resolveURL is an Operation which resolves a relative or protocol-less URL against a base URL given in the args or
+// read from the input at basePath. Without a base value in the input the URL is returned as is.
+type resolveURL struct {
+	Args map[string]string
+	base *url.URL
+}
+
+func (r *resolveURL) Init(args map[string]string) error {
+	if err := knownArgs([]string{"base", "basePath"}, args); err != nil {
+		return err
+	}
+	base, hasBase := args["base"]
+	basePath, hasBasePath := args["basePath"]
+	switch {
+	case hasBase == hasBasePath:
+		return errors.New("exactly one of the arguments 'base' and 'basePath' is required")
+	case hasBase:
+		var err error
+		if r.base, err = url.Parse(strings.TrimSpace(base)); err != nil {
+			return fmt.Errorf("invalid base URL: %v", err)
+		}
+	case basePath == "":
+		return errors.New("the argument 'basePath' must not be empty")
+	}
+
+	r.Args = args
+	return nil
+}
+
+func (r *resolveURL) Transform(raw interface{}) (interface{}, error) {
+	return r.transformPath(raw, nil)
+}
+
+// inputPath implements the pathOperation interface.
+func (r *resolveURL) inputPath() string {
+	return r.Args["basePath"]
+}
+
+func (r *resolveURL) transformPath(raw, pathValue interface{}) (interface{}, error) {
+	u, err := parseURL(raw, "resolveURL")
+	if err != nil {
+		return nil, err
+	}
+
+	base := r.base
+	if base == nil {
+		if pathValue == nil {
+			return u.String(), nil
+		}
+		if base, err = parseURL(pathValue, "resolveURL"); err != nil {
+			return nil, fmt.Errorf("invalid base URL: %v", err)
+		}
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+// urlParts are the functions returning each part of a URL for urlPart.
+var urlParts = map[string]func(u *url.URL) string{
+	"scheme":   func(u *url.URL) string { return u.Scheme },
+	"host":     func(u *url.URL) string { return u.Hostname() },
+	"port":     func(u *url.URL) string { return u.Port() },
+	"path":     func(u *url.URL) string { return u.Path },
+	"query":    func(u *url.URL) string { return u.RawQuery },
+	"fragment": func(u *url.URL) string { return u.Fragment },
+}
+
+// urlPart is an Operation which returns a part of a URL or the value of a query param. An empty part or a missing
+// query param results in nothing.
+type urlPart struct {
+	Args map[string]string
+	part func(u *url.URL) string
+}
+
+func (p *urlPart) Init(args map[string]string) error {
+	if err := knownArgs([]string{"part", "param"}, args); err != nil {
+		return err
+	}
+	part, hasPart := args["part"]
+	param, hasParam := args["param"]
+	switch {
+	case hasPart == hasParam:
+		return errors.New("exactly one of the arguments 'part' and 'param' is required")
+	case hasPart:
+		if p.part = urlParts[part]; p.part == nil {
+			return fmt.Errorf("the argument 'part' must be one of 'scheme', 'host', 'port', 'path', 'query' or 'fragment' not %q", part)
+		}
+	default:
+		p.part = func(u *url.URL) string { return u.Query().Get(param) }
+	}
+
+	p.Args = args
+	return nil
+}
+
+func (p *urlPart) Transform(raw interface{}) (interface{}, error) {
+	u, err := parseURL(raw, "urlPart")
+	if err != nil {
+		return nil, err
+	}
+	if part := p.part(u); part != "" {
+		return part, nil
+	}
+	return nil, nil
+}
+
+// setQueryParam is an Operation which sets a query param of a URL, replacing any existing values of the param.
+type setQueryParam struct {
+	Args map[string]string
+}
+
+func (s *setQueryParam) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"name", "value"}, args); err != nil {
+		return err
+	}
+	if args["name"] == "" {
+		return errors.New("the argument 'name' must not be empty")
+	}
+
+	s.Args = args
+	return nil
+}
+
+func (s *setQueryParam) Transform(raw interface{}) (interface{}, error) {
+	u, err := parseURL(raw, "setQueryParam")
+	if err != nil {
+		return nil, err
+	}
+
+	name := s.Args["name"]
+	param := url.QueryEscape(name) + "=" + url.QueryEscape(s.Args["value"])
+	var set bool
+	u.RawQuery = filterQuery(u.RawQuery, func(key string) (string, bool) {
+		if key != name {
+			return "", true
+		}
+		if set {
+			return "", false
+		}
+		set = true
+		return param, true
+	})
+	if !set {
+		u.RawQuery = joinQuery(u.RawQuery, param)
+	}
+	return u.String(), nil
+}
+
+// removeQueryParam is an Operation which removes query params from a URL. The names are a comma separated list, a
+// name ending in * removes every param with that prefix.
+type removeQueryParam struct {
+	Args  map[string]string
+	names []string
+}
+
+func (r *removeQueryParam) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"name"}, args); err != nil {
+		return err
+	}
+	if r.names = splitList(args["name"]); len(r.names) == 0 {
+		return errors.New("the argument 'name' must not be empty")
+	}
+
+	r.Args = args
+	return nil
+}
+
+func (r *removeQueryParam) Transform(raw interface{}) (interface{}, error) {
+	u, err := parseURL(raw, "removeQueryParam")
+	if err != nil {
+		return nil, err
+	}
+
+	u.RawQuery = filterQuery(u.RawQuery, func(key string) (string, bool) {
+		for _, name := range r.names {
+			if key == name || strings.HasSuffix(name, "*") && strings.HasPrefix(key, strings.TrimSuffix(name, "*")) {
+				return "", false
+			}
+		}
+		return "", true
+	})
+	return u.String(), nil
+}
+
+// defaultPorts are the ports removed from a URL with the scheme by normalizeURL.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// normalizeURL is an Operation which normalizes a URL so equivalent URLs are equal. The scheme and host are lower
+// cased, a default port is removed, dot segments are removed from the path, the query params are sorted and the
+// fragment is removed.
+type normalizeURL struct{}
+
+func (n *normalizeURL) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (n *normalizeURL) Transform(raw interface{}) (interface{}, error) {
+	u, err := parseURL(raw, "normalizeURL")
+	if err != nil {
+		return nil, err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); port != "" && port == defaultPorts[u.Scheme] {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if u.Path != "" {
+		cleaned := path.Clean(u.Path)
+		if strings.HasSuffix(u.Path, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		u.Path, u.RawPath = cleaned, ""
+	} else if u.Host != "" {
+		u.Path = "/"
+	}
+	u.RawQuery = u.Query().Encode()
+	u.ForceQuery = false
+	u.Fragment, u.RawFragment = "", ""
+	return u.String(), nil
+}
+
+// parseURL parses the raw string as a URL for the named operation, surrounding whitespace is ignored.
+func parseURL(raw interface{}, operation string) (*url.URL, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s only supports strings", operation)
+	}
+	u, err := url.Parse(strings.TrimSpace(in))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	return u, nil
+}
+
+// filterQuery calls keep with the unescaped name of each param in the raw query, keep returns whether the param is
+// kept and optionally its replacement. The order of the params is unchanged.
+func filterQuery(rawQuery string, keep func(name string) (string, bool)) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		name := param
+		if i := strings.IndexByte(name, '='); i != -1 {
+			name = name[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		replacement, ok := keep(name)
+		if !ok {
+			continue
+		}
+		if replacement != "" {
+			param = replacement
+		}
+		params = append(params, param)
+	}
+	return strings.Join(params, "&")
+}
+
+// joinQuery adds the param to the end of the raw query.
+func joinQuery(rawQuery, param string) string {
+	if rawQuery == "" {
+		return param
+	}
+	return rawQuery + "&" + param
+}
+
+// base64Encodings are the encodings of base64Encode and base64Decode by name.
+var base64Encodings = map[string]*base64.Encoding{
+	"std":    base64.StdEncoding,
+	"url":    base64.URLEncoding,
+	"rawStd": base64.RawStdEncoding,
+	"rawURL": base64.RawURLEncoding,
+}
+
+// base64Encoding returns the encoding named by the 'encoding' argument, the default is std.
+func base64Encoding(args map[string]string) (*base64.Encoding, error) {
+	name, ok := args["encoding"]
+	if !ok {
+		return base64.StdEncoding, nil
+	}
+	encoding, ok := base64Encodings[name]
+	if !ok {
+		return nil, errors.New("the argument 'encoding' must be one of 'std', 'url', 'rawStd' or 'rawURL'")
+	}
+	return encoding, nil
+}
+
+// base64Encode is an Operation which base64 encodes a string.
+type base64Encode struct {
+	Args     map[string]string
+	encoding *base64.Encoding
+}
+
+func (b *base64Encode) Init(args map[string]string) error {
+	if err := knownArgs([]string{"encoding"}, args); err != nil {
+		return err
+	}
+	var err error
+	if b.encoding, err = base64Encoding(args); err != nil {
+		return err
+	}
+	b.Args = args
+	return nil
+}
+
+func (b *base64Encode) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("base64Encode only supports strings")
+	}
+	return b.encoding.EncodeToString([]byte(in)), nil
+}
+
+// base64Decode is an Operation which decodes a base64 encoded string, the decoded value must be UTF-8 text.
+type base64Decode struct {
+	Args     map[string]string
+	encoding *base64.Encoding
+}
+
+func (b *base64Decode) Init(args map[string]string) error {
+	if err := knownArgs([]string{"encoding"}, args); err != nil {
+		return err
+	}
+	var err error
+	if b.encoding, err = base64Encoding(args); err != nil {
+		return err
+	}
+	b.Args = args
+	return nil
+}
+
+func (b *base64Decode) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("base64Decode only supports strings")
+	}
+	decoded, err := b.encoding.DecodeString(strings.TrimSpace(in))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64: %v", err)
+	}
+	if !utf8.Valid(decoded) {
+		return nil, errors.New("the decoded value is not UTF-8 text")
+	}
+	return string(decoded), nil
+}
+
+// urlEscapeArgs checks the args of urlEncode and urlDecode returning whether the 'component' argument is path.
+func urlEscapeArgs(args map[string]string) (bool, error) {
+	if err := knownArgs([]string{"component"}, args); err != nil {
+		return false, err
+	}
+	switch args["component"] {
+	case "", "query":
+		return false, nil
+	case "path":
+		return true, nil
+	}
+	return false, errors.New("the argument 'component' must be either 'query' or 'path'")
+}
+
+// urlEncode is an Operation which escapes a string for use in a URL.
+type urlEncode struct {
+	Args map[string]string
+	path bool
+}
+
+func (u *urlEncode) Init(args map[string]string) error {
+	var err error
+	if u.path, err = urlEscapeArgs(args); err != nil {
+		return err
+	}
+	u.Args = args
+	return nil
+}
+
+func (u *urlEncode) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("urlEncode only supports strings")
+	}
+	if u.path {
+		return url.PathEscape(in), nil
+	}
+	return url.QueryEscape(in), nil
+}
+
+// urlDecode is an Operation which unescapes a string escaped for use in a URL.
+type urlDecode struct {
+	Args map[string]string
+	path bool
+}
+
+func (u *urlDecode) Init(args map[string]string) error {
+	var err error
+	if u.path, err = urlEscapeArgs(args); err != nil {
+		return err
+	}
+	u.Args = args
+	return nil
+}
+
+func (u *urlDecode) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("urlDecode only supports strings")
+	}
+
+	var (
+		out string
+		err error
+	)
+	if u.path {
+		out, err = url.PathUnescape(in)
+	} else {
+		out, err = url.QueryUnescape(in)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unescape: %v", err)
+	}
+	return out, nil
+}
+
+// hashAlgorithms are the hash functions of hashValue by name.
+var hashAlgorithms = map[string]func(data []byte) []byte{
+	"md5": func(data []byte) []byte {
+		sum := md5.Sum(data)
+		return sum[:]
+	},
+	"sha1": func(data []byte) []byte {
+		sum := sha1.Sum(data)
+		return sum[:]
+	},
+	"sha256": func(data []byte) []byte {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	},
+}
+
+// hashValue is an Operation which returns the hash of a string, hex or base64 encoded.
+type hashValue struct {
+	Args   map[string]string
+	sum    func(data []byte) []byte
+	base64 bool
+}
+
+func (h *hashValue) Init(args map[string]string) error {
+	if err := knownArgs([]string{"algorithm", "encoding"}, args); err != nil {
+		return err
+	}
+	if _, ok := args["algorithm"]; !ok {
+		return errors.New("argument \"algorithm\" is required")
+	}
+	if h.sum = hashAlgorithms[args["algorithm"]]; h.sum == nil {
+		return errors.New("the argument 'algorithm' must be one of 'sha1', 'sha256' or 'md5'")
+	}
+	switch args["encoding"] {
+	case "", "hex":
+	case "base64":
+		h.base64 = true
+	default:
+		return errors.New("the argument 'encoding' must be either 'hex' or 'base64'")
+	}
+
+	h.Args = args
+	return nil
+}
+
+func (h *hashValue) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("hash only supports strings")
+	}
+	sum := h.sum([]byte(in))
+	if h.base64 {
+		return base64.StdEncoding.EncodeToString(sum), nil
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// uuidNamespaces are the namespaces predefined by RFC 4122 for name based UUIDs.
+var uuidNamespaces = map[string]string{
+	"dns":  "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+	"url":  "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+	"oid":  "6ba7b812-9dad-11d1-80b4-00c04fd430c8",
+	"x500": "6ba7b814-9dad-11d1-80b4-00c04fd430c8",
+}
+
+// uuidV5 is an Operation which returns the version 5, SHA-1 name based, UUID of a string within a namespace. The same
+// string and namespace always give the same UUID.
+type uuidV5 struct {
+	Args      map[string]string
+	namespace []byte
+}
+
+func (u *uuidV5) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"namespace"}, args); err != nil {
+		return err
+	}
+	namespace := args["namespace"]
+	if predefined, ok := uuidNamespaces[namespace]; ok {
+		namespace = predefined
+	}
+	var err error
+	if u.namespace, err = parseUUID(namespace); err != nil {
+		return fmt.Errorf("the argument 'namespace' must be a UUID or one of 'dns', 'url', 'oid' or 'x500': %v", err)
+	}
+
+	u.Args = args
+	return nil
+}
+
+func (u *uuidV5) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("uuidV5 only supports strings")
+	}
+
+	sum := sha1.Sum(append(append([]byte{}, u.namespace...), in...))
+	id := sum[:16]
+	id[6] = id[6]&0x0f | 0x50 // version 5
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return formatUUID(id), nil
+}
+
+// parseUUID parses a UUID in the canonical 8-4-4-4-12 hex form.
+func parseUUID(s string) ([]byte, error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return nil, fmt.Errorf("%q is not in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx", s)
+	}
+	return hex.DecodeString(strings.Replace(s, "-", "", -1))
+}
+
+// formatUUID formats 16 bytes as a UUID in the canonical form.
+func formatUUID(id []byte) string {
+	h := hex.EncodeToString(id)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// mask is an Operation which replaces all but the last characters of a string with a mask character.
+type mask struct {
+	Args map[string]string
+	keep int
+	char string
+}
+
+func (m *mask) Init(args map[string]string) error {
+	if err := knownArgs([]string{"keep", "char"}, args); err != nil {
+		return err
+	}
+	if _, ok := args["keep"]; !ok {
+		return errors.New("argument \"keep\" is required")
+	}
+	var err error
+	if m.keep, err = intArg(args, "keep"); err != nil {
+		return err
+	}
+	if m.keep < 0 {
+		return errors.New("the argument 'keep' must not be negative")
+	}
+	m.char = "*"
+	if char, ok := args["char"]; ok {
+		if utf8.RuneCountInString(char) != 1 {
+			return errors.New("the argument 'char' must be a single character")
+		}
+		m.char = char
+	}
+
+	m.Args = args
+	return nil
+}
+
+func (m *mask) Transform(raw interface{}) (interface{}, error) {
+	in, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("mask only supports strings")
+	}
+	runes := []rune(in)
+	masked := len(runes) - m.keep
+	if masked <= 0 {
+		return in, nil
+	}
+	return strings.Repeat(m.char, masked) + string(runes[masked:]), nil
+}
+
+// mapValue is an Operation which translates values through a table of input value to output value, the table is
+// either given inline or is a named lookup table loaded when the Transformer is built. Each item of an array is
+// translated.
+type mapValue struct {
+	Args map[string]json.RawMessage
+	// lookups are the named tables available to the operation.
+	lookups         map[string]map[string]interface{}
+	table           map[string]interface{}
+	defaultValue    interface{}
+	hasDefault      bool
+	caseInsensitive bool
+}
+
+func (m *mapValue) rawInput() {}
+
+func (m *mapValue) Init(args map[string]string) error {
+	rawArgs := make(map[string]json.RawMessage, len(args))
+	for key, value := range args {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		rawArgs[key] = raw
+	}
+	return m.InitArgs(rawArgs)
+}
+
+func (m *mapValue) InitArgs(args map[string]json.RawMessage) error {
+	for key := range args {
+		switch key {
+		case "table", "lookup", "default", "caseInsensitive":
+		default:
+			return fmt.Errorf("unexpected argument %q", key)
+		}
+	}
+
+	rawTable, hasTable := args["table"]
+	rawLookup, hasLookup := args["lookup"]
+	switch {
+	case hasTable && hasLookup:
+		return errors.New("only one of the arguments 'table' and 'lookup' is allowed")
+	case hasTable:
+		if err := json.Unmarshal(rawTable, &m.table); err != nil || m.table == nil {
+			return errors.New("the argument 'table' must be an object")
+		}
+	case hasLookup:
+		var name string
+		if err := json.Unmarshal(rawLookup, &name); err != nil {
+			return errors.New("the argument 'lookup' must be a string")
+		}
+		table, ok := m.lookups[name]
+		if !ok {
+			return fmt.Errorf("unknown lookup table %q", name)
+		}
+		m.table = table
+	default:
+		return errors.New("one of the arguments 'table' or 'lookup' is required")
+	}
+
+	if rawDefault, ok := args["default"]; ok {
+		if err := json.Unmarshal(rawDefault, &m.defaultValue); err != nil {
+			return fmt.Errorf("invalid argument 'default': %v", err)
+		}
+		m.hasDefault = true
+	}
+
+	if rawCase, ok := args["caseInsensitive"]; ok {
+		if err := json.Unmarshal(rawCase, &m.caseInsensitive); err != nil {
+			return errors.New("the argument 'caseInsensitive' must be a boolean")
+		}
+	}
+	if m.caseInsensitive {
+		folded := make(map[string]interface{}, len(m.table))
+		for key, value := range m.table {
+			lower := strings.ToLower(key)
+			if _, ok := folded[lower]; ok {
+				return fmt.Errorf("the table has more than one key matching %q ignoring case", key)
+			}
+			folded[lower] = value
+		}
+		m.table = folded
+	}
+
+	m.Args = args
+	return nil
+}
+
+func (m *mapValue) Transform(in interface{}) (interface{}, error) {
+	switch in.(type) {
+	case []interface{}, []*xmlquery.Node:
+		items, _ := arrayItems(in)
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			mapped, err := m.lookup(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = mapped
+		}
+		return result, nil
+	}
+	return m.lookup(in)
+}
+
+// lookup returns the table value for a single input value.
+func (m *mapValue) lookup(in interface{}) (interface{}, error) {
+	key, err := itemString(in)
+	if err != nil {
+		return nil, fmt.Errorf("map only supports scalar values: %v", err)
+	}
+	if m.caseInsensitive {
+		key = strings.ToLower(key)
+	}
+	if value, ok := m.table[key]; ok {
+		return deepCopy(value), nil
+	}
+	if m.hasDefault {
+		return deepCopy(m.defaultValue), nil
+	}
+	return nil, nil
+}
+
+// arrayOperation is embedded in the array operations. They are given the raw input, either a JSON array or for XML
+// input the matched nodes, and a value which isn't an array is a single item.
+type arrayOperation struct{}
+
+func (arrayOperation) rawInput()   {}
+func (arrayOperation) arrayInput() {}
+
+// join is an Operation which joins the items of an array into a string.
+type join struct {
+	arrayOperation
+	Args map[string]string
+}
+
+func (j *join) Init(args map[string]string) error {
+	if err := requiredArgs([]string{"delimiter"}, args); err != nil {
+		return err
+	}
+	j.Args = args
+	return nil
+}
+
+func (j *join) Transform(in interface{}) (interface{}, error) {
+	items, _ := arrayItems(in)
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		part, err := itemString(item)
+		if err != nil {
+			return nil, fmt.Errorf("join failed: %v", err)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, j.Args["delimiter"]), nil
+}
+
+// unique is an Operation which removes the repeated items of an array keeping the first of each.
+type unique struct {
+	arrayOperation
+	Args map[string]string
+	by   *itemPath
+}
+
+func (u *unique) Init(args map[string]string) error {
+	if err := knownArgs([]string{"by"}, args); err != nil {
+		return err
+	}
+	if by, ok := args["by"]; ok {
+		var err error
+		if u.by, err = newItemPath(by); err != nil {
+			return err
+		}
+	}
+	u.Args = args
+	return nil
+}
+
+func (u *unique) Transform(in interface{}) (interface{}, error) {
+	items, nodes := arrayItems(in)
+	seen := make(map[string]bool, len(items))
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		value := item
+		if u.by != nil {
+			var err error
+			if value, err = u.by.get(item); err != nil {
+				return nil, err
+			}
+		}
+		if node, ok := value.(*xmlquery.Node); ok {
+			value = node.InnerText()
+		}
+
+		key, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("unique failed comparing items: %v", err)
+		}
+		if seen[string(key)] {
+			continue
+		}
+		seen[string(key)] = true
+		result = append(result, item)
+	}
+	return arrayResult(result, nodes), nil
+}
+
+// flatten is an Operation which replaces any arrays nested in an array with their items.
+type flatten struct {
+	arrayOperation
+}
+
+func (f *flatten) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (f *flatten) Transform(in interface{}) (interface{}, error) {
+	items, nodes := arrayItems(in)
+	if nodes {
+		return in, nil
+	}
+	return flattenItems(make([]interface{}, 0, len(items)), items), nil
+}
+
+func flattenItems(result, items []interface{}) []interface{} {
+	for _, item := range items {
+		if nested, ok := item.([]interface{}); ok {
+			result = flattenItems(result, nested)
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// sliceItems is an Operation which returns the items of an array from start up to end.
+type sliceItems struct {
+	arrayOperation
+	Args       map[string]string
+	start, end int
+	hasEnd     bool
+}
+
+func (s *sliceItems) Init(args map[string]string) error {
+	if err := knownArgs([]string{"start", "end"}, args); err != nil {
+		return err
+	}
+	if _, ok := args["start"]; !ok {
+		return errors.New("argument \"start\" is required")
+	}
+
+	var err error
+	if s.start, err = intArg(args, "start"); err != nil {
+		return err
+	}
+	if _, s.hasEnd = args["end"]; s.hasEnd {
+		if s.end, err = intArg(args, "end"); err != nil {
+			return err
+		}
+	}
+	s.Args = args
+	return nil
+}
+
+func (s *sliceItems) Transform(in interface{}) (interface{}, error) {
+	items, nodes := arrayItems(in)
+	end := len(items)
+	if s.hasEnd {
+		end = s.end
+	}
+	start, end := sliceBounds(s.start, end, len(items))
+	return arrayResult(append([]interface{}{}, items[start:end]...), nodes), nil
+}
+
+// count is an Operation which returns the number of items in an array.
+type count struct {
+	arrayOperation
+}
+
+func (c *count) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (c *count) Transform(in interface{}) (interface{}, error) {
+	items, _ := arrayItems(in)
+	return len(items), nil
+}
+
+// sortItems is an Operation which sorts the items of an array, items without a value to sort by are placed last.
+type sortItems struct {
+	arrayOperation
+	Args       map[string]string
+	by         *itemPath
+	descending bool
+	numeric    bool
+}
+
+func (s *sortItems) Init(args map[string]string) error {
+	if err := knownArgs([]string{"by", "order", "compare"}, args); err != nil {
+		return err
+	}
+	if by, ok := args["by"]; ok {
+		var err error
+		if s.by, err = newItemPath(by); err != nil {
+			return err
+		}
+	}
+	switch args["order"] {
+	case "", "asc":
+	case "desc":
+		s.descending = true
+	default:
+		return errors.New("the argument 'order' must be either 'asc' or 'desc'")
+	}
+	switch args["compare"] {
+	case "", "lexical":
+	case "numeric":
+		s.numeric = true
+	default:
+		return errors.New("the argument 'compare' must be either 'lexical' or 'numeric'")
+	}
+	s.Args = args
+	return nil
+}
+
+func (s *sortItems) Transform(in interface{}) (interface{}, error) {
+	items, nodes := arrayItems(in)
+
+	type sortKey struct {
+		item    interface{}
+		missing bool
+		number  float64
+		text    string
+	}
+	keys := make([]sortKey, len(items))
+	for i, item := range items {
+		keys[i].item = item
+		value := item
+		if s.by != nil {
+			var err error
+			if value, err = s.by.get(item); err != nil {
+				return nil, err
+			}
+		}
+		if value == nil {
+			keys[i].missing = true
+			continue
+		}
+
+		text, err := itemString(value)
+		if err != nil {
+			return nil, fmt.Errorf("sort failed: %v", err)
+		}
+		keys[i].text = text
+		if s.numeric {
+			number, ok := numberValue(value)
+			if !ok {
+				if number, err = strconv.ParseFloat(strings.TrimSpace(text), 64); err != nil {
+					return nil, fmt.Errorf("sort value %q is not a number", text)
+				}
+			}
+			keys[i].number = number
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.missing || b.missing {
+			return !a.missing
+		}
+		if s.descending {
+			a, b = b, a
+		}
+		if s.numeric {
+			return a.number < b.number
+		}
+		return a.text < b.text
+	})
+
+	result := make([]interface{}, len(keys))
+	for i, key := range keys {
+		result[i] = key.item
+	}
+	return arrayResult(result, nodes), nil
+}
+
+// reverse is an Operation which reverses the order of the items of an array.
+type reverse struct {
+	arrayOperation
+}
+
+func (r *reverse) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (r *reverse) Transform(in interface{}) (interface{}, error) {
+	items, nodes := arrayItems(in)
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		result[len(items)-1-i] = item
+	}
+	return arrayResult(result, nodes), nil
+}
+
+// firstItem is an Operation which returns the first item of an array.
+type firstItem struct {
+	arrayOperation
+}
+
+func (f *firstItem) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (f *firstItem) Transform(in interface{}) (interface{}, error) {
+	items, _ := arrayItems(in)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items[0], nil
+}
+
+// lastItem is an Operation which returns the last item of an array.
+type lastItem struct {
+	arrayOperation
+}
+
+func (l *lastItem) Init(args map[string]string) error {
+	return requiredArgs(nil, args)
+}
+
+func (l *lastItem) Transform(in interface{}) (interface{}, error) {
+	items, _ := arrayItems(in)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items[len(items)-1], nil
+}
+
+// arrayItems returns the items of the input to an array operation, a value which isn't an array is a single item.
+// The nodes result reports whether the input was XML nodes, in which case an array result is also nodes.
+func arrayItems(in interface{}) (items []interface{}, nodes bool) {
+	switch t := in.(type) {
+	case nil:
+		return nil, false
+	case []interface{}:
+		return t, false
+	case []*xmlquery.Node:
+		items = make([]interface{}, len(t))
+		for i, node := range t {
+			items[i] = node
+		}
+		return items, true
+	}
+	return []interface{}{in}, false
+}
+
+// arrayResult returns the items as the same type of array as the input of the operation.
+func arrayResult(items []interface{}, nodes bool) interface{} {
+	if !nodes {
+		return items
+	}
+	result := make([]*xmlquery.Node, len(items))
+	for i, item := range items {
+		result[i] = item.(*xmlquery.Node)
+	}
+	return result
+}
+
+// itemString returns an array item as a string, for an XML node this is the text of the node.
+func itemString(item interface{}) (string, error) {
+	if node, ok := item.(*xmlquery.Node); ok {
+		return node.InnerText(), nil
+	}
+	str, err := convertString(item)
+	if err != nil || str == nil {
+		return "", err
+	}
+	return str.(string), nil
+}
+
+// itemPath is a path relative to an array item. For JSON it is a JSONPath starting with `@`, ie `@.url`, otherwise
+// it is an XPath relative to the XML node, ie `@type` or `bitrate`.
+type itemPath struct {
+	path     string
+	jsonPath gval.Evaluable
+	xPath    *xpath.Expr
+}
+
+func newItemPath(path string) (*itemPath, error) {
+	p := &itemPath{path: path}
+	if path == "@" || strings.HasPrefix(path, "@.") || strings.HasPrefix(path, "@[") {
+		eval, err := jsonpath.New("$" + path[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JSONPath %q: %v", path, err)
+		}
+		p.jsonPath = eval
+		return p, nil
+	}
+
+	expr, err := xpath.Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a relative JSONPath starting with '@' nor an XPath: %v", path, err)
+	}
+	p.xPath = expr
+	return p, nil
+}
+
+// get returns the value of the path for the item or nil if there is none. For an XML node the value is the text of
+// the first match.
+func (p *itemPath) get(item interface{}) (interface{}, error) {
+	if node, ok := item.(*xmlquery.Node); ok {
+		if p.xPath == nil {
+			return nil, fmt.Errorf("the JSONPath %q can't be used with XML input", p.path)
+		}
+		matches := p.xPath.Select(xmlquery.CreateXPathNavigator(node))
+		if !matches.MoveNext() {
+			return nil, nil
+		}
+		return matches.Current().Value(), nil
+	}
+
+	if p.jsonPath == nil {
+		return nil, fmt.Errorf("the XPath %q can't be used with JSON input", p.path)
+	}
+	value, err := p.jsonPath(context.Background(), item)
+	if err != nil {
+		// the path is not in this item
+		return nil, nil
+	}
+	return value, nil
+}
+
+// itemPredicate is a condition on an array item. For JSON it is a JSONPath filter expression using `@` for the item,
+// ie `@.type == "mp4"`, otherwise it is an XPath predicate on the XML node, ie `@type='mp4'`.
+type itemPredicate struct {
+	predicate string
+	jsonPath  gval.Evaluable
+	xPath     *xpath.Expr
+}
+
+// filterLanguage is JSONPath with the full gval expression language for filters.
+var filterLanguage = gval.Full(jsonpath.Language())
+
+func newItemPredicate(predicate string) (*itemPredicate, error) {
+	p := &itemPredicate{predicate: predicate}
+	if strings.Contains(predicate, "@.") || strings.Contains(predicate, "@[") {
+		eval, err := filterLanguage.NewEvaluable("$[?(" + predicate + ")]")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse predicate %q: %v", predicate, err)
+		}
+		p.jsonPath = eval
+		return p, nil
+	}
+
+	expr, err := xpath.Compile("self::node()[" + predicate + "]")
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a JSONPath filter expression using '@' nor an XPath predicate: %v", predicate, err)
+	}
+	p.xPath = expr
+	return p, nil
+}
+
+// match reports whether the item satisfies the predicate.
+func (p *itemPredicate) match(item interface{}) (bool, error) {
+	if node, ok := item.(*xmlquery.Node); ok {
+		if p.xPath == nil {
+			return false, fmt.Errorf("the JSONPath predicate %q can't be used with XML input", p.predicate)
+		}
+		return p.xPath.Select(xmlquery.CreateXPathNavigator(node)).MoveNext(), nil
+	}
+
+	if p.jsonPath == nil {
+		return false, fmt.Errorf("the XPath predicate %q can't be used with JSON input", p.predicate)
+	}
+	matches, err := p.jsonPath(context.Background(), []interface{}{item})
+	if err != nil {
+		return false, fmt.Errorf("failed evaluating predicate %q: %v", p.predicate, err)
+	}
+	matched, _ := matches.([]interface{})
+	return len(matched) > 0, nil
+}
+
+// sliceBounds converts start and end indexes, either of which may be negative to count from the end, to bounds
+// within a slice of the given length.
+func sliceBounds(start, end, length int) (int, int) {
+	bound := func(i int) int {
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > length {
+			return length
+		}
+		return i
+	}
+	start, end = bound(start), bound(end)
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+// intArg parses the named arg as an integer.
+func intArg(args map[string]string, name string) (int, error) {
+	value, err := strconv.Atoi(args[name])
+	if err != nil {
+		return 0, fmt.Errorf("the argument %q must be an integer not %q", name, args[name])
+	}
+	return value, nil
+}
+
+// transformNumber is the common implementation of the numeric operations. The input is converted to a float64 for
+// apply and the result is a float64, or for integer fields an int rounded half away from zero.
+func transformNumber(name string, raw interface{}, fieldType string, apply func(float64) float64) (interface{}, error) {
+	if array, ok := raw.([]interface{}); ok && len(array) == 1 {
+		raw = array[0]
+	}
+
+	var in float64
+	switch t := raw.(type) {
+	case int:
+		in = float64(t)
+	case float64:
+		in = t
+	case string:
+		converted, err := convertNumber(t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if converted == nil {
+			return nil, nil
+		}
+		return transformNumber(name, converted, fieldType, apply)
+	default:
+		return nil, fmt.Errorf("%s only supports numbers and numeric strings not %T", name, raw)
+	}
+
+	out := apply(in)
+	if math.IsNaN(out) || math.IsInf(out, 0) {
+		return nil, fmt.Errorf("%s of %v is not a finite number", name, raw)
+	}
+	if fieldType == "integer" {
+		out = math.Round(out)
+		if math.Abs(out) < 1<<53 {
+			return int(out), nil
+		}
+	}
+	return out, nil
+}
+
+// numberArg parses the named arg as a number.
+func numberArg(args map[string]string, name string) (float64, error) {
+	value, err := strconv.ParseFloat(args[name], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("the argument %q must be a number not %q", name, args[name])
+	}
+	return value, nil
+}
+
+// knownArgs checks the given args map only contains args from the known list, all of which are optional.
+func knownArgs(known []string, args map[string]string) error {
+	for arg := range args {
+		found := false
+		for _, k := range known {
+			if arg == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown argument %q, expected args from %v", arg, known)
+		}
+	}
+	return nil
+}
+
 // requiredArgs checks the given args map to make sure it contains the required args and only the required args.
 func requiredArgs(required []string, args map[string]string) error {
 	if len(args) != len(required) {
@@ -1,10 +1,15 @@
 package transform
 
 import (
+	"encoding/json"
 	"errors"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/antchfx/xmlquery"
 )
 
 type testOp struct {
@@ -13,7 +18,7 @@ type testOp struct {
 	fail   bool
 }
 
-func (op *testOp) init(args map[string]string) error {
+func (op *testOp) Init(args map[string]string) error {
 	fail, err := strconv.ParseBool(args["fail"])
 	if err != nil {
 		return err
@@ -23,7 +28,7 @@ func (op *testOp) init(args map[string]string) error {
 	return nil
 }
 
-func (op *testOp) transform(in interface{}) (interface{}, error) {
+func (op *testOp) Transform(in interface{}) (interface{}, error) {
 	if op.fail {
 		return nil, errors.New("fail")
 	}
@@ -41,11 +46,11 @@ type opTests struct {
 }
 
 // A common test runner for all the operations tests
-func runOpTests(t *testing.T, opType func() transformOperation, tests []opTests) {
+func runOpTests(t *testing.T, opType func() Operation, tests []opTests) {
 
 	for _, test := range tests {
 		op := opType()
-		err := op.init(test.args)
+		err := op.Init(test.args)
 
 		switch {
 		case test.wantInitErr && err != nil:
@@ -56,7 +61,7 @@ func runOpTests(t *testing.T, opType func() transformOperation, tests []opTests)
 			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
 		}
 
-		got, err := op.transform(test.in)
+		got, err := op.Transform(test.in)
 
 		switch {
 		case test.wantErr && err != nil:
@@ -124,7 +129,7 @@ func TestDuration(t *testing.T) {
 			wantErr:     true,
 		},
 	}
-	runOpTests(t, func() transformOperation { return &duration{} }, tests)
+	runOpTests(t, func() Operation { return &duration{} }, tests)
 }
 
 func TestChangeCase(t *testing.T) {
@@ -173,7 +178,7 @@ func TestChangeCase(t *testing.T) {
 		},
 	}
 
-	runOpTests(t, func() transformOperation { return &changeCase{} }, tests)
+	runOpTests(t, func() Operation { return &changeCase{} }, tests)
 }
 
 func TestInverse(t *testing.T) {
@@ -200,7 +205,7 @@ func TestInverse(t *testing.T) {
 		},
 	}
 
-	runOpTests(t, func() transformOperation { return &inverse{} }, tests)
+	runOpTests(t, func() Operation { return &inverse{} }, tests)
 }
 
 func TestMax(t *testing.T) {
@@ -233,19 +238,66 @@ func TestMax(t *testing.T) {
 			wantInitErr: true,
 		},
 		{
-			description: "Missing return arg",
+			description: "Missing return arg returns the max",
 			args:        map[string]string{"by": "@.encodingRate"},
 			in: []interface{}{
 				map[string]interface{}{"url": "max", "encodingRate": 10},
 				map[string]interface{}{"url": "min", "encodingRate": 2},
 			},
+			want: 10.0,
+		},
+		{
+			description: "Negative numbers",
+			args:        map[string]string{"by": "@.encodingRate", "return": "@.url"},
+			in: []interface{}{
+				map[string]interface{}{"url": "min", "encodingRate": -10},
+				map[string]interface{}{"url": "max", "encodingRate": -2.5},
+			},
+			want: "max",
+		},
+		{
+			description: "Empty array",
+			args:        map[string]string{"by": "@.encodingRate", "return": "@.url"},
+			in:          []interface{}{},
+			want:        nil,
+		},
+		{
+			description: "where",
+			args:        map[string]string{"by": "@.encodingRate", "return": "@.url", "where": `@.type == "mp4"`},
+			in: []interface{}{
+				map[string]interface{}{"url": "a", "encodingRate": 10, "type": "hls"},
+				map[string]interface{}{"url": "b", "encodingRate": 8, "type": "mp4"},
+				map[string]interface{}{"url": "c", "encodingRate": 2, "type": "mp4"},
+			},
+			want: "b",
+		},
+		{
+			description: "where matches nothing",
+			args:        map[string]string{"by": "@.encodingRate", "where": `@.type == "webm"`},
+			in: []interface{}{
+				map[string]interface{}{"url": "a", "encodingRate": 10, "type": "hls"},
+			},
+			want: nil,
+		},
+		{
+			description: "Invalid where",
+			args:        map[string]string{"by": "@.encodingRate", "where": `@.type ==`},
 			wantInitErr: true,
 		},
 		{
-			description: "by field is not a number",
+			description: "by field is a numeric string",
 			args:        map[string]string{"by": "@.encodingRate", "return": "@.url"},
 			in: []interface{}{
 				map[string]interface{}{"url": "max", "encodingRate": "10"},
+				map[string]interface{}{"url": "min", "encodingRate": "2.5"},
+			},
+			want: "max",
+		},
+		{
+			description: "by field is not a number",
+			args:        map[string]string{"by": "@.encodingRate", "return": "@.url"},
+			in: []interface{}{
+				map[string]interface{}{"url": "max", "encodingRate": "fast"},
 				map[string]interface{}{"url": "min", "encodingRate": "2"},
 			},
 			wantErr: true,
@@ -267,7 +319,96 @@ func TestMax(t *testing.T) {
 		},
 	}
 
-	runOpTests(t, func() transformOperation { return &max{} }, tests)
+	runOpTests(t, func() Operation { return &aggregate{kind: "max"} }, tests)
+}
+
+func TestAggregate(t *testing.T) {
+	doc, err := xmlquery.Parse(strings.NewReader(`<renditions>
+		<rendition type="mp4"><bitrate>800</bitrate></rendition>
+		<rendition type="hls"><bitrate>2400</bitrate></rendition>
+		<rendition type="mp4"><bitrate>1200</bitrate></rendition>
+	</renditions>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := xmlquery.Find(doc, "//rendition")
+
+	renditions := []interface{}{
+		map[string]interface{}{"type": "mp4", "bitrate": 800, "url": "a"},
+		map[string]interface{}{"type": "hls", "bitrate": 2400.0, "url": "b"},
+		map[string]interface{}{"type": "mp4", "bitrate": 1200, "url": "d"},
+	}
+	invalid := []interface{}{
+		map[string]interface{}{"bitrate": 800},
+		map[string]interface{}{"url": "c"},
+		map[string]interface{}{"bitrate": "high"},
+		map[string]interface{}{"bitrate": "1200"},
+	}
+
+	tests := []struct {
+		description string
+		kind        string
+		args        map[string]string
+		in          interface{}
+		fieldType   string
+		want        interface{}
+		wantErr     bool
+		wantInitErr bool
+	}{
+		{description: "min", kind: "min", in: []interface{}{3, -1.5, 2}, want: -1.5},
+		{description: "min return", kind: "min", args: map[string]string{"by": "@.bitrate", "return": "@.url"}, in: renditions, want: "a"},
+		{description: "max integer field", kind: "max", args: map[string]string{"by": "@.bitrate"}, in: renditions, fieldType: "integer", want: 2400},
+		{description: "sum", kind: "sum", args: map[string]string{"by": "@.bitrate"}, in: renditions, want: 4400.0},
+		{description: "sum where", kind: "sum", args: map[string]string{"by": "@.bitrate", "where": `@.type == "mp4"`}, in: renditions, fieldType: "integer", want: 2000},
+		{description: "sum return", kind: "sum", args: map[string]string{"return": "@.url"}, wantInitErr: true},
+		{description: "avg", kind: "avg", in: []interface{}{1, 2}, want: 1.5},
+		{description: "avg empty", kind: "avg", in: []interface{}{}, want: nil},
+		{description: "argmax", kind: "argmax", args: map[string]string{"by": "@.bitrate", "where": `@.type == "mp4"`}, in: renditions, want: renditions[2]},
+		{description: "argmin return", kind: "argmin", args: map[string]string{"by": "@.bitrate", "return": "@.type"}, in: renditions, want: "mp4"},
+		{description: "argmax XML", kind: "argmax", args: map[string]string{"by": "bitrate", "where": "@type='mp4'"}, in: nodes, want: nodes[2]},
+		{description: "max XML return", kind: "max", args: map[string]string{"by": "bitrate", "return": "@type"}, in: nodes, want: "hls"},
+		{description: "sum XML", kind: "sum", args: map[string]string{"by": "bitrate"}, in: nodes, fieldType: "integer", want: 4400},
+		{description: "XML where with JSON", kind: "sum", args: map[string]string{"by": "bitrate", "where": `@.type == "mp4"`}, in: nodes, wantErr: true},
+		{description: "not a number", kind: "sum", in: []interface{}{1, true}, wantErr: true},
+		{description: "missing by field", kind: "max", args: map[string]string{"by": "@.bitrate"}, in: invalid[:2], wantErr: true},
+		{description: "by field not a number", kind: "max", args: map[string]string{"by": "@.bitrate"}, in: invalid[2:], wantErr: true},
+		{description: "skip invalid", kind: "sum", args: map[string]string{"by": "@.bitrate", "skipInvalid": "true"}, in: invalid, want: 2000.0},
+		{description: "skip invalid not a boolean", kind: "sum", args: map[string]string{"skipInvalid": "yes"}, wantInitErr: true},
+		{description: "unknown kind", kind: "median", wantInitErr: true},
+	}
+
+	for _, test := range tests {
+		op := &aggregate{kind: test.kind}
+		err := op.Init(test.args)
+
+		switch {
+		case test.wantInitErr && err != nil:
+			continue
+		case test.wantInitErr && err == nil:
+			t.Errorf("Test %q - got init error nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
+			continue
+		}
+
+		fieldType := test.fieldType
+		if fieldType == "" {
+			fieldType = "number"
+		}
+		got, err := op.transformField(test.in, fieldType)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
 }
 
 func TestReplace(t *testing.T) {
@@ -304,7 +445,88 @@ func TestReplace(t *testing.T) {
 		},
 	}
 
-	runOpTests(t, func() transformOperation { return &replace{} }, tests)
+	runOpTests(t, func() Operation { return &replace{} }, tests)
+}
+
+func TestExtract(t *testing.T) {
+	tests := []opTests{
+		{
+			description: "First group by default",
+			args:        map[string]string{"regex": `/video/(\d+)/`},
+			in:          "https://example.com/video/12345/title",
+			want:        "12345",
+		},
+		{
+			description: "Whole match without groups",
+			args:        map[string]string{"regex": `\d{4}`},
+			in:          "Taken in 1999 by",
+			want:        "1999",
+		},
+		{
+			description: "Group by index",
+			args:        map[string]string{"regex": `(\w+)@(\w+)`, "group": "2"},
+			in:          "me@example",
+			want:        "example",
+		},
+		{
+			description: "Group by name",
+			args:        map[string]string{"regex": `(?P<user>\w+)@(?P<host>\w+)`, "group": "user"},
+			in:          "me@example",
+			want:        "me",
+		},
+		{
+			description: "All matches",
+			args:        map[string]string{"regex": `#(\w+)`, "all": "true"},
+			in:          "#one two #three",
+			want:        []interface{}{"one", "three"},
+		},
+		{
+			description: "No match",
+			args:        map[string]string{"regex": `(\d+)`},
+			in:          "none",
+			want:        nil,
+		},
+		{
+			description: "No match, all",
+			args:        map[string]string{"regex": `(\d+)`, "all": "true"},
+			in:          "none",
+			want:        nil,
+		},
+		{
+			description: "Unmatched optional group",
+			args:        map[string]string{"regex": `a(b)?`},
+			in:          "a",
+			want:        nil,
+		},
+		{
+			description: "Unknown group index",
+			args:        map[string]string{"regex": `(a)`, "group": "2"},
+			wantInitErr: true,
+		},
+		{
+			description: "Unknown group name",
+			args:        map[string]string{"regex": `(?P<a>a)`, "group": "b"},
+			wantInitErr: true,
+		},
+		{
+			description: "Invalid regex",
+			args:        map[string]string{"regex": `(`},
+			wantInitErr: true,
+		},
+		{
+			description: "Invalid all",
+			args:        map[string]string{"regex": `a`, "all": "yes"},
+			wantInitErr: true,
+		},
+		{
+			description: "Non-string input",
+			args:        map[string]string{"regex": `a`},
+			in:          5,
+			wantErr:     true,
+		},
+	}
+
+	runOpTests(t, func() Operation { return &extract{} }, tests)
 }
 
 func TestSplit(t *testing.T) {
@@ -335,5 +557,816 @@ func TestSplit(t *testing.T) {
 		},
 	}
 
-	runOpTests(t, func() transformOperation { return &split{} }, tests)
+	runOpTests(t, func() Operation { return &split{} }, tests)
+}
+
+func TestDateTime(t *testing.T) {
+	want := time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC)
+
+	tests := []opTests{
+		{
+			description: "Default RFC3339",
+			in:          "2006-01-02T15:04:00Z",
+			want:        want,
+		},
+		{
+			description: "Go layout with a zone",
+			args:        map[string]string{"inputLayouts": "Mon, 02 Jan 2006 15:04 -0700"},
+			in:          "Mon, 02 Jan 2006 10:04 -0500",
+			want:        want.In(time.FixedZone("", -5*60*60)),
+		},
+		{
+			description: "Multiple layouts, second matches",
+			args:        map[string]string{"inputLayouts": "2006-01-02T15:04:05Z07:00|2006-01-02"},
+			in:          "2006-01-02",
+			want:        time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			description: "strftime layout",
+			args:        map[string]string{"inputLayouts": "%d/%m/%Y %H:%M"},
+			in:          "02/01/2006 15:04",
+			want:        want,
+		},
+		{
+			description: "Epoch milliseconds",
+			args:        map[string]string{"epochUnit": "ms"},
+			in:          1136214240000,
+			want:        want,
+		},
+		{
+			description: "Epoch milliseconds as a float",
+			args:        map[string]string{"epochUnit": "ms"},
+			in:          1136214240000.0,
+			want:        want,
+		},
+		{
+			description: "Epoch seconds string",
+			in:          "1136214240",
+			want:        want,
+		},
+		{
+			description: "Epoch seconds with a fraction",
+			in:          1136214240.25,
+			want:        want.Add(250 * time.Millisecond),
+		},
+		{
+			description: "Negative epoch milliseconds",
+			args:        map[string]string{"epochUnit": "ms"},
+			in:          -1500,
+			want:        time.Date(1969, 12, 31, 23, 59, 58, 500000000, time.UTC),
+		},
+		{
+			description: "Epoch seconds at the end of year 9999",
+			in:          253402300799,
+			want:        time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			description: "Epoch seconds after year 9999",
+			in:          253402300800,
+			wantErr:     true,
+		},
+		{
+			description: "Epoch seconds before year 0000",
+			in:          -62167219201.0,
+			wantErr:     true,
+		},
+		{
+			description: "Epoch milliseconds overflowing a duration",
+			args:        map[string]string{"epochUnit": "ms"},
+			in:          1e16,
+			wantErr:     true,
+		},
+		{
+			description: "Epoch nanoseconds beyond int64",
+			args:        map[string]string{"epochUnit": "ns"},
+			in:          1e19,
+			wantErr:     true,
+		},
+		{
+			description: "Epoch seconds string after year 9999",
+			in:          "9223372036854775807",
+			wantErr:     true,
+		},
+		{
+			description: "Source and target timezones with output layout",
+			args: map[string]string{
+				"inputLayouts":   "2006-01-02 15:04",
+				"sourceTimezone": "America/New_York",
+				"targetTimezone": "Europe/London",
+				"outputLayout":   time.RFC3339,
+			},
+			in:   "2006-01-02 10:04",
+			want: "2006-01-02T15:04:00Z",
+		},
+		{
+			description: "strftime output layout",
+			args:        map[string]string{"outputLayout": "%A %e %B %Y"},
+			in:          []interface{}{"2006-01-02T15:04:00Z"},
+			want:        "Monday  2 January 2006",
+		},
+		{
+			description: "date-time input",
+			args:        map[string]string{"outputLayout": "%F"},
+			in:          want,
+			want:        "2006-01-02",
+		},
+		{
+			description: "No layout matches",
+			args:        map[string]string{"inputLayouts": "2006-01-02"},
+			in:          "Jan 2 2006",
+			wantErr:     true,
+		},
+		{
+			description: "Unsupported input",
+			in:          true,
+			wantErr:     true,
+		},
+		{
+			description: "Unknown arg",
+			args:        map[string]string{"layout": "2006"},
+			wantInitErr: true,
+		},
+		{
+			description: "Invalid epoch unit",
+			args:        map[string]string{"epochUnit": "days"},
+			wantInitErr: true,
+		},
+		{
+			description: "Invalid timezone",
+			args:        map[string]string{"sourceTimezone": "Nowhere/Special"},
+			wantInitErr: true,
+		},
+		{
+			description: "Unsupported strftime directive",
+			args:        map[string]string{"outputLayout": "%Q"},
+			wantInitErr: true,
+		},
+	}
+
+	runOpTests(t, func() Operation { return &dateTime{} }, tests)
+}
+
+func TestNumericOperations(t *testing.T) {
+	tests := []struct {
+		description string
+		op          Operation
+		args        map[string]string
+		in          interface{}
+		want        interface{}
+		wantErr     bool
+		wantInitErr bool
+	}{
+		{description: "add int", op: &add{}, args: map[string]string{"value": "2"}, in: 3, want: 5.0},
+		{description: "add negative to string", op: &add{}, args: map[string]string{"value": "-1.5"}, in: "3", want: 1.5},
+		{description: "add non number arg", op: &add{}, args: map[string]string{"value": "two"}, wantInitErr: true},
+		{description: "add missing arg", op: &add{}, args: map[string]string{}, wantInitErr: true},
+		{description: "multiply float", op: &multiply{}, args: map[string]string{"by": "0.5"}, in: 9.0, want: 4.5},
+		{description: "multiply single item array", op: &multiply{}, args: map[string]string{"by": "2"}, in: []interface{}{4}, want: 8.0},
+		{description: "divide milliseconds", op: &divide{}, args: map[string]string{"by": "1000"}, in: 1500, want: 1.5},
+		{description: "divide by zero", op: &divide{}, args: map[string]string{"by": "0"}, wantInitErr: true},
+		{description: "divide non numeric string", op: &divide{}, args: map[string]string{"by": "2"}, in: "abc", wantErr: true},
+		{description: "divide boolean", op: &divide{}, args: map[string]string{"by": "2"}, in: true, wantErr: true},
+		{description: "round", op: &round{}, in: 2.5, want: 3.0},
+		{description: "round negative half", op: &round{}, in: -2.5, want: -3.0},
+		{description: "round precision", op: &round{}, args: map[string]string{"precision": "2"}, in: "19.987", want: 19.99},
+		{description: "round negative precision", op: &round{}, args: map[string]string{"precision": "-2"}, in: 1250, want: 1300.0},
+		{description: "round invalid precision", op: &round{}, args: map[string]string{"precision": "1.5"}, wantInitErr: true},
+		{description: "round unknown arg", op: &round{}, args: map[string]string{"places": "1"}, wantInitErr: true},
+		{description: "floor", op: &floor{}, in: -1.5, want: -2.0},
+		{description: "floor with args", op: &floor{}, args: map[string]string{"to": "1"}, wantInitErr: true},
+		{description: "ceil", op: &ceil{}, in: 1.2, want: 2.0},
+		{description: "clamp below", op: &clamp{}, args: map[string]string{"min": "0", "max": "5"}, in: -3, want: 0.0},
+		{description: "clamp above", op: &clamp{}, args: map[string]string{"min": "0", "max": "5"}, in: 7.5, want: 5.0},
+		{description: "clamp min only", op: &clamp{}, args: map[string]string{"min": "0"}, in: 1e9, want: 1e9},
+		{description: "clamp no args", op: &clamp{}, args: map[string]string{}, wantInitErr: true},
+		{description: "clamp min over max", op: &clamp{}, args: map[string]string{"min": "5", "max": "0"}, wantInitErr: true},
+		{description: "abs", op: &abs{}, in: "-4.25", want: 4.25},
+		{description: "empty string", op: &abs{}, in: "", want: nil},
+		{description: "overflow", op: &multiply{}, args: map[string]string{"by": "1e308"}, in: 1e308, wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := test.op.Init(test.args)
+
+		switch {
+		case test.wantInitErr && err != nil:
+			continue
+		case test.wantInitErr && err == nil:
+			t.Errorf("Test %q - got init error nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
+			continue
+		}
+
+		got, err := test.op.Transform(test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestStringOperations(t *testing.T) {
+	tests := []struct {
+		description string
+		op          Operation
+		args        map[string]string
+		in          interface{}
+		want        interface{}
+		wantErr     bool
+		wantInitErr bool
+	}{
+		{description: "trim whitespace", op: &trim{}, in: " \tabc\n", want: "abc"},
+		{description: "trim cutset", op: &trim{}, args: map[string]string{"cutset": "/"}, in: "/a/b/", want: "a/b"},
+		{description: "trim empty cutset", op: &trim{}, args: map[string]string{"cutset": ""}, wantInitErr: true},
+		{description: "trim non-string", op: &trim{}, in: 5, wantErr: true},
+		{description: "trimPrefix", op: &trimPrefix{}, args: map[string]string{"prefix": "http://"}, in: "http://a.com", want: "a.com"},
+		{description: "trimPrefix missing arg", op: &trimPrefix{}, args: map[string]string{}, wantInitErr: true},
+		{description: "trimSuffix", op: &trimSuffix{}, args: map[string]string{"suffix": ".jpg"}, in: "a.jpg", want: "a"},
+		{description: "substring", op: &substring{}, args: map[string]string{"start": "1", "end": "3"}, in: "héllo", want: "él"},
+		{description: "substring to end", op: &substring{}, args: map[string]string{"start": "2"}, in: "hello", want: "llo"},
+		{description: "substring negative", op: &substring{}, args: map[string]string{"start": "-3", "end": "-1"}, in: "hello", want: "ll"},
+		{description: "substring out of range", op: &substring{}, args: map[string]string{"start": "10"}, in: "hello", want: ""},
+		{description: "substring missing start", op: &substring{}, args: map[string]string{"end": "1"}, wantInitErr: true},
+		{description: "substring invalid end", op: &substring{}, args: map[string]string{"start": "0", "end": "x"}, wantInitErr: true},
+		{description: "truncate short", op: &truncate{}, args: map[string]string{"length": "20"}, in: "short", want: "short"},
+		{description: "truncate at word", op: &truncate{}, args: map[string]string{"length": "12"}, in: "The quick brown fox", want: "The quick…"},
+		{description: "truncate at space", op: &truncate{}, args: map[string]string{"length": "11", "ellipsis": "..."}, in: "The quick brown fox", want: "The..."},
+		{description: "truncate single word", op: &truncate{}, args: map[string]string{"length": "5"}, in: "abcdefgh", want: "abcd…"},
+		{description: "truncate length too small", op: &truncate{}, args: map[string]string{"length": "3", "ellipsis": "..."}, wantInitErr: true},
+		{description: "pad left", op: &pad{}, args: map[string]string{"length": "5", "char": "0"}, in: "42", want: "00042"},
+		{description: "pad right", op: &pad{}, args: map[string]string{"length": "4", "side": "right"}, in: "ab", want: "ab  "},
+		{description: "pad longer input", op: &pad{}, args: map[string]string{"length": "2"}, in: "abc", want: "abc"},
+		{description: "pad multiple chars", op: &pad{}, args: map[string]string{"length": "5", "char": "ab"}, wantInitErr: true},
+		{description: "pad invalid side", op: &pad{}, args: map[string]string{"length": "5", "side": "both"}, wantInitErr: true},
+		{description: "titleCase", op: &titleCase{}, in: "the QUICK brown-fox", want: "The Quick Brown-Fox"},
+		{description: "titleCase with args", op: &titleCase{}, args: map[string]string{"to": "title"}, wantInitErr: true},
+		{description: "normalizeWhitespace", op: &normalizeWhitespace{}, in: "  a \t b\n\nc ", want: "a b c"},
+		{description: "normalize NFC", op: &normalize{}, args: map[string]string{"form": "NFC"}, in: "e\u0301", want: "\u00e9"},
+		{description: "normalize NFKD", op: &normalize{}, args: map[string]string{"form": "NFKD"}, in: "\ufb01", want: "fi"},
+		{description: "normalize unknown form", op: &normalize{}, args: map[string]string{"form": "NFX"}, wantInitErr: true},
+	}
+
+	for _, test := range tests {
+		err := test.op.Init(test.args)
+
+		switch {
+		case test.wantInitErr && err != nil:
+			continue
+		case test.wantInitErr && err == nil:
+			t.Errorf("Test %q - got init error nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
+			continue
+		}
+
+		got, err := test.op.Transform(test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestHTMLOperations(t *testing.T) {
+	tests := []struct {
+		description string
+		op          Operation
+		args        map[string]string
+		in          interface{}
+		want        interface{}
+		wantErr     bool
+		wantInitErr bool
+	}{
+		{
+			description: "stripHTML",
+			op:          &stripHTML{},
+			in:          "<p>Fish &amp; <b>chips</b></p><p>caf&eacute;<br>open</p>",
+			want:        "Fish & chips café open",
+		},
+		{
+			description: "stripHTML removes scripts and comments",
+			op:          &stripHTML{},
+			in:          `<div>a<script>alert("x")</script><!-- note --><style>p {}</style>b</div>`,
+			want:        "ab",
+		},
+		{
+			description: "stripHTML plain text",
+			op:          &stripHTML{},
+			in:          "  no  markup ",
+			want:        "no markup",
+		},
+		{
+			description: "stripHTML non-string",
+			op:          &stripHTML{},
+			in:          5,
+			wantErr:     true,
+		},
+		{
+			description: "stripHTML with args",
+			op:          &stripHTML{},
+			args:        map[string]string{"tags": "p"},
+			wantInitErr: true,
+		},
+		{
+			description: "sanitizeHTML defaults",
+			op:          &sanitizeHTML{},
+			in:          `<p class="x" onclick="steal()">Hi <a href="https://a.com" target="_blank">link</a><img src="a.jpg"></p><script>alert(1)</script>`,
+			want:        `<p>Hi <a href="https://a.com">link</a></p>`,
+		},
+		{
+			description: "sanitizeHTML removes unsafe urls",
+			op:          &sanitizeHTML{},
+			in:          `<a href=" javascript:alert(1)" title="t">x</a><a href="/relative">y</a>`,
+			want:        `<a title="t">x</a><a href="/relative">y</a>`,
+		},
+		{
+			description: "sanitizeHTML allowlist",
+			op:          &sanitizeHTML{},
+			args:        map[string]string{"tags": "p, img", "attributes": "src,alt"},
+			in:          `<p><span>a &lt; b</span><img src="a.jpg" alt="A" width="5"></p>`,
+			want:        `<p>a &lt; b<img src="a.jpg" alt="A"></p>`,
+		},
+		{
+			description: "sanitizeHTML script tag",
+			op:          &sanitizeHTML{},
+			args:        map[string]string{"tags": "p,script"},
+			wantInitErr: true,
+		},
+		{
+			description: "sanitizeHTML event attribute",
+			op:          &sanitizeHTML{},
+			args:        map[string]string{"attributes": "href,onload"},
+			wantInitErr: true,
+		},
+		{
+			description: "sanitizeHTML unknown arg",
+			op:          &sanitizeHTML{},
+			args:        map[string]string{"tag": "p"},
+			wantInitErr: true,
+		},
+		{
+			description: "htmlToMarkdown",
+			op:          &htmlToMarkdown{},
+			in: `<h2>Title</h2><p>Some <strong>bold</strong> and <em>italic</em> text with a <a href="https://a.com">link</a>` +
+				` and <code>code</code>.</p><ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>` +
+				`<blockquote><p>quoted</p></blockquote><pre>x := 1
+y := 2</pre><p>a_b*c<br>next<img src="a.jpg" alt="pic"></p>`,
+			want: "## Title\n\nSome **bold** and *italic* text with a [link](https://a.com) and `code`.\n\n" +
+				"- one\n- two\n\n  1. nested\n\n> quoted\n\n```\nx := 1\ny := 2\n```\n\na\\_b\\*c\nnext![pic](a.jpg)",
+		},
+		{
+			description: "htmlToMarkdown unsafe urls",
+			op:          &htmlToMarkdown{},
+			in:          `<p>A <a href=" javascript:alert(1)">link</a><img src="javascript:alert(1)" alt="pic"> here</p>`,
+			want:        "A link here",
+		},
+		{
+			description: "htmlToMarkdown url with parentheses",
+			op:          &htmlToMarkdown{},
+			in:          `<a href="https://en.wikipedia.org/wiki/Go_(language) x">Go</a><img src="a (1).jpg" alt="pic">`,
+			want:        `[Go](https://en.wikipedia.org/wiki/Go_\(language\)%20x)![pic](a%20\(1\).jpg)`,
+		},
+		{
+			description: "htmlToMarkdown line start markers",
+			op:          &htmlToMarkdown{},
+			in:          `<p># not a heading</p><p>> not a quote<br>- not a list<br>+ nor this<br>1. nor this</p><p>a - b</p>`,
+			want:        "\\# not a heading\n\n\\> not a quote\n\\- not a list\n\\+ nor this\n1\\. nor this\n\na - b",
+		},
+		{
+			description: "htmlToMarkdown non-string",
+			op:          &htmlToMarkdown{},
+			in:          []interface{}{"<p>a</p>"},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.op.Init(test.args)
+
+		switch {
+		case test.wantInitErr && err != nil:
+			continue
+		case test.wantInitErr && err == nil:
+			t.Errorf("Test %q - got init error nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
+			continue
+		}
+
+		got, err := test.op.Transform(test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestURLOperations(t *testing.T) {
+	tests := []struct {
+		description string
+		op          Operation
+		args        map[string]string
+		in          interface{}
+		want        interface{}
+		wantErr     bool
+		wantInitErr bool
+	}{
+		{description: "resolveURL relative", op: &resolveURL{}, args: map[string]string{"base": "https://a.com/images/"}, in: "b/c.jpg", want: "https://a.com/images/b/c.jpg"},
+		{description: "resolveURL root relative", op: &resolveURL{}, args: map[string]string{"base": "https://a.com/images/"}, in: "/c.jpg", want: "https://a.com/c.jpg"},
+		{description: "resolveURL protocol-less", op: &resolveURL{}, args: map[string]string{"base": "https:"}, in: " //cdn.a.com/c.jpg ", want: "https://cdn.a.com/c.jpg"},
+		{description: "resolveURL absolute", op: &resolveURL{}, args: map[string]string{"base": "https://a.com/"}, in: "http://b.com/c.jpg", want: "http://b.com/c.jpg"},
+		{description: "resolveURL basePath without a base value", op: &resolveURL{}, args: map[string]string{"basePath": "$.base"}, in: "c.jpg", want: "c.jpg"},
+		{description: "resolveURL non-string", op: &resolveURL{}, args: map[string]string{"base": "https://a.com/"}, in: 5, wantErr: true},
+		{description: "resolveURL both args", op: &resolveURL{}, args: map[string]string{"base": "https://a.com/", "basePath": "$.base"}, wantInitErr: true},
+		{description: "resolveURL no args", op: &resolveURL{}, wantInitErr: true},
+		{description: "resolveURL invalid base", op: &resolveURL{}, args: map[string]string{"base": "http://a b.com:x/"}, wantInitErr: true},
+		{description: "urlPart host", op: &urlPart{}, args: map[string]string{"part": "host"}, in: "https://www.a.com:8080/b?c=d#e", want: "www.a.com"},
+		{description: "urlPart port", op: &urlPart{}, args: map[string]string{"part": "port"}, in: "https://www.a.com:8080/b?c=d#e", want: "8080"},
+		{description: "urlPart path", op: &urlPart{}, args: map[string]string{"part": "path"}, in: "https://www.a.com/b%20c", want: "/b c"},
+		{description: "urlPart fragment", op: &urlPart{}, args: map[string]string{"part": "fragment"}, in: "https://www.a.com/b?c=d#e", want: "e"},
+		{description: "urlPart param", op: &urlPart{}, args: map[string]string{"param": "id"}, in: "https://a.com/?x=1&id=a%2Fb", want: "a/b"},
+		{description: "urlPart missing param", op: &urlPart{}, args: map[string]string{"param": "id"}, in: "https://a.com/?x=1", want: nil},
+		{description: "urlPart empty scheme", op: &urlPart{}, args: map[string]string{"part": "scheme"}, in: "//a.com/b", want: nil},
+		{description: "urlPart invalid URL", op: &urlPart{}, args: map[string]string{"part": "scheme"}, in: "http://a b.com:x/", wantErr: true},
+		{description: "urlPart unknown part", op: &urlPart{}, args: map[string]string{"part": "user"}, wantInitErr: true},
+		{description: "urlPart part and param", op: &urlPart{}, args: map[string]string{"part": "host", "param": "id"}, wantInitErr: true},
+		{description: "setQueryParam replaces", op: &setQueryParam{}, args: map[string]string{"name": "w", "value": "a b"}, in: "https://a.com/?x=1&w=2&w=3&y=4", want: "https://a.com/?x=1&w=a+b&y=4"},
+		{description: "setQueryParam adds", op: &setQueryParam{}, args: map[string]string{"name": "w", "value": "100"}, in: "https://a.com/b#c", want: "https://a.com/b?w=100#c"},
+		{description: "setQueryParam missing value", op: &setQueryParam{}, args: map[string]string{"name": "w"}, wantInitErr: true},
+		{description: "removeQueryParam", op: &removeQueryParam{}, args: map[string]string{"name": "utm_*, ref"}, in: "https://a.com/?utm_source=x&id=1&ref=y&utm_medium=z", want: "https://a.com/?id=1"},
+		{description: "removeQueryParam all", op: &removeQueryParam{}, args: map[string]string{"name": "id"}, in: "https://a.com/b?id=1", want: "https://a.com/b"},
+		{description: "removeQueryParam empty name", op: &removeQueryParam{}, args: map[string]string{"name": " , "}, wantInitErr: true},
+		{description: "normalizeURL", op: &normalizeURL{}, in: "HTTPS://WWW.A.com:443/b/./c/../d/?z=1&a=2#top", want: "https://www.a.com/b/d/?a=2&z=1"},
+		{description: "normalizeURL empty path", op: &normalizeURL{}, in: "http://a.com:8080", want: "http://a.com:8080/"},
+		{description: "normalizeURL with args", op: &normalizeURL{}, args: map[string]string{"sort": "true"}, wantInitErr: true},
+	}
+
+	for _, test := range tests {
+		err := test.op.Init(test.args)
+
+		switch {
+		case test.wantInitErr && err != nil:
+			continue
+		case test.wantInitErr && err == nil:
+			t.Errorf("Test %q - got init error nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
+			continue
+		}
+
+		got, err := test.op.Transform(test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestEncodingOperations(t *testing.T) {
+	tests := []struct {
+		description string
+		op          Operation
+		args        map[string]string
+		in          interface{}
+		want        interface{}
+		wantErr     bool
+		wantInitErr bool
+	}{
+		{description: "base64Encode", op: &base64Encode{}, in: "héllo?>", want: "aMOpbGxvPz4="},
+		{description: "base64Encode rawURL", op: &base64Encode{}, args: map[string]string{"encoding": "rawURL"}, in: "héllo?>", want: "aMOpbGxvPz4"},
+		{description: "base64Encode unknown encoding", op: &base64Encode{}, args: map[string]string{"encoding": "hex"}, wantInitErr: true},
+		{description: "base64Encode non-string", op: &base64Encode{}, in: 5, wantErr: true},
+		{description: "base64Decode", op: &base64Decode{}, in: "aMOpbGxvPz4=\n", want: "héllo?>"},
+		{description: "base64Decode url", op: &base64Decode{}, args: map[string]string{"encoding": "rawURL"}, in: "aMOpbGxvPz4", want: "héllo?>"},
+		{description: "base64Decode invalid", op: &base64Decode{}, in: "a$b=", wantErr: true},
+		{description: "base64Decode binary", op: &base64Decode{}, in: "/w==", wantErr: true},
+		{description: "urlEncode", op: &urlEncode{}, in: "a b&c/d", want: "a+b%26c%2Fd"},
+		{description: "urlEncode path", op: &urlEncode{}, args: map[string]string{"component": "path"}, in: "a b&c/d", want: "a%20b&c%2Fd"},
+		{description: "urlEncode unknown component", op: &urlEncode{}, args: map[string]string{"component": "host"}, wantInitErr: true},
+		{description: "urlDecode", op: &urlDecode{}, in: "a+b%26c%2Fd", want: "a b&c/d"},
+		{description: "urlDecode path", op: &urlDecode{}, args: map[string]string{"component": "path"}, in: "a+b%20c", want: "a+b c"},
+		{description: "urlDecode invalid", op: &urlDecode{}, in: "a%zz", wantErr: true},
+		{description: "hash sha256", op: &hashValue{}, args: map[string]string{"algorithm": "sha256"}, in: "abc", want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{description: "hash sha1 base64", op: &hashValue{}, args: map[string]string{"algorithm": "sha1", "encoding": "base64"}, in: "abc", want: "qZk+NkcGgWq6PiVxeFDCbJzQ2J0="},
+		{description: "hash md5", op: &hashValue{}, args: map[string]string{"algorithm": "md5", "encoding": "hex"}, in: "abc", want: "900150983cd24fb0d6963f7d28e17f72"},
+		{description: "hash missing algorithm", op: &hashValue{}, args: map[string]string{"encoding": "hex"}, wantInitErr: true},
+		{description: "hash unknown algorithm", op: &hashValue{}, args: map[string]string{"algorithm": "sha512"}, wantInitErr: true},
+		{description: "hash non-string", op: &hashValue{}, args: map[string]string{"algorithm": "md5"}, in: []interface{}{"abc"}, wantErr: true},
+		{description: "uuidV5 dns", op: &uuidV5{}, args: map[string]string{"namespace": "dns"}, in: "python.org", want: "886313e1-3b8a-5372-9b90-0c9aee199e5d"},
+		{description: "uuidV5 namespace uuid", op: &uuidV5{}, args: map[string]string{"namespace": "6BA7B811-9DAD-11D1-80B4-00C04FD430C8"}, in: "http://python.org/", want: "4c565f0d-3f5a-5890-b41b-20cf47701c5e"},
+		{description: "uuidV5 invalid namespace", op: &uuidV5{}, args: map[string]string{"namespace": "6ba7b811"}, wantInitErr: true},
+		{description: "mask", op: &mask{}, args: map[string]string{"keep": "4"}, in: "4111111111111111", want: "************1111"},
+		{description: "mask char", op: &mask{}, args: map[string]string{"keep": "2", "char": "•"}, in: "josé", want: "••sé"},
+		{description: "mask short", op: &mask{}, args: map[string]string{"keep": "4"}, in: "abc", want: "abc"},
+		{description: "mask all", op: &mask{}, args: map[string]string{"keep": "0"}, in: "abc", want: "***"},
+		{description: "mask negative keep", op: &mask{}, args: map[string]string{"keep": "-1"}, wantInitErr: true},
+		{description: "mask missing keep", op: &mask{}, args: map[string]string{"char": "#"}, wantInitErr: true},
+	}
+
+	for _, test := range tests {
+		err := test.op.Init(test.args)
+
+		switch {
+		case test.wantInitErr && err != nil:
+			continue
+		case test.wantInitErr && err == nil:
+			t.Errorf("Test %q - got init error nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
+			continue
+		}
+
+		got, err := test.op.Transform(test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestArrayOperations(t *testing.T) {
+	doc, err := xmlquery.Parse(strings.NewReader(`<renditions>
+		<rendition type="mp4"><bitrate>800</bitrate></rendition>
+		<rendition type="hls"><bitrate>2400</bitrate></rendition>
+		<rendition type="mp4"><bitrate>1200</bitrate></rendition>
+	</renditions>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := xmlquery.Find(doc, "//rendition")
+
+	renditions := []interface{}{
+		map[string]interface{}{"type": "mp4", "bitrate": 800},
+		map[string]interface{}{"type": "hls", "bitrate": 2400.0},
+		map[string]interface{}{"type": "mp4"},
+		map[string]interface{}{"type": "mp4", "bitrate": 1200},
+	}
+
+	tests := []struct {
+		description string
+		op          Operation
+		args        map[string]string
+		in          interface{}
+		want        interface{}
+		wantErr     bool
+		wantInitErr bool
+	}{
+		{description: "join", op: &join{}, args: map[string]string{"delimiter": ", "}, in: []interface{}{"a", 1, nil, true}, want: "a, 1, true"},
+		{description: "join single value", op: &join{}, args: map[string]string{"delimiter": ","}, in: "a", want: "a"},
+		{description: "join objects", op: &join{}, args: map[string]string{"delimiter": ","}, in: renditions, wantErr: true},
+		{description: "join missing delimiter", op: &join{}, args: map[string]string{}, wantInitErr: true},
+		{description: "join XML", op: &join{}, args: map[string]string{"delimiter": "|"}, in: nodes, want: "800|2400|1200"},
+		{description: "unique", op: &unique{}, in: []interface{}{"a", "b", "a", 1, "1"}, want: []interface{}{"a", "b", 1, "1"}},
+		{description: "unique by", op: &unique{}, args: map[string]string{"by": "@.type"}, in: renditions, want: []interface{}{renditions[0], renditions[1]}},
+		{description: "unique by XML attribute", op: &unique{}, args: map[string]string{"by": "@type"}, in: nodes, want: []*xmlquery.Node{nodes[0], nodes[1]}},
+		{description: "unique by JSONPath on XML", op: &unique{}, args: map[string]string{"by": "@.type"}, in: nodes, wantErr: true},
+		{description: "unique invalid path", op: &unique{}, args: map[string]string{"by": "@.["}, wantInitErr: true},
+		{description: "flatten", op: &flatten{}, in: []interface{}{"a", []interface{}{"b", []interface{}{"c"}}, []interface{}{}}, want: []interface{}{"a", "b", "c"}},
+		{description: "slice", op: &sliceItems{}, args: map[string]string{"start": "1", "end": "-1"}, in: []interface{}{"a", "b", "c", "d"}, want: []interface{}{"b", "c"}},
+		{description: "slice XML", op: &sliceItems{}, args: map[string]string{"start": "-1"}, in: nodes, want: []*xmlquery.Node{nodes[2]}},
+		{description: "slice missing start", op: &sliceItems{}, args: map[string]string{}, wantInitErr: true},
+		{description: "count", op: &count{}, in: []interface{}{"a", "b"}, want: 2},
+		{description: "count XML", op: &count{}, in: nodes, want: 3},
+		{description: "count args", op: &count{}, args: map[string]string{"of": "a"}, wantInitErr: true},
+		{description: "sort lexical", op: &sortItems{}, in: []interface{}{"b", "10", "a", "9"}, want: []interface{}{"10", "9", "a", "b"}},
+		{description: "sort numeric", op: &sortItems{}, args: map[string]string{"compare": "numeric"}, in: []interface{}{"10", 9, 1.5}, want: []interface{}{1.5, 9, "10"}},
+		{description: "sort numeric not a number", op: &sortItems{}, args: map[string]string{"compare": "numeric"}, in: []interface{}{"a", 9}, wantErr: true},
+		{
+			description: "sort by descending, missing last",
+			op:          &sortItems{},
+			args:        map[string]string{"by": "@.bitrate", "order": "desc", "compare": "numeric"},
+			in:          renditions,
+			want:        []interface{}{renditions[1], renditions[3], renditions[0], renditions[2]},
+		},
+		{
+			description: "sort XML",
+			op:          &sortItems{},
+			args:        map[string]string{"by": "bitrate", "compare": "numeric"},
+			in:          nodes,
+			want:        []*xmlquery.Node{nodes[0], nodes[2], nodes[1]},
+		},
+		{description: "sort invalid order", op: &sortItems{}, args: map[string]string{"order": "up"}, wantInitErr: true},
+		{description: "reverse", op: &reverse{}, in: []interface{}{"a", "b", "c"}, want: []interface{}{"c", "b", "a"}},
+		{description: "first", op: &firstItem{}, in: []interface{}{"a", "b"}, want: "a"},
+		{description: "first empty", op: &firstItem{}, in: []interface{}{}, want: nil},
+		{description: "last XML", op: &lastItem{}, in: nodes, want: nodes[2]},
+	}
+
+	for _, test := range tests {
+		err := test.op.Init(test.args)
+
+		switch {
+		case test.wantInitErr && err != nil:
+			continue
+		case test.wantInitErr && err == nil:
+			t.Errorf("Test %q - got init error nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
+			continue
+		}
+
+		original := deepCopy(test.in)
+		got, err := test.op.Transform(test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+
+		if !reflect.DeepEqual(test.in, original) {
+			t.Errorf("Test %q - input was modified, got %#v, want %#v", test.description, test.in, original)
+		}
+	}
+}
+
+func TestMapValue(t *testing.T) {
+	lookups := map[string]map[string]interface{}{"leagues": {"NFL_SCH": "nfl", "nfl_sch": "nfl"}}
+
+	tests := []struct {
+		description string
+		args        map[string]json.RawMessage
+		in          interface{}
+		want        interface{}
+		wantInitErr bool
+	}{
+		{
+			description: "Inline table",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{"1": "one", "2": {"n": 2}}`)},
+			in:          "2",
+			want:        map[string]interface{}{"n": 2.0},
+		},
+		{
+			description: "Numbers are matched as strings",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{"1": "one"}`)},
+			in:          1.0,
+			want:        "one",
+		},
+		{
+			description: "Unmatched without default",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{"1": "one"}`)},
+			in:          "3",
+			want:        nil,
+		},
+		{
+			description: "Unmatched with default",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{"1": "one"}`), "default": json.RawMessage(`"other"`)},
+			in:          "3",
+			want:        "other",
+		},
+		{
+			description: "Case insensitive",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{"NFL_SCH": "nfl"}`), "caseInsensitive": json.RawMessage(`true`)},
+			in:          "Nfl_Sch",
+			want:        "nfl",
+		},
+		{
+			description: "Case sensitive by default",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{"NFL_SCH": "nfl"}`)},
+			in:          "nfl_sch",
+			want:        nil,
+		},
+		{
+			description: "Array",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{"a": "alpha"}`), "default": json.RawMessage(`"?"`)},
+			in:          []interface{}{"a", "b"},
+			want:        []interface{}{"alpha", "?"},
+		},
+		{
+			description: "Lookup table",
+			args:        map[string]json.RawMessage{"lookup": json.RawMessage(`"leagues"`)},
+			in:          "NFL_SCH",
+			want:        "nfl",
+		},
+		{
+			description: "Unknown lookup table",
+			args:        map[string]json.RawMessage{"lookup": json.RawMessage(`"teams"`)},
+			wantInitErr: true,
+		},
+		{
+			description: "Case insensitive duplicate keys",
+			args:        map[string]json.RawMessage{"lookup": json.RawMessage(`"leagues"`), "caseInsensitive": json.RawMessage(`true`)},
+			wantInitErr: true,
+		},
+		{
+			description: "Table and lookup",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{}`), "lookup": json.RawMessage(`"leagues"`)},
+			wantInitErr: true,
+		},
+		{
+			description: "No table",
+			args:        map[string]json.RawMessage{"default": json.RawMessage(`"x"`)},
+			wantInitErr: true,
+		},
+		{
+			description: "Table isn't an object",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`["a"]`)},
+			wantInitErr: true,
+		},
+		{
+			description: "caseInsensitive isn't a boolean",
+			args:        map[string]json.RawMessage{"table": json.RawMessage(`{}`), "caseInsensitive": json.RawMessage(`"yes"`)},
+			wantInitErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		op := &mapValue{lookups: lookups}
+		err := op.InitArgs(test.args)
+
+		switch {
+		case test.wantInitErr && err != nil:
+			continue
+		case test.wantInitErr && err == nil:
+			t.Errorf("Test %q - got init error nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - got init error, want nil: %v", test.description, err)
+			continue
+		}
+
+		got, err := op.Transform(test.in)
+		switch {
+		case err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestNumericOperationsFieldType(t *testing.T) {
+	tests := []struct {
+		description string
+		fieldType   string
+		in          interface{}
+		want        interface{}
+	}{
+		{description: "whole number for integer field", fieldType: "integer", in: 3000, want: 3},
+		{description: "fraction for integer field", fieldType: "integer", in: 1500, want: 2},
+		{description: "negative fraction for integer field", fieldType: "integer", in: -1499, want: -1},
+		{description: "fraction for number field", fieldType: "number", in: 1500, want: 1.5},
+		{description: "whole number for number field", fieldType: "number", in: 3000, want: 3.0},
+	}
+
+	op := &divide{}
+	if err := op.Init(map[string]string{"by": "1000"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		got, err := op.transformField(test.in, test.fieldType)
+		if err != nil {
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
 }
@@ -0,0 +1,85 @@
+package transform
+
+import (
+	"log"
+)
+
+// ValidationMode determines how the transformed result is validated against the schema.
+type ValidationMode int
+
+const (
+	// ValidationOn validates every transformed result returning a *ValidationError for any which are invalid.
+	ValidationOn ValidationMode = iota
+	// ValidationOff skips validation of the transformed result.
+	ValidationOff
+	// ValidationLogOnly validates every transformed result but only logs validation failures, the result is still
+	// returned.
+	ValidationLogOnly
+)
+
+// Option configures a Transformer, options are passed to NewTransformerWithOptions.
+type Option func(*Transformer)
+
+// WithInputFormat sets the format of the input to the Transformer, the default is JSONInput.
+func WithInputFormat(format InputFormat) Option {
+	return func(tr *Transformer) {
+		tr.format = format
+	}
+}
+
+// WithValidation sets how the transformed result is validated against the schema, the default is ValidationOn.
+func WithValidation(mode ValidationMode) Option {
+	return func(tr *Transformer) {
+		tr.validation = mode
+	}
+}
+
+// WithLogger sets the logger used to report validation failures with ValidationLogOnly, the default is the standard
+// logger from the log package.
+func WithLogger(logger *log.Logger) Option {
+	return func(tr *Transformer) {
+		tr.logger = logger
+	}
+}
+
+// WithStrictConversion makes failures to convert a value to the type of its schema field an error.
+// By default a value which can't be converted is passed to the operations as is, or if there are none it falls back
+// to the schema default. In strict mode a value which still can't be converted after any operations are run causes
+// the transform to fail.
+func WithStrictConversion() Option {
+	return func(tr *Transformer) {
+		tr.strict = true
+	}
+}
+
+// WithIndent makes the Transformer output indented JSON, the prefix and indent are used as with json.MarshalIndent.
+func WithIndent(prefix, indent string) Option {
+	return func(tr *Transformer) {
+		tr.indentPrefix = prefix
+		tr.indent = indent
+	}
+}
+
+// WithOperations sets the registry used to look up the operations in the transform sections of the schema, allowing
+// operations to be added or overridden for this Transformer only.
+func WithOperations(operations *OperationRegistry) Option {
+	return func(tr *Transformer) {
+		tr.operations = operations
+	}
+}
+
+// WithLimits sets the Limits enforced on each transform, by default there are no limits.
+func WithLimits(limits Limits) Option {
+	return func(tr *Transformer) {
+		tr.limits = limits
+	}
+}
+
+// WithLookupFiles sets the lookup tables available to the map operation by name, each file is a JSON object of input
+// value to output value and is read when the Transformer is built. A map operation replaced using WithOperations or
+// RegisterOperation is used as is without the lookup tables.
+func WithLookupFiles(files map[string]string) Option {
+	return func(tr *Transformer) {
+		tr.lookupFiles = files
+	}
+}
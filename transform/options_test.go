@@ -0,0 +1,130 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewTransformerWithOptions(t *testing.T) {
+	validInput := json.RawMessage(`{"type": "image", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": 2}], "publishUrl": "publish", "absoluteUrl": "absolute"}`)
+	invalidInput := json.RawMessage(`{"type": "video", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": 2}], "publishUrl": "publish", "absoluteUrl": "absolute"}`)
+	unconvertibleInput := json.RawMessage(`{"type": "image", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": "wide"}], "publishUrl": "publish", "absoluteUrl": "absolute"}`)
+
+	tests := []struct {
+		description string
+		options     []Option
+		in          json.RawMessage
+		want        json.RawMessage
+		wantErr     bool
+		wantLog     string
+	}{
+		{
+			description: "Defaults",
+			in:          validInput,
+			want:        json.RawMessage(`{"URL":{"absolute":"absolute","publish":"publish"},"crops":[{"height":1,"name":"name","path":"path","relativePath":"","width":2}],"type":"image"}`),
+		},
+		{
+			description: "Indented output",
+			options:     []Option{WithIndent("", "  ")},
+			in:          validInput,
+			want: json.RawMessage(`{
+  "URL": {
+    "absolute": "absolute",
+    "publish": "publish"
+  },
+  "crops": [
+    {
+      "height": 1,
+      "name": "name",
+      "path": "path",
+      "relativePath": "",
+      "width": 2
+    }
+  ],
+  "type": "image"
+}`),
+		},
+		{
+			description: "Validation on, invalid output",
+			in:          invalidInput,
+			wantErr:     true,
+		},
+		{
+			description: "Validation off, invalid output",
+			options:     []Option{WithValidation(ValidationOff)},
+			in:          invalidInput,
+			want:        json.RawMessage(`{"URL":{"absolute":"absolute","publish":"publish"},"crops":[{"height":1,"name":"name","path":"path","relativePath":"","width":2}],"type":"video"}`),
+		},
+		{
+			description: "Validation log only, invalid output",
+			options:     []Option{WithValidation(ValidationLogOnly)},
+			in:          invalidInput,
+			want:        json.RawMessage(`{"URL":{"absolute":"absolute","publish":"publish"},"crops":[{"height":1,"name":"name","path":"path","relativePath":"","width":2}],"type":"video"}`),
+			wantLog:     "/type (from $.type)",
+		},
+		{
+			description: "Non-strict conversion falls back",
+			options:     []Option{WithValidation(ValidationOff)},
+			in:          unconvertibleInput,
+			want:        json.RawMessage(`{"URL":{"absolute":"absolute","publish":"publish"},"crops":[{"height":1,"name":"name","path":"path","relativePath":""}],"type":"image"}`),
+		},
+		{
+			description: "Strict conversion error",
+			options:     []Option{WithValidation(ValidationOff), WithStrictConversion()},
+			in:          unconvertibleInput,
+			wantErr:     true,
+		},
+		{
+			description: "Strict conversion, valid input",
+			options:     []Option{WithStrictConversion()},
+			in:          validInput,
+			want:        json.RawMessage(`{"URL":{"absolute":"absolute","publish":"publish"},"crops":[{"height":1,"name":"name","path":"path","relativePath":"","width":2}],"type":"image"}`),
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		options := append([]Option{WithLogger(log.New(&buf, "", 0))}, test.options...)
+		tr, err := NewTransformerWithOptions(imageSchema, "cumulo", options...)
+		if err != nil {
+			t.Fatalf("Test %q - failed to initialize transformer: %v", test.description, err)
+		}
+
+		got, err := tr.Transform(test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got\n%s\nwant\n%s", test.description, got, test.want)
+		}
+
+		if test.wantLog == "" && buf.Len() != 0 {
+			t.Errorf("Test %q - got log %q, want none", test.description, buf.String())
+		}
+		if !strings.Contains(buf.String(), test.wantLog) {
+			t.Errorf("Test %q - got log %q, want it to contain %q", test.description, buf.String(), test.wantLog)
+		}
+	}
+}
+
+func TestNewTransformerWithOptionsFormat(t *testing.T) {
+	tr, err := NewTransformerWithOptions(imageSchema, "cumulo", WithInputFormat(XMLInput))
+	if err != nil {
+		t.Fatalf("failed to initialize transformer: %v", err)
+	}
+	if tr.format != XMLInput {
+		t.Errorf("got format %q, want %q", tr.format, XMLInput)
+	}
+
+	if _, err := NewTransformerWithOptions(imageSchema, "cumulo", WithInputFormat("YAML")); err == nil {
+		t.Error("got nil, want error for unsupported input format")
+	}
+}
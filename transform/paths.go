@@ -0,0 +1,497 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode/utf8"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/antchfx/xmlquery"
+)
+
+// indexPlaceholder marks the index of an enclosing array within a compiled JSONPath, ie `$.a[§0].b[§1]` selects the
+// current item of the outer array from a and of the inner array from b.
+const indexPlaceholder = '§'
+
+// pathLanguage is JSONPath extended with the index placeholders.
+var pathLanguage = gval.NewLanguage(
+	jsonpath.Language(),
+	gval.PrefixExtension(indexPlaceholder, parseIndexPlaceholder),
+)
+
+// indexesKey is the context key for the current array indexes when evaluating a compiled JSONPath.
+type indexesKey struct{}
+
+// parseIndexPlaceholder parses the number following an index placeholder into an evaluable returning that array index.
+// The index is a float64, as are the numbers of JSON input, so it compares equal to them in a filter.
+func parseIndexPlaceholder(c context.Context, p *gval.Parser) (gval.Evaluable, error) {
+	if p.Scan() != scanner.Int {
+		return nil, p.Expected("array index placeholder", scanner.Int)
+	}
+	level, err := strconv.Atoi(p.TokenText())
+	if err != nil {
+		return nil, err
+	}
+	return func(c context.Context, _ interface{}) (interface{}, error) {
+		indexes, _ := c.Value(indexesKey{}).([]int)
+		if level >= len(indexes) {
+			return nil, fmt.Errorf("no index bound for array level %d", level)
+		}
+		return float64(indexes[level]), nil
+	}, nil
+}
+
+// exprLanguage is the language of the expr of a from instruction, the gval full language with JSONPaths, the index
+// placeholders and functions on strings and numbers. With XML input the function xpath returns the text of the first
+// node matching an XPath, it is provided by the parameter the expression is evaluated with.
+var exprLanguage = gval.Full(
+	jsonpath.Language(),
+	gval.PrefixExtension(indexPlaceholder, parseIndexPlaceholder),
+	exprStringFunction("lower", strings.ToLower),
+	exprStringFunction("upper", strings.ToUpper),
+	exprStringFunction("trim", strings.TrimSpace),
+	exprNumberFunction("round", func(f float64) float64 { return math.Round(f) }),
+	exprNumberFunction("floor", math.Floor),
+	exprNumberFunction("ceil", math.Ceil),
+	exprNumberFunction("abs", math.Abs),
+	gval.Function("len", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.New("len() expects 1 argument")
+		}
+		switch v := args[0].(type) {
+		case string:
+			return float64(utf8.RuneCountInString(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("len() expects a string, array or object not %T", args[0])
+	}),
+	gval.Function("contains", exprStringTest("contains", strings.Contains)),
+	gval.Function("hasPrefix", exprStringTest("hasPrefix", strings.HasPrefix)),
+	gval.Function("hasSuffix", exprStringTest("hasSuffix", strings.HasSuffix)),
+	gval.Function("replace", func(args ...interface{}) (interface{}, error) {
+		strs, err := exprStrings("replace", 3, args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Replace(strs[0], strs[1], strs[2], -1), nil
+	}),
+	gval.Function("join", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errors.New("join() expects 2 arguments")
+		}
+		items, ok := args[0].([]interface{})
+		if !ok {
+			items = []interface{}{args[0]}
+		}
+		strs, err := exprStrings("join", len(items)+1, append(items, args[1]))
+		if err != nil {
+			return nil, err
+		}
+		return strings.Join(strs[:len(items)], strs[len(items)]), nil
+	}),
+	gval.Function("min", exprNumbersFunction("min", math.Min)),
+	gval.Function("max", exprNumbersFunction("max", math.Max)),
+	gval.Function("string", func(args ...interface{}) (interface{}, error) {
+		strs, err := exprStrings("string", 1, args)
+		if err != nil {
+			return nil, err
+		}
+		return strs[0], nil
+	}),
+	gval.Function("number", func(args ...interface{}) (interface{}, error) {
+		nums, err := exprNumbers("number", 1, args)
+		if err != nil {
+			return nil, err
+		}
+		return nums[0], nil
+	}),
+)
+
+// exprStringFunction returns a function of the expression language applying f to a string argument.
+func exprStringFunction(name string, f func(string) string) gval.Language {
+	return gval.Function(name, func(args ...interface{}) (interface{}, error) {
+		strs, err := exprStrings(name, 1, args)
+		if err != nil {
+			return nil, err
+		}
+		return f(strs[0]), nil
+	})
+}
+
+// exprStringTest returns a function of the expression language reporting whether f is true for two string arguments.
+func exprStringTest(name string, f func(s, substr string) bool) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		strs, err := exprStrings(name, 2, args)
+		if err != nil {
+			return nil, err
+		}
+		return f(strs[0], strs[1]), nil
+	}
+}
+
+// exprNumberFunction returns a function of the expression language applying f to a number argument.
+func exprNumberFunction(name string, f func(float64) float64) gval.Language {
+	return gval.Function(name, func(args ...interface{}) (interface{}, error) {
+		nums, err := exprNumbers(name, 1, args)
+		if err != nil {
+			return nil, err
+		}
+		return f(nums[0]), nil
+	})
+}
+
+// exprNumbersFunction returns a function of the expression language reducing one or more number arguments with f.
+func exprNumbersFunction(name string, f func(a, b float64) float64) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) == 1 {
+			if items, ok := args[0].([]interface{}); ok {
+				args = items
+			}
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s() expects at least 1 number", name)
+		}
+		nums, err := exprNumbers(name, len(args), args)
+		if err != nil {
+			return nil, err
+		}
+		result := nums[0]
+		for _, num := range nums[1:] {
+			result = f(result, num)
+		}
+		return result, nil
+	}
+}
+
+// exprStrings converts the arguments of the named function to strings, there must be count arguments.
+func exprStrings(name string, count int, args []interface{}) ([]string, error) {
+	if len(args) != count {
+		return nil, fmt.Errorf("%s() expects %d arguments", name, count)
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, err := convertString(arg)
+		if err != nil || str == nil {
+			return nil, fmt.Errorf("%s() argument %d is not a string: %v", name, i+1, arg)
+		}
+		strs[i] = str.(string)
+	}
+	return strs, nil
+}
+
+// exprNumbers converts the arguments of the named function to numbers, there must be count arguments.
+func exprNumbers(name string, count int, args []interface{}) ([]float64, error) {
+	if len(args) != count {
+		return nil, fmt.Errorf("%s() expects %d arguments", name, count)
+	}
+	nums := make([]float64, len(args))
+	for i, arg := range args {
+		num, err := convertNumber(arg)
+		f, ok := numberValue(num)
+		if err != nil || !ok {
+			return nil, fmt.Errorf("%s() argument %d is not a number: %v", name, i+1, arg)
+		}
+		nums[i] = f
+	}
+	return nums, nil
+}
+
+// compileExpr compiles the expr used within the schema instance at instancePath. As with compileJSONPath each `[*]`
+// of an enclosing array in the paths of the expression is bound to the index of the current item.
+func compileExpr(expr, instancePath string) (*compiledPath, error) {
+	template, indexed := bindIndexes(expr, instancePath, -1)
+	eval, err := exprLanguage.NewEvaluable(template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile expr %q: %v", expr, err)
+	}
+	return &compiledPath{template: template, eval: eval, indexed: indexed}, nil
+}
+
+// exprParameter returns the parameter an expression is evaluated with for the input. For XML input it provides the
+// xpath function evaluated relative to the node.
+func exprParameter(in interface{}, indexes []int, state *transformState) interface{} {
+	node, ok := in.(*xmlquery.Node)
+	if !ok {
+		return in
+	}
+	return map[string]interface{}{
+		"xpath": func(path string) interface{} {
+			found := findOneXML(node, path, indexes, state)
+			if found == nil {
+				return nil
+			}
+			return found.InnerText()
+		},
+	}
+}
+
+// replaceExprPathPrefix replaces old with new at the start of each path in the expression, ie the relative `@.` of
+// a path within an array, leaving those in strings and in the filters of other paths.
+func replaceExprPathPrefix(expr, old, new string) string {
+	return replaceInExpr(expr, old, new, false)
+}
+
+// replacePathAnchor replaces each use of the path anchor in the JSONPath or expression with new, including those in
+// filters but not in strings.
+func replacePathAnchor(expr, anchor, new string) string {
+	return replaceInExpr(expr, anchor, new, true)
+}
+
+// replaceInExpr replaces old with new where it starts a path in the expression, outside of strings and, unless
+// inFilters is set, brackets. An old ending with an identifier must also not be followed by one, so `@index` doesn't
+// match the start of `@indexes`.
+func replaceInExpr(expr, old, new string, inFilters bool) string {
+	var (
+		replaced strings.Builder
+		quote    byte
+		escaped  bool
+		depth    int
+	)
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case (depth == 0 || inFilters) && strings.HasPrefix(expr[i:], old) && (i == 0 || !isIdentByte(expr[i-1])) &&
+			(!isIdentByte(old[len(old)-1]) || i+len(old) == len(expr) || !isIdentByte(expr[i+len(old)])):
+			replaced.WriteString(new)
+			i += len(old) - 1
+			continue
+		}
+		replaced.WriteByte(c)
+	}
+	return replaced.String()
+}
+
+// The path anchors start a path within an array which isn't relative to the current item. @root is the input,
+// @parent is the item of the enclosing array, or the input for an item of a top level array, and @index is the index
+// of the current item. @parent can be followed by another anchor, ie `@parent.@index` is the index of the parent item.
+const (
+	rootAnchor   = "@root"
+	parentAnchor = "@parent"
+	indexAnchor  = "@index"
+)
+
+// anchorReplacement is the JSONPath taking the place of a path anchor.
+type anchorReplacement struct {
+	anchor string
+	path   string
+}
+
+// jsonPathAnchors returns the replacements of the path anchors for the JSONPaths of the instructions of the instance
+// whose parent is at parentPath, in the order they are to be replaced. The index of an item is the placeholder bound
+// to it. Anchors beyond the enclosing arrays have no replacement so a path using them fails to compile.
+func jsonPathAnchors(parentPath string) []anchorReplacement {
+	level := strings.Count(parentPath, "[*]") - 1
+	items := []string{parentPath}
+	for item := parentPath; ; {
+		i := strings.LastIndex(item, "[*]")
+		if i == -1 {
+			break
+		}
+		item = item[:i]
+		if j := strings.LastIndex(item, "."); j != -1 && !strings.HasSuffix(item, "]") {
+			item = item[:j]
+		}
+		items = append(items, item)
+	}
+
+	var replacements []anchorReplacement
+	for up := len(items) - 1; up > 0; up-- {
+		prefix := strings.Repeat(parentAnchor+".", up)
+		if level-up >= 0 {
+			replacements = append(replacements, anchorReplacement{
+				anchor: prefix + indexAnchor,
+				path:   string(indexPlaceholder) + strconv.Itoa(level-up),
+			})
+		}
+		replacements = append(replacements, anchorReplacement{anchor: strings.TrimSuffix(prefix, "."), path: items[up]})
+	}
+	if level >= 0 {
+		replacements = append(replacements, anchorReplacement{
+			anchor: indexAnchor,
+			path:   string(indexPlaceholder) + strconv.Itoa(level),
+		})
+	}
+	return append(replacements, anchorReplacement{anchor: rootAnchor, path: "$"})
+}
+
+// xpathAnchor resolves the path anchors at the start of an XPath from the node, returning the node the rest of the
+// path is relative to and the rest of the path. The parent items are those recorded by the state and the index is
+// given as a text node. The node is nil if an anchor doesn't apply, ie @parent of the input.
+func xpathAnchor(node *xmlquery.Node, path string, indexes []int, state *transformState) (*xmlquery.Node, string) {
+	level := len(indexes) - 1
+	for node != nil {
+		var anchor string
+		for _, a := range []string{rootAnchor, parentAnchor, indexAnchor} {
+			if strings.HasPrefix(path, a) && (len(path) == len(a) || path[len(a)] == '/') {
+				anchor = a
+				break
+			}
+		}
+
+		switch anchor {
+		case "":
+			return node, path
+		case rootAnchor:
+			for node.Parent != nil {
+				node = node.Parent
+			}
+		case parentAnchor:
+			node = state.xmlParent(node)
+			level--
+		case indexAnchor:
+			if level < 0 {
+				return nil, ""
+			}
+			node = &xmlquery.Node{Type: xmlquery.TextNode, Data: strconv.Itoa(indexes[level])}
+		}
+
+		switch path = path[len(anchor):]; {
+		case path == "":
+			path = "."
+		case strings.HasPrefix(path, "//"):
+			// a descendant of the anchor rather than of the document
+			path = "." + path
+		default:
+			path = path[1:]
+		}
+	}
+	return nil, ""
+}
+
+// findXML returns the nodes matching the XPath, which may start with path anchors, relative to the node.
+func findXML(node *xmlquery.Node, path string, indexes []int, state *transformState) []*xmlquery.Node {
+	node, path = xpathAnchor(node, path, indexes, state)
+	if node == nil {
+		return nil
+	}
+	return xmlquery.Find(node, path)
+}
+
+// findOneXML returns the first node matching the XPath, which may start with path anchors, relative to the node.
+func findOneXML(node *xmlquery.Node, path string, indexes []int, state *transformState) *xmlquery.Node {
+	node, path = xpathAnchor(node, path, indexes, state)
+	if node == nil {
+		return nil
+	}
+	return xmlquery.FindOne(node, path)
+}
+
+// isIdentByte reports whether c can be part of an identifier.
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// compiledPath is a JSONPath parsed once when the Transformer is built.
+// The `[*]` selecting the items of each enclosing array instance is replaced by a placeholder which is bound to the
+// index of the current item when the path is evaluated, this takes the place of building a new path string for
+// every array item.
+type compiledPath struct {
+	// template is the path with the index placeholders.
+	template string
+	eval     gval.Evaluable
+	indexed  bool
+}
+
+// compileJSONPath compiles the JSONPath used within the schema instance at instancePath.
+// Each `[*]` in the instancePath is an enclosing array, the first match of each of those arrays with the `[*]`
+// in the path is bound to the index of the current item of that array. A path matching none of the enclosing arrays
+// selects the same values for all items.
+func compileJSONPath(path, instancePath string) (*compiledPath, error) {
+	template, indexed := bindIndexes(path, instancePath, 1)
+	eval, err := pathLanguage.NewEvaluable(template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile JSONPath %q: %v", path, err)
+	}
+	return &compiledPath{template: template, eval: eval, indexed: indexed}, nil
+}
+
+// bindIndexes replaces the `[*]` of each enclosing array of the instance at instancePath in up to n occurrences in
+// the path with the index placeholder for that array, n < 0 replaces all occurrences. It returns the new path and
+// whether it has any placeholder.
+func bindIndexes(path, instancePath string, n int) (string, bool) {
+	for level := 0; ; level++ {
+		i := strings.Index(instancePath, "[*]")
+		if i == -1 {
+			// the path may also have placeholders from the path anchors
+			return path, strings.ContainsRune(path, indexPlaceholder)
+		}
+		placeholder := "[" + string(indexPlaceholder) + strconv.Itoa(level) + "]"
+		array := instancePath[:i+len("[*]")]
+		if strings.Contains(path, array) {
+			path = strings.Replace(path, array, instancePath[:i]+placeholder, n)
+		}
+		instancePath = instancePath[:i] + placeholder + instancePath[i+len("[*]"):]
+	}
+}
+
+// get evaluates the path against the input with the given array indexes, outermost array first.
+func (p *compiledPath) get(in interface{}, indexes []int) (interface{}, error) {
+	if p == nil {
+		return nil, errors.New("no JSONPath to evaluate")
+	}
+	c := context.Background()
+	if p.indexed {
+		c = context.WithValue(c, indexesKey{}, indexes)
+	}
+	return p.eval(c, in)
+}
+
+// render returns the path with the placeholders replaced by the given array indexes, a placeholder without an index
+// is replaced by `*`.
+func (p *compiledPath) render(indexes []int) string {
+	if p == nil {
+		return ""
+	}
+	if !p.indexed {
+		return p.template
+	}
+
+	var rendered strings.Builder
+	rest := p.template
+	for {
+		i := strings.IndexRune(rest, indexPlaceholder)
+		if i == -1 {
+			rendered.WriteString(rest)
+			return rendered.String()
+		}
+		rendered.WriteString(rest[:i])
+		rest = rest[i+len(string(indexPlaceholder)):]
+
+		// the placeholder is followed by the level digits, in a filter or expression it isn't followed by a `]`
+		end := 0
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+		level, err := strconv.Atoi(rest[:end])
+		if err != nil || level >= len(indexes) {
+			rendered.WriteString("*")
+		} else {
+			rendered.WriteString(strconv.Itoa(indexes[level]))
+		}
+		rest = rest[end:]
+	}
+}
@@ -0,0 +1,469 @@
+package transform
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/antchfx/xmlquery"
+)
+
+func TestCompileJSONPath(t *testing.T) {
+	in := map[string]interface{}{
+		"a": []interface{}{
+			map[string]interface{}{"b": []interface{}{"a0b0", "a0b1"}, "c": "a0c"},
+			map[string]interface{}{"b": []interface{}{"a1b0"}, "c": "a1c"},
+		},
+		"d": []interface{}{"d0", "d1"},
+	}
+
+	tests := []struct {
+		description  string
+		path         string
+		instancePath string
+		indexes      []int
+		wantTemplate string
+		wantRendered string
+		want         interface{}
+		wantErr      bool
+	}{
+		{
+			description:  "No arrays",
+			path:         "$.d",
+			instancePath: "$.x",
+			wantTemplate: "$.d",
+			wantRendered: "$.d",
+			want:         []interface{}{"d0", "d1"},
+		},
+		{
+			description:  "Array index bound",
+			path:         "$.a[*].c",
+			instancePath: "$.a[*].y",
+			indexes:      []int{1},
+			wantTemplate: "$.a[§0].c",
+			wantRendered: "$.a[1].c",
+			want:         "a1c",
+		},
+		{
+			description:  "Nested array indexes bound",
+			path:         "$.a[*].b[*]",
+			instancePath: "$.a[*].b[*]",
+			indexes:      []int{0, 1},
+			wantTemplate: "$.a[§0].b[§1]",
+			wantRendered: "$.a[0].b[1]",
+			want:         "a0b1",
+		},
+		{
+			description:  "Path outside the enclosing arrays is not bound",
+			path:         "$.d[*]",
+			instancePath: "$.a[*].y",
+			indexes:      []int{1},
+			wantTemplate: "$.d[*]",
+			wantRendered: "$.d[*]",
+			want:         []interface{}{"d0", "d1"},
+		},
+		{
+			description:  "Missing index",
+			path:         "$.a[*].c",
+			instancePath: "$.a[*].y",
+			wantTemplate: "$.a[§0].c",
+			wantRendered: "$.a[*].c",
+			wantErr:      true,
+		},
+		{
+			description:  "Invalid path",
+			path:         "$.a[",
+			instancePath: "$.a",
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		compiled, err := compileJSONPath(test.path, test.instancePath)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+			}
+			continue
+		}
+		if compiled.template != test.wantTemplate {
+			t.Errorf("Test %q - got template %q, want %q", test.description, compiled.template, test.wantTemplate)
+		}
+		if got := compiled.render(test.indexes); got != test.wantRendered {
+			t.Errorf("Test %q - got rendered %q, want %q", test.description, got, test.wantRendered)
+		}
+
+		got, err := compiled.get(in, test.indexes)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestCompileExpr(t *testing.T) {
+	in := map[string]interface{}{
+		"a": []interface{}{
+			map[string]interface{}{"w": 1920.0, "h": 1080.0, "name": " First "},
+			map[string]interface{}{"w": 800.0, "h": 0.0, "name": "second"},
+		},
+		"first": "Jane",
+		"last":  "Doe",
+		"tags":  []interface{}{"a", "b"},
+		"count": "12",
+	}
+
+	tests := []struct {
+		description  string
+		expr         string
+		instancePath string
+		indexes      []int
+		wantTemplate string
+		want         interface{}
+		wantErr      bool
+	}{
+		{
+			description:  "Arithmetic with bound indexes",
+			expr:         "$.a[*].w / $.a[*].h",
+			instancePath: "$.a[*].ratio",
+			indexes:      []int{0},
+			wantTemplate: "$.a[§0].w / $.a[§0].h",
+			want:         1920.0 / 1080.0,
+		},
+		{
+			description:  "String concatenation",
+			expr:         `$.first + " " + $.last`,
+			instancePath: "$.name",
+			wantTemplate: `$.first + " " + $.last`,
+			want:         "Jane Doe",
+		},
+		{
+			description:  "Ternary and comparison",
+			expr:         `$.a[*].h > 0 ? "landscape" : "unknown"`,
+			instancePath: "$.a[*].shape",
+			indexes:      []int{1},
+			wantTemplate: `$.a[§0].h > 0 ? "landscape" : "unknown"`,
+			want:         "unknown",
+		},
+		{
+			description:  "String functions",
+			expr:         `upper(trim($.a[*].name)) + join($.tags, "|") + string(len($.tags))`,
+			instancePath: "$.a[*].label",
+			indexes:      []int{0},
+			wantTemplate: `upper(trim($.a[§0].name)) + join($.tags, "|") + string(len($.tags))`,
+			want:         "FIRSTa|b2",
+		},
+		{
+			description:  "Number functions",
+			expr:         "max(round($.a[*].w / 3), number($.count)) + abs(-1)",
+			instancePath: "$.a[*].size",
+			indexes:      []int{1},
+			wantTemplate: "max(round($.a[§0].w / 3), number($.count)) + abs(-1)",
+			want:         268.0,
+		},
+		{
+			description:  "Missing path",
+			expr:         "$.missing + 1",
+			instancePath: "$.x",
+			wantTemplate: "$.missing + 1",
+			wantErr:      true,
+		},
+		{
+			description:  "Function argument of the wrong type",
+			expr:         "round($.tags)",
+			instancePath: "$.x",
+			wantTemplate: "round($.tags)",
+			wantErr:      true,
+		},
+		{
+			description:  "Invalid expr",
+			expr:         "$.first +",
+			instancePath: "$.x",
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		compiled, err := compileExpr(test.expr, test.instancePath)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+			}
+			continue
+		}
+		if compiled.template != test.wantTemplate {
+			t.Errorf("Test %q - got template %q, want %q", test.description, compiled.template, test.wantTemplate)
+		}
+
+		got, err := compiled.get(in, test.indexes)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestReplaceExprPathPrefix(t *testing.T) {
+	tests := []struct {
+		description string
+		expr        string
+		want        string
+	}{
+		{description: "Relative paths", expr: "@.w / @.h", want: "$.a[*].w / $.a[*].h"},
+		{description: "Strings are unchanged", expr: `@.name + "@.name"`, want: `$.a[*].name + "@.name"`},
+		{description: "Filters are unchanged", expr: `len($.b[?(@.c == 1)]) + (@.d)`, want: `len($.b[?(@.c == 1)]) + ($.a[*].d)`},
+		{description: "Escaped quote", expr: `"\"@.x" + @.y`, want: `"\"@.x" + $.a[*].y`},
+	}
+
+	for _, test := range tests {
+		if got := replaceExprPathPrefix(test.expr, "@.", "$.a[*]."); got != test.want {
+			t.Errorf("Test %q - got %q, want %q", test.description, got, test.want)
+		}
+	}
+}
+
+func TestJSONPathAnchors(t *testing.T) {
+	in := map[string]interface{}{
+		"label": "root",
+		"a": []interface{}{
+			map[string]interface{}{"name": "a0", "b": []interface{}{map[string]interface{}{"name": "a0b0"}}},
+			map[string]interface{}{"name": "a1", "b": []interface{}{
+				map[string]interface{}{"name": "a1b0"},
+				map[string]interface{}{"name": "a1b1", "c": []interface{}{map[string]interface{}{"name": "a1b1c0"}}},
+			}},
+		},
+		"other": []interface{}{"x", "y"},
+	}
+
+	tests := []struct {
+		description  string
+		instancePath string
+		path         string
+		expr         bool
+		indexes      []int
+		wantRendered string
+		want         interface{}
+		wantErr      bool
+	}{
+		{
+			description:  "Root outside an array",
+			instancePath: "$.field",
+			path:         "@root.label",
+			want:         "root",
+		},
+		{
+			description:  "Root in a nested array",
+			instancePath: "$.a[*].b[*].field",
+			path:         "@root.label",
+			indexes:      []int{1, 1},
+			want:         "root",
+		},
+		{
+			description:  "Index",
+			instancePath: "$.a[*].b[*].field",
+			path:         "@index",
+			indexes:      []int{1, 1},
+			want:         1.0,
+		},
+		{
+			description:  "Index in a filter",
+			instancePath: "$.a[*].field",
+			path:         "$.other[@index]",
+			indexes:      []int{1},
+			want:         "y",
+		},
+		{
+			description:  "Index in a filter expression",
+			instancePath: "$.a[*].field",
+			path:         "$.a[?(@index == 1)].name",
+			indexes:      []int{1},
+			wantRendered: "$.a[?(1 == 1)].name",
+			want:         []interface{}{"a0", "a1"},
+		},
+		{
+			description:  "Index in an expr",
+			instancePath: "$.a[*].b[*].field",
+			path:         "@parent.@index + @index * 10",
+			expr:         true,
+			indexes:      []int{1, 1},
+			wantRendered: "1 + 1 * 10",
+			want:         11.0,
+		},
+		{
+			description:  "Parent of an item in a top level array",
+			instancePath: "$.a[*].field",
+			path:         "@parent.label",
+			indexes:      []int{0},
+			want:         "root",
+		},
+		{
+			description:  "Parent",
+			instancePath: "$.a[*].b[*].field",
+			path:         "@parent.name",
+			indexes:      []int{1, 0},
+			want:         "a1",
+		},
+		{
+			description:  "Parent index",
+			instancePath: "$.a[*].b[*].field",
+			path:         "@parent.@index",
+			indexes:      []int{1, 0},
+			want:         1.0,
+		},
+		{
+			description:  "Parent of the parent",
+			instancePath: "$.a[*].b[*].c[*].field",
+			path:         "@parent.@parent.name",
+			indexes:      []int{1, 1, 0},
+			want:         "a1",
+		},
+		{
+			description:  "Parent of an array",
+			instancePath: "$.a[*].b[*]",
+			path:         "@parent.label",
+			indexes:      []int{1},
+			want:         "root",
+		},
+		{
+			description:  "Index outside an array",
+			instancePath: "$.field",
+			path:         "@index",
+			wantErr:      true,
+		},
+		{
+			description:  "Parent beyond the input",
+			instancePath: "$.a[*].field",
+			path:         "@parent.@parent.name",
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		splits := strings.Split(test.instancePath, ".")
+		path := test.path
+		for _, replacement := range jsonPathAnchors(strings.Join(splits[:len(splits)-1], ".")) {
+			path = replacePathAnchor(path, replacement.anchor, replacement.path)
+		}
+
+		var (
+			got      interface{}
+			compiled *compiledPath
+			err      error
+		)
+		if test.expr {
+			compiled, err = compileExpr(path, test.instancePath)
+		} else {
+			compiled, err = compileJSONPath(path, test.instancePath)
+		}
+		if err == nil {
+			if test.wantRendered != "" && compiled.render(test.indexes) != test.wantRendered {
+				t.Errorf("Test %q - got rendered %q, want %q", test.description, compiled.render(test.indexes), test.wantRendered)
+			}
+			got, err = compiled.get(in, test.indexes)
+		}
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %v, want %v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestXPathAnchors(t *testing.T) {
+	doc, err := xmlquery.Parse(strings.NewReader(`<feed><label>root</label><a><name>a0</name><b><name>a0b0</name></b><b><name>a0b1</name></b></a></feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := xmlquery.FindOne(doc, "//a")
+	b := xmlquery.Find(a, "b")[1]
+	state := &transformState{}
+	state.recordXMLParent(a, doc)
+	state.recordXMLParent(b, a)
+
+	tests := []struct {
+		description string
+		path        string
+		want        string
+	}{
+		{description: "No anchor", path: "name", want: "a0b1"},
+		{description: "Root", path: "@root/feed/label", want: "root"},
+		{description: "Root descendant", path: "@root//label", want: "root"},
+		{description: "Index", path: "@index", want: "1"},
+		{description: "Parent", path: "@parent/name", want: "a0"},
+		{description: "Parent descendant", path: "@parent//b/name", want: "a0b0"},
+		{description: "Parent index", path: "@parent/@index", want: "0"},
+		{description: "Parent of the parent", path: "@parent/@parent/feed/label", want: "root"},
+		{description: "Parent beyond the input", path: "@parent/@parent/@parent", want: ""},
+	}
+
+	for _, test := range tests {
+		var got string
+		if found := findOneXML(b, test.path, []int{0, 1}, state); found != nil {
+			got = found.InnerText()
+		}
+		if got != test.want {
+			t.Errorf("Test %q - got %q, want %q", test.description, got, test.want)
+		}
+	}
+}
+
+// BenchmarkJSONPath compares parsing the JSONPath on every use, with the array index substituted in the path string,
+// to evaluating a compiled path with the index bound.
+func BenchmarkJSONPath(b *testing.B) {
+	in := map[string]interface{}{
+		"a": []interface{}{
+			map[string]interface{}{"b": map[string]interface{}{"c": "value"}},
+			map[string]interface{}{"b": map[string]interface{}{"c": "value"}},
+		},
+	}
+
+	b.Run("parsed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := jsonpath.Get(pathReplaceIndex("$.a[*].b.c", "$.a[*]", i%2), in); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("compiled", func(b *testing.B) {
+		compiled, err := compileJSONPath("$.a[*].b.c", "$.a[*].b.c")
+		if err != nil {
+			b.Fatal(err)
+		}
+		indexes := make([]int, 1)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			indexes[0] = i % 2
+			if _, err := compiled.get(in, indexes); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// pathReplaceIndex substitutes the index into the path as was done before paths were compiled.
+func pathReplaceIndex(path, array string, index int) string {
+	return strings.Replace(path, array, strings.TrimSuffix(array, "[*]")+"["+strconv.Itoa(index)+"]", 1)
+}
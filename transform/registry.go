@@ -0,0 +1,228 @@
+package transform
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// transformSchema is the JSON schema for the transform sections, its definitions/operations section describes the
+// built-in operations.
+//
+//go:embed transformSchema.json
+var transformSchema []byte
+
+// operations is the registry used by RegisterOperation and by any Transformer not given its own registry.
+var operations = newBuiltinRegistry()
+
+// SchemaDefiner can optionally be implemented by an Operation to describe the JSON schema for its entry in the
+// definitions/operations section of transformSchema.json. The definition should validate the whole operation object,
+// ie both the "type" and the "args". The built-in operations are described by transformSchema.json itself.
+type SchemaDefiner interface {
+	SchemaDefinition() json.RawMessage
+}
+
+// OperationRegistry maps operation names, the "type" of an operation in the transform section of a schema, to
+// factories which create new instances of that Operation.
+//
+// A registry created with NewOperationRegistry falls back to the operations registered with RegisterOperation
+// for any name it does not define itself, this allows a single Transformer to add or override operations.
+type OperationRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]func() Operation
+	parent    *OperationRegistry
+
+	// definitions are the schema definitions of operations which don't implement SchemaDefiner, ie the built-ins.
+	definitions map[string]json.RawMessage
+}
+
+// NewOperationRegistry returns an empty OperationRegistry which falls back to the operations registered with
+// RegisterOperation, including the built-in operations.
+func NewOperationRegistry() *OperationRegistry {
+	return &OperationRegistry{
+		factories: make(map[string]func() Operation),
+		parent:    operations,
+	}
+}
+
+func newBuiltinRegistry() *OperationRegistry {
+	r := &OperationRegistry{factories: make(map[string]func() Operation)}
+	r.Register("changeCase", func() Operation { return &changeCase{} })
+	r.Register("dateTime", func() Operation { return &dateTime{} })
+	r.Register("duration", func() Operation { return &duration{} })
+	r.Register("inverse", func() Operation { return &inverse{} })
+	r.Register("max", func() Operation { return &aggregate{kind: "max"} })
+	r.Register("min", func() Operation { return &aggregate{kind: "min"} })
+	r.Register("sum", func() Operation { return &aggregate{kind: "sum"} })
+	r.Register("avg", func() Operation { return &aggregate{kind: "avg"} })
+	r.Register("argmin", func() Operation { return &aggregate{kind: "argmin"} })
+	r.Register("argmax", func() Operation { return &aggregate{kind: "argmax"} })
+	r.Register("replace", func() Operation { return &replace{} })
+	r.Register("extract", func() Operation { return &extract{} })
+	r.Register("split", func() Operation { return &split{} })
+	r.Register("add", func() Operation { return &add{} })
+	r.Register("multiply", func() Operation { return &multiply{} })
+	r.Register("divide", func() Operation { return &divide{} })
+	r.Register("round", func() Operation { return &round{} })
+	r.Register("floor", func() Operation { return &floor{} })
+	r.Register("ceil", func() Operation { return &ceil{} })
+	r.Register("clamp", func() Operation { return &clamp{} })
+	r.Register("abs", func() Operation { return &abs{} })
+	r.Register("trim", func() Operation { return &trim{} })
+	r.Register("trimPrefix", func() Operation { return &trimPrefix{} })
+	r.Register("trimSuffix", func() Operation { return &trimSuffix{} })
+	r.Register("substring", func() Operation { return &substring{} })
+	r.Register("truncate", func() Operation { return &truncate{} })
+	r.Register("pad", func() Operation { return &pad{} })
+	r.Register("titleCase", func() Operation { return &titleCase{} })
+	r.Register("normalizeWhitespace", func() Operation { return &normalizeWhitespace{} })
+	r.Register("normalize", func() Operation { return &normalize{} })
+	r.Register("join", func() Operation { return &join{} })
+	r.Register("unique", func() Operation { return &unique{} })
+	r.Register("flatten", func() Operation { return &flatten{} })
+	r.Register("slice", func() Operation { return &sliceItems{} })
+	r.Register("count", func() Operation { return &count{} })
+	r.Register("sort", func() Operation { return &sortItems{} })
+	r.Register("reverse", func() Operation { return &reverse{} })
+	r.Register("first", func() Operation { return &firstItem{} })
+	r.Register("last", func() Operation { return &lastItem{} })
+	r.Register("map", func() Operation { return &mapValue{} })
+	r.Register("stripHTML", func() Operation { return &stripHTML{} })
+	r.Register("sanitizeHTML", func() Operation { return &sanitizeHTML{} })
+	r.Register("htmlToMarkdown", func() Operation { return &htmlToMarkdown{} })
+	r.Register("resolveURL", func() Operation { return &resolveURL{} })
+	r.Register("urlPart", func() Operation { return &urlPart{} })
+	r.Register("setQueryParam", func() Operation { return &setQueryParam{} })
+	r.Register("removeQueryParam", func() Operation { return &removeQueryParam{} })
+	r.Register("normalizeURL", func() Operation { return &normalizeURL{} })
+	r.Register("base64Encode", func() Operation { return &base64Encode{} })
+	r.Register("base64Decode", func() Operation { return &base64Decode{} })
+	r.Register("urlEncode", func() Operation { return &urlEncode{} })
+	r.Register("urlDecode", func() Operation { return &urlDecode{} })
+	r.Register("hash", func() Operation { return &hashValue{} })
+	r.Register("uuidV5", func() Operation { return &uuidV5{} })
+	r.Register("mask", func() Operation { return &mask{} })
+
+	var schema struct {
+		Definitions struct {
+			Operations map[string]json.RawMessage `json:"operations"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(transformSchema, &schema); err != nil {
+		panic("transform: invalid transformSchema.json: " + err.Error())
+	}
+	r.definitions = schema.Definitions.Operations
+	return r
+}
+
+// RegisterOperation makes an Operation available to all Transformers under the given name. Registering a name a
+// second time replaces the previous factory, including for the built-in operations.
+// Operations are looked up when a Transformer is created so registration should happen before that, typically in
+// an init function.
+func RegisterOperation(name string, factory func() Operation) {
+	operations.Register(name, factory)
+}
+
+// OperationSchemaDefinitions returns the definitions/operations fragment of transformSchema.json for all operations
+// registered with RegisterOperation.
+func OperationSchemaDefinitions() (json.RawMessage, error) {
+	return operations.SchemaDefinitions()
+}
+
+// Register adds the operation factory to this registry under the given name, replacing any existing factory and
+// schema definition for that name.
+func (r *OperationRegistry) Register(name string, factory func() Operation) {
+	if name == "" {
+		panic("transform: RegisterOperation name is empty")
+	}
+	if factory == nil {
+		panic("transform: RegisterOperation factory is nil for " + name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+	delete(r.definitions, name)
+}
+
+// Names returns the sorted names of all operations available from this registry.
+func (r *OperationRegistry) Names() []string {
+	all := r.all()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Definitions returns the JSON schema definition for each operation in the registry keyed by operation name.
+// Operations which aren't built-in and don't implement SchemaDefiner get a generic definition allowing any args.
+func (r *OperationRegistry) Definitions() map[string]json.RawMessage {
+	definitions := make(map[string]json.RawMessage)
+	if r.parent != nil {
+		definitions = r.parent.Definitions()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name, factory := range r.factories {
+		if definer, ok := factory().(SchemaDefiner); ok {
+			definitions[name] = definer.SchemaDefinition()
+			continue
+		}
+		if definition, ok := r.definitions[name]; ok {
+			definitions[name] = definition
+			continue
+		}
+		definitions[name] = json.RawMessage(fmt.Sprintf(
+			`{"type":"object","required":["type"],"additionalProperties":false,"properties":{"type":{"type":"string","enum":[%q]},"args":{"type":"object"}}}`,
+			name,
+		))
+	}
+	return definitions
+}
+
+// SchemaDefinitions returns the definitions/operations fragment of transformSchema.json describing the operations in
+// this registry.
+func (r *OperationRegistry) SchemaDefinitions() (json.RawMessage, error) {
+	out, err := json.MarshalIndent(r.Definitions(), "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal operation definitions: %v", err)
+	}
+	return out, nil
+}
+
+// all returns all the factories available from this registry including those of the parent.
+func (r *OperationRegistry) all() map[string]func() Operation {
+	all := make(map[string]func() Operation)
+	if r.parent != nil {
+		all = r.parent.all()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name, factory := range r.factories {
+		all[name] = factory
+	}
+	return all
+}
+
+// newOperation returns a new, uninitialized Operation for the name. A nil registry uses the operations registered
+// with RegisterOperation.
+func (r *OperationRegistry) newOperation(name string) (Operation, error) {
+	if r == nil {
+		r = operations
+	}
+	for reg := r; reg != nil; reg = reg.parent {
+		reg.mu.RLock()
+		factory, ok := reg.factories[name]
+		reg.mu.RUnlock()
+		if ok {
+			return factory(), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported operation %q", name)
+}
@@ -0,0 +1,176 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// upperOp is a simple operation used to test registering operations.
+type upperOp struct{}
+
+func (u *upperOp) Init(args map[string]string) error { return nil }
+
+func (u *upperOp) Transform(in interface{}) (interface{}, error) {
+	return strings.ToUpper(in.(string)), nil
+}
+
+func TestOperationRegistry(t *testing.T) {
+	registry := NewOperationRegistry()
+	registry.Register("upper", func() Operation { return &upperOp{} })
+	registry.Register("changeCase", func() Operation { return &upperOp{} })
+
+	tests := []struct {
+		description string
+		registry    *OperationRegistry
+		name        string
+		want        Operation
+		wantErr     bool
+	}{
+		{
+			description: "Built-in from default registry",
+			name:        "split",
+			want:        &split{},
+		},
+		{
+			description: "Unknown in default registry",
+			name:        "upper",
+			wantErr:     true,
+		},
+		{
+			description: "Registered in new registry",
+			registry:    registry,
+			name:        "upper",
+			want:        &upperOp{},
+		},
+		{
+			description: "Built-in overridden in new registry",
+			registry:    registry,
+			name:        "changeCase",
+			want:        &upperOp{},
+		},
+		{
+			description: "Built-in falls back to default registry",
+			registry:    registry,
+			name:        "split",
+			want:        &split{},
+		},
+		{
+			description: "Unknown in new registry",
+			registry:    registry,
+			name:        "lower",
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := test.registry.newOperation(test.name)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestTransformerWithOperations(t *testing.T) {
+	registry := NewOperationRegistry()
+	registry.Register("changeCase", func() Operation { return &upperOp{} })
+
+	tr, err := NewTransformerWithOperations(operationsSchema, "cumulo", registry)
+	if err != nil {
+		t.Fatalf("failed to initialize transformer: %v", err)
+	}
+
+	got, err := tr.Transform(json.RawMessage(`{"mixedCase": "a|B|c|D", "invalid": false, "url": "http://foo.com/blah"}`))
+	if err != nil {
+		t.Fatalf("failed transform: %v", err)
+	}
+
+	want := json.RawMessage(`{"caseSplit":["A","B","C","D"],"url":"http://gannettdigital.com/blah","valid":true}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestOperationSchemaDefinitions verifies the built-in operations are those described in transformSchema.json.
+func TestOperationSchemaDefinitions(t *testing.T) {
+	var schema struct {
+		Definitions struct {
+			Operations    map[string]interface{} `json:"operations"`
+			TransformFrom struct {
+				Properties struct {
+					Operations struct {
+						Items struct {
+							OneOf []struct {
+								Ref string `json:"$ref"`
+							} `json:"oneOf"`
+						} `json:"items"`
+					} `json:"operations"`
+				} `json:"properties"`
+			} `json:"transformFrom"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(transformSchema, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	rawDefinitions, err := OperationSchemaDefinitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var definitions map[string]interface{}
+	if err := json.Unmarshal(rawDefinitions, &definitions); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range schema.Definitions.Operations {
+		if got, ok := definitions[name]; !ok {
+			t.Errorf("Operation %q is in transformSchema.json but not registered", name)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("Operation %q definition does not match transformSchema.json, got\n%v\nwant\n%v", name, got, want)
+		}
+	}
+
+	refs := make(map[string]bool)
+	for _, oneOf := range schema.Definitions.TransformFrom.Properties.Operations.Items.OneOf {
+		refs[oneOf.Ref] = true
+	}
+	for _, name := range operations.Names() {
+		if _, ok := schema.Definitions.Operations[name]; !ok {
+			t.Errorf("Operation %q is registered but not defined in transformSchema.json", name)
+		}
+		if !refs["#/definitions/operations/"+name] {
+			t.Errorf("Operation %q is not referenced by the transformFrom operations in transformSchema.json", name)
+		}
+	}
+}
+
+func TestRegistryDefinitions(t *testing.T) {
+	registry := NewOperationRegistry()
+	registry.Register("upper", func() Operation { return &upperOp{} })
+	registry.Register("changeCase", func() Operation { return &upperOp{} })
+
+	definitions := registry.Definitions()
+	generic := func(name string) string {
+		return `{"type":"object","required":["type"],"additionalProperties":false,"properties":{"type":{"type":"string","enum":["` +
+			name + `"]},"args":{"type":"object"}}}`
+	}
+
+	if got, want := string(definitions["upper"]), generic("upper"); got != want {
+		t.Errorf("Registered operation got definition\n%s\nwant\n%s", got, want)
+	}
+	if got, want := string(definitions["changeCase"]), generic("changeCase"); got != want {
+		t.Errorf("Overridden built-in got definition\n%s\nwant\n%s", got, want)
+	}
+	if got, want := definitions["split"], operations.definitions["split"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Built-in got definition\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// StreamOptions configures Transformer.TransformStream.
+type StreamOptions struct {
+	// Workers is the number of records transformed concurrently, if zero or less runtime.NumCPU() is used.
+	Workers int
+	// OnError is called for each record which fails to transform with the zero based position of the record in the
+	// input and the error. The failed record is left out of the output and the stream continues.
+	// OnError is called from a single goroutine in input order.
+	OnError func(record int, err error)
+}
+
+// streamRecord is a single record of a stream, done is closed once the record is transformed.
+type streamRecord struct {
+	index int
+	in    json.RawMessage
+	out   json.RawMessage
+	err   error
+	done  chan struct{}
+}
+
+// TransformStream reads JSON records from r, transforms each and writes the results to w as newline delimited JSON
+// in the same order as the input.
+// The input is either newline delimited JSON, one record per line, or a single top level JSON array of records which
+// is decoded incrementally. Records are transformed concurrently by a bounded pool of workers, records which fail
+// are reported to opts.OnError rather than stopping the stream.
+//
+// An error is returned if the input can't be read or decoded, the output can't be written or the context is done.
+// Any records before a read error are still transformed and written. Only JSON input is supported.
+func (tr *Transformer) TransformStream(ctx context.Context, r io.Reader, w io.Writer, opts StreamOptions) error {
+	if tr.format != JSONInput {
+		return fmt.Errorf("streaming transforms support only %s input", JSONInput)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *streamRecord)
+	// ordered bounds the number of records in flight as well as keeping them in input order for writing.
+	ordered := make(chan *streamRecord, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case record, ok := <-jobs:
+					if !ok {
+						return
+					}
+					record.out, record.err = tr.TransformContext(ctx, record.in)
+					close(record.done)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		defer close(ordered)
+		readErr <- readRecords(r, func(index int, raw json.RawMessage) error {
+			record := &streamRecord{index: index, in: raw, done: make(chan struct{})}
+			select {
+			case ordered <- record:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			case jobs <- record:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return nil
+		})
+	}()
+
+	if err := tr.writeRecords(ctx, w, ordered, opts.OnError); err != nil {
+		// the reader may be blocked on r so it is left to finish on its own
+		cancel()
+		wg.Wait()
+		return err
+	}
+	wg.Wait()
+	return <-readErr
+}
+
+// writeRecords writes each record from the channel to w as it completes, stopping when the channel is closed or the
+// context is done.
+func (tr *Transformer) writeRecords(ctx context.Context, w io.Writer, records <-chan *streamRecord, onError func(int, error)) error {
+	bw := bufio.NewWriter(w)
+	var compacted bytes.Buffer
+	for {
+		var record *streamRecord
+		select {
+		case r, ok := <-records:
+			if !ok {
+				if err := bw.Flush(); err != nil {
+					return fmt.Errorf("failed to write output: %v", err)
+				}
+				return nil
+			}
+			record = r
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case <-record.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if record.err != nil {
+			if onError != nil {
+				onError(record.index, record.err)
+			}
+			continue
+		}
+
+		out := record.out
+		if tr.indent != "" || tr.indentPrefix != "" {
+			// each record must be on a single line
+			compacted.Reset()
+			if err := json.Compact(&compacted, out); err != nil {
+				return fmt.Errorf("failed to compact record %d: %v", record.index, err)
+			}
+			out = compacted.Bytes()
+		}
+		if _, err := bw.Write(out); err != nil {
+			return fmt.Errorf("failed to write record %d: %v", record.index, err)
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return fmt.Errorf("failed to write record %d: %v", record.index, err)
+		}
+	}
+}
+
+// readRecords reads each record from r calling fn with it, stopping at the first error.
+// A top level JSON array is read an element at a time otherwise each non-blank line is a record.
+func readRecords(r io.Reader, fn func(index int, raw json.RawMessage) error) error {
+	br := bufio.NewReader(r)
+
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read input: %v", err)
+	}
+
+	if first == '[' {
+		return readArrayRecords(br, fn)
+	}
+	return readLineRecords(br, fn)
+}
+
+func readArrayRecords(r io.Reader, fn func(index int, raw json.RawMessage) error) error {
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read start of input array: %v", err)
+	}
+
+	for index := 0; dec.More(); index++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("failed to decode record %d of input array: %v", index, err)
+		}
+		if err := fn(index, raw); err != nil {
+			return err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read end of input array: %v", err)
+	}
+	return nil
+}
+
+func readLineRecords(br *bufio.Reader, fn func(index int, raw json.RawMessage) error) error {
+	for index := 0; ; {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read record %d: %v", index, err)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if ferr := fn(index, line); ferr != nil {
+				return ferr
+			}
+			index++
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// peekNonSpace discards any leading whitespace from the reader and returns the next byte without consuming it.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
@@ -0,0 +1,128 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransformStream(t *testing.T) {
+	record := func(url string) string {
+		return fmt.Sprintf(`{"type": "image", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": 2}], "publishUrl": %q, "absoluteUrl": "absolute"}`, url)
+	}
+	output := func(url string) string {
+		return fmt.Sprintf(`{"URL":{"absolute":"absolute","publish":%q},"crops":[{"height":1,"name":"name","path":"path","relativePath":"","width":2}],"type":"image"}`, url)
+	}
+
+	var manyIn, manyOut []string
+	for i := 0; i < 200; i++ {
+		manyIn = append(manyIn, record(fmt.Sprint(i)))
+		manyOut = append(manyOut, output(fmt.Sprint(i)))
+	}
+
+	tests := []struct {
+		description string
+		options     []Option
+		in          string
+		workers     int
+		want        string
+		wantErrors  []int
+		wantErr     bool
+	}{
+		{
+			description: "Empty input",
+			in:          " \n",
+		},
+		{
+			description: "NDJSON",
+			in:          record("a") + "\n\n" + record("b") + "\n" + record("c"),
+			want:        output("a") + "\n" + output("b") + "\n" + output("c") + "\n",
+		},
+		{
+			description: "NDJSON, many records remain in order",
+			in:          strings.Join(manyIn, "\n") + "\n",
+			workers:     8,
+			want:        strings.Join(manyOut, "\n") + "\n",
+		},
+		{
+			description: "NDJSON, failed records are reported",
+			in:          record("a") + "\n{not json}\n" + `{"type": "video"}` + "\n" + record("d") + "\n",
+			want:        output("a") + "\n" + output("d") + "\n",
+			wantErrors:  []int{1, 2},
+		},
+		{
+			description: "JSON array",
+			in:          "[\n" + record("a") + ",\n" + record("b") + "\n]\n",
+			want:        output("a") + "\n" + output("b") + "\n",
+		},
+		{
+			description: "JSON array, records before a decode error are written",
+			in:          "[" + record("a") + ", {bad",
+			want:        output("a") + "\n",
+			wantErr:     true,
+		},
+		{
+			description: "Indented output is compacted",
+			options:     []Option{WithIndent("", "  ")},
+			in:          record("a") + "\n",
+			want:        output("a") + "\n",
+		},
+		{
+			description: "XML input is not supported",
+			options:     []Option{WithInputFormat(XMLInput)},
+			in:          "<a></a>",
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		tr, err := NewTransformerWithOptions(imageSchema, "cumulo", test.options...)
+		if err != nil {
+			t.Fatalf("Test %q - failed to initialize transformer: %v", test.description, err)
+		}
+
+		var (
+			out       bytes.Buffer
+			gotErrors []int
+		)
+		opts := StreamOptions{
+			Workers: test.workers,
+			OnError: func(record int, err error) { gotErrors = append(gotErrors, record) },
+		}
+		err = tr.TransformStream(context.Background(), strings.NewReader(test.in), &out, opts)
+
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		}
+		if got := out.String(); got != test.want {
+			t.Errorf("Test %q - got\n%s\nwant\n%s", test.description, got, test.want)
+		}
+		if !reflect.DeepEqual(gotErrors, test.wantErrors) {
+			t.Errorf("Test %q - got errors for records %v, want %v", test.description, gotErrors, test.wantErrors)
+		}
+	}
+}
+
+func TestTransformStreamCancel(t *testing.T) {
+	tr, err := NewTransformer(imageSchema, "cumulo")
+	if err != nil {
+		t.Fatalf("failed to initialize transformer: %v", err)
+	}
+
+	// the reader never returns so only the context can stop the stream
+	r, w := io.Pipe()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tr.TransformStream(ctx, r, &bytes.Buffer{}, StreamOptions{}); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
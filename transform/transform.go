@@ -1,12 +1,15 @@
 package transform
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"text/template"
+	"time"
 
-	"github.com/PaesslerAG/jsonpath"
 	"github.com/antchfx/xmlquery"
 )
 
@@ -16,103 +19,359 @@ const (
 	first transformMethod = iota
 	last
 	concatenate
+	collect
+	merge
+	sum
+	firstNonEmpty
 )
 
-// transformOperation defines the interface for operations that are implemented within the transform schema.
-type transformOperation interface {
-	init(args map[string]string) error
-	transform(in interface{}) (interface{}, error)
+// errorAction is what happens to a field when a from instruction or operation fails.
+type errorAction int32
+
+const (
+	onErrorFail errorAction = iota
+	onErrorSkip
+	onErrorDefault
+	onErrorNull
+)
+
+// Operation defines the interface for operations that are implemented within the transform schema.
+// Init is called once with the args from the schema when the transform instructions are parsed, Transform is then
+// called with each value the operation is applied to and must be safe for concurrent use.
+type Operation interface {
+	Init(args map[string]string) error
+	Transform(in interface{}) (interface{}, error)
+}
+
+// limitedOperation is implemented by operations which enforce Limits, transformLimited is called in place of Transform.
+type limitedOperation interface {
+	transformLimited(in interface{}, limits Limits) (interface{}, error)
+}
+
+// fieldTypedOperation is implemented by operations whose result depends on the type of the schema field,
+// transformField is called in place of Transform.
+type fieldTypedOperation interface {
+	transformField(in interface{}, fieldType string) (interface{}, error)
+}
+
+// rawInputOperation is implemented by operations which are given the value from the input as is, rather than first
+// converted to the type of the schema field, when they are the first operation of an instruction.
+type rawInputOperation interface {
+	rawInput()
+}
+
+// arrayInputOperation is implemented by raw input operations which take an array, for XML input they are given the
+// matched nodes even when only one node matches.
+type arrayInputOperation interface {
+	rawInputOperation
+	arrayInput()
+}
+
+// pathOperation is implemented by operations which also read a value from elsewhere in the input, inputPath returns
+// the path of that value from the args. The path is prepared like the path of the instruction so it may be relative
+// to the current array item, transformPath is called in place of Transform with the value found or nil.
+type pathOperation interface {
+	inputPath() string
+	transformPath(in, pathValue interface{}) (interface{}, error)
+}
+
+// StructuredOperation can optionally be implemented by an Operation with args which aren't all strings, InitArgs is
+// called in place of Init with the raw JSON of each arg.
+type StructuredOperation interface {
+	Operation
+	InitArgs(args map[string]json.RawMessage) error
 }
 
 type transformOperationJSON struct {
-	Name string            `json:"type"`
-	Args map[string]string `json:"args"`
+	Name string                     `json:"type"`
+	Args map[string]json.RawMessage `json:"args"`
 }
 
-// transformInstruction defines a jsonPath and xmlPath for a transform and an optional set of operations to be performed on the
-// data from that path.
+// init initializes the operation with the args. An Operation which isn't a StructuredOperation is given a string arg
+// as is and any other arg as its JSON, ie `2` for the number 2.
+func (toj transformOperationJSON) init(op Operation) error {
+	if structured, ok := op.(StructuredOperation); ok {
+		return structured.InitArgs(toj.Args)
+	}
+
+	var args map[string]string
+	if toj.Args != nil {
+		args = make(map[string]string, len(toj.Args))
+	}
+	for key, raw := range toj.Args {
+		var str string
+		if err := json.Unmarshal(raw, &str); err == nil {
+			args[key] = str
+			continue
+		}
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, raw); err != nil {
+			return fmt.Errorf("invalid argument %q: %v", key, err)
+		}
+		args[key] = compacted.String()
+	}
+	return op.Init(args)
+}
+
+// transformInstruction defines a jsonPath and xmlPath, or an expr, value or template, for a transform and an optional
+// set of operations to be performed on the data from that source.
 type transformInstruction struct {
 	// For jsonPath format see http://goessner.net/articles/JsonPath/
 	jsonPath string
 	// For XPath format see https://devhints.io/xpath
-	xmlPath    string
-	Operations []transformOperation `json:"operations"`
+	xmlPath string
+	// expr is an expression computing the value in place of the paths, see exprLanguage.
+	expr string
+	// value is a literal used in place of reading the input, rawValue is its JSON.
+	value    interface{}
+	rawValue json.RawMessage
+	// template is executed with the values found at the bindings, paths in the input by name, in place of reading a
+	// single path.
+	template *template.Template
+	bindings map[string]string
+	// when is an optional expression, the instruction is only used when it is true.
+	when       string
+	Operations []Operation `json:"operations"`
+	// operationTypes are the names of the Operations in the schema, used when reporting failures.
+	operationTypes []string
+
+	// compiledJSONPath is the jsonPath compiled for the schema instance the instruction is part of.
+	compiledJSONPath *compiledPath
+	compiledExpr     *compiledPath
+	compiledWhen     *compiledPath
+	compiledBindings map[string]*compiledPath
+	// inputPaths are the paths read by each pathOperation indexed like Operations, with compiledInputPaths their
+	// compiled form for JSON input.
+	inputPaths         []string
+	compiledInputPaths []*compiledPath
 }
 
 type transformInstructionJSON struct {
 	JSONPath   string                   `json:"jsonPath"`
 	XMLPath    string                   `json:"xmlPath"`
+	Expr       string                   `json:"expr"`
+	Value      json.RawMessage          `json:"value"`
+	Template   string                   `json:"template"`
+	Bindings   map[string]string        `json:"bindings"`
+	When       string                   `json:"when"`
 	Operations []transformOperationJSON `json:"operations"`
 }
 
-// UnmarshalJSON implements the json.Unmarshaler interface, this function exists to properly map the transformOperation.
+// UnmarshalJSON implements the json.Unmarshaler interface, this function exists to properly map the Operations.
+// The operations are looked up from those registered with RegisterOperation.
 func (ti *transformInstruction) UnmarshalJSON(data []byte) error {
+	return ti.unmarshalJSON(data, nil)
+}
+
+// unmarshalJSON does the work of UnmarshalJSON looking up operations in the given registry, a nil registry uses
+// the operations registered with RegisterOperation.
+func (ti *transformInstruction) unmarshalJSON(data []byte, operations *OperationRegistry) error {
 	var jti transformInstructionJSON
 
 	if err := json.Unmarshal(data, &jti); err != nil {
 		return fmt.Errorf("failed to extract transform from JSON: %v", err)
 	}
 
+	var sources []string
+	if jti.JSONPath != "" || jti.XMLPath != "" {
+		sources = append(sources, "jsonPath or xmlPath")
+	}
+	if jti.Expr != "" {
+		sources = append(sources, "expr")
+	}
+	if jti.Value != nil {
+		sources = append(sources, "value")
+	}
+	if jti.Template != "" {
+		sources = append(sources, "template")
+	}
+	if len(sources) > 1 {
+		return fmt.Errorf("a transform can only have one of %s", strings.Join(sources, ", "))
+	}
+	if jti.Bindings != nil && jti.Template == "" {
+		return errors.New("a transform with bindings must have a template")
+	}
+
 	ti.jsonPath = jti.JSONPath
 	ti.xmlPath = jti.XMLPath
-	ti.Operations = []transformOperation{}
+	ti.expr = jti.Expr
+	ti.when = jti.When
+	ti.value, ti.rawValue, ti.template, ti.bindings = nil, nil, nil, nil
+	if jti.Value != nil {
+		if err := json.Unmarshal(jti.Value, &ti.value); err != nil {
+			return fmt.Errorf("invalid value: %v", err)
+		}
+		ti.rawValue = jti.Value
+	}
+	if jti.Template != "" {
+		var err error
+		if ti.template, err = template.New("template").Option("missingkey=error").Parse(jti.Template); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+		ti.bindings = make(map[string]string, len(jti.Bindings))
+		for name, path := range jti.Bindings {
+			ti.bindings[name] = path
+		}
+	}
+	ti.Operations = []Operation{}
+	ti.operationTypes = nil
+	ti.inputPaths = nil
 
 	for _, toj := range jti.Operations {
-		var op transformOperation
-		switch toj.Name {
-		case "changeCase":
-			op = &changeCase{}
-		case "duration":
-			op = &duration{}
-		case "inverse":
-			op = &inverse{}
-		case "max":
-			op = &max{}
-		case "replace":
-			op = &replace{}
-		case "split":
-			op = &split{}
-		default:
-			return fmt.Errorf("unsupported operation %q", toj.Name)
+		op, err := operations.newOperation(toj.Name)
+		if err != nil {
+			return err
 		}
 
-		if err := op.init(toj.Args); err != nil {
+		if err := toj.init(op); err != nil {
 			return fmt.Errorf("failed initializing transform operation: %v", err)
 		}
 		ti.Operations = append(ti.Operations, op)
+		ti.operationTypes = append(ti.operationTypes, toj.Name)
+
+		var inputPath string
+		if pathOp, ok := op.(pathOperation); ok {
+			inputPath = pathOp.inputPath()
+		}
+		ti.inputPaths = append(ti.inputPaths, inputPath)
 	}
 	return nil
 }
 
-func (ti *transformInstruction) xmlTransform(in interface{}, fieldType string, modifier pathModifier) (interface{}, error) {
-	path := ti.xmlPath
-	if modifier != nil {
-		path = modifier(path)
+// compile prepares the expr, or for JSON input the jsonPath, and the input paths of the operations for evaluation
+// within the schema instance at instancePath.
+func (ti *transformInstruction) compile(instancePath string, format InputFormat) error {
+	var err error
+	if ti.expr != "" {
+		if ti.compiledExpr, err = compileExpr(ti.expr, instancePath); err != nil {
+			return err
+		}
+	}
+	if ti.when != "" {
+		if ti.compiledWhen, err = compileExpr(ti.when, instancePath); err != nil {
+			return fmt.Errorf("invalid when: %v", err)
+		}
+	}
+	if format != JSONInput {
+		return nil
+	}
+	if ti.readsPath() {
+		if ti.compiledJSONPath, err = compileJSONPath(ti.jsonPath, instancePath); err != nil {
+			return err
+		}
+	}
+	ti.compiledBindings = make(map[string]*compiledPath, len(ti.bindings))
+	for name, path := range ti.bindings {
+		if ti.compiledBindings[name], err = compileJSONPath(path, instancePath); err != nil {
+			return fmt.Errorf("binding %s: %v", name, err)
+		}
+	}
+
+	ti.compiledInputPaths = make([]*compiledPath, len(ti.inputPaths))
+	for i, path := range ti.inputPaths {
+		if path == "" {
+			continue
+		}
+		if ti.compiledInputPaths[i], err = compileJSONPath(path, instancePath); err != nil {
+			return fmt.Errorf("operation %s: %v", ti.operationType(i), err)
+		}
+	}
+	return nil
+}
+
+// inputPathValue returns the value at the input path of the operation at index i, in is the input of the instruction.
+// For XML input the value is the text of the first node matching the path.
+func (ti *transformInstruction) inputPathValue(i int, in interface{}, indexes []int, state *transformState) interface{} {
+	var path string
+	if i < len(ti.inputPaths) {
+		path = ti.inputPaths[i]
+	} else if pathOp, ok := ti.Operations[i].(pathOperation); ok {
+		// instructions not built from JSON have no prepared paths
+		path = pathOp.inputPath()
+	}
+	if path == "" {
+		return nil
+	}
+
+	if node, ok := in.(*xmlquery.Node); ok {
+		found := findOneXML(node, path, indexes, state)
+		if found == nil {
+			return nil
+		}
+		return found.InnerText()
+	}
+
+	var compiled *compiledPath
+	if i < len(ti.compiledInputPaths) {
+		compiled = ti.compiledInputPaths[i]
+	}
+	if compiled == nil {
+		var err error
+		if compiled, err = compileJSONPath(path, ""); err != nil {
+			return nil
+		}
+	}
+	value, err := compiled.get(in, indexes)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// sourcePath returns the path in the input this instruction reads from.
+func (ti *transformInstruction) sourcePath(indexes []int, format InputFormat) string {
+	switch {
+	case ti.rawValue != nil:
+		return string(ti.rawValue)
+	case ti.template != nil:
+		return ti.template.Root.String()
+	}
+	if ti.expr != "" {
+		if ti.compiledExpr == nil {
+			return ti.expr
+		}
+		return ti.compiledExpr.render(indexes)
+	}
+	if format == XMLInput {
+		return ti.xmlPath
 	}
+	if ti.compiledJSONPath == nil {
+		return ti.jsonPath
+	}
+	return ti.compiledJSONPath.render(indexes)
+}
+
+func (ti *transformInstruction) xmlTransform(in interface{}, fieldType string, indexes []int, state *transformState) (interface{}, error) {
+	path := ti.xmlPath
 
 	node, ok := in.(*xmlquery.Node)
 	if !ok {
 		return nil, errors.New("Error converting input to *xmlquery.Node")
 	}
 
-	xmlNode := xmlquery.Find(node, path)
+	xmlNode := findXML(node, path, indexes, state)
 	if xmlNode == nil {
 		return nil, nil
 	}
 	rawValue := xmlNode
 
 	var (
-		value interface{}
-		err   error
+		value      interface{}
+		convertErr error
 	)
 
-	if len(xmlNode) == 1 {
-		value, err = convert(xmlNode[0].InnerText(), fieldType)
-	} else {
-		value, err = convert(xmlNode, fieldType)
+	switch {
+	case ti.rawInput() && len(xmlNode) == 1 && !ti.arrayInput():
+		value, convertErr = xmlNode[0].InnerText(), errRawInput
+	case ti.rawInput():
+		value, convertErr = rawValue, errRawInput
+	case len(xmlNode) == 1:
+		value, convertErr = convert(xmlNode[0].InnerText(), fieldType)
+	default:
+		value, convertErr = convert(xmlNode, fieldType)
 	}
 
-	if err != nil {
+	if convertErr != nil && convertErr != errRawInput {
 		// In some cases the conversion is helpful but in others like before a max operation it isn't
 		value = rawValue
 	}
@@ -120,30 +379,130 @@ func (ti *transformInstruction) xmlTransform(in interface{}, fieldType string, m
 		return nil, nil
 	}
 
-	for _, op := range ti.Operations {
-		value, err = op.transform(value)
-		if err != nil {
-			return nil, fmt.Errorf("failed operation on value from xmlPath %q: %v", path, err)
-		}
-	}
-	return value, nil
+	return ti.runOperations(value, in, indexes, fieldType, path, convertErr != nil, state)
 }
 
-func (ti *transformInstruction) jsonTransform(in interface{}, fieldType string, modifier pathModifier) (interface{}, error) {
-	path := ti.jsonPath
-	if modifier != nil {
-		path = modifier(path)
+func (ti *transformInstruction) jsonTransform(in interface{}, fieldType string, indexes []int, state *transformState) (interface{}, error) {
+	compiled := ti.compiledJSONPath
+	if compiled == nil {
+		// instructions not built as part of a Transformer are compiled on use
+		var err error
+		if compiled, err = compileJSONPath(ti.jsonPath, ""); err != nil {
+			return nil, nil
+		}
 	}
-	rawValue, err := jsonpath.Get(path, in)
+	rawValue, err := compiled.get(in, indexes)
 	if err != nil {
 		return nil, nil
 	}
 	if rawValue == nil {
 		return nil, nil
 	}
+	return ti.transformValue(rawValue, in, indexes, fieldType, compiled.render(indexes), state)
+}
+
+// matches reports whether the when predicate of the instruction is true for the input, an instruction without one
+// always matches. The predicate is an expression, a value other than a boolean is true unless it is null so a path on
+// its own checks the path exists. A predicate which can't be evaluated, ie because a path in it is missing, is false.
+func (ti *transformInstruction) matches(in interface{}, indexes []int, state *transformState) bool {
+	if ti.when == "" {
+		return true
+	}
+	compiled := ti.compiledWhen
+	if compiled == nil {
+		var err error
+		if compiled, err = compileExpr(ti.when, ""); err != nil {
+			return false
+		}
+	}
 
-	value, err := convert(rawValue, fieldType)
+	value, err := compiled.get(exprParameter(in, indexes, state), indexes)
 	if err != nil {
+		return false
+	}
+	switch v := value.(type) {
+	case bool:
+		return v
+	case []interface{}:
+		// a path with a wildcard or filter matching nothing
+		return len(v) > 0
+	}
+	return value != nil
+}
+
+// exprTransform evaluates the expr against the input, like a path which isn't found an expression which can't be
+// evaluated, ie because a path in it is missing, has no value.
+func (ti *transformInstruction) exprTransform(in interface{}, fieldType string, indexes []int, state *transformState) (interface{}, error) {
+	compiled := ti.compiledExpr
+	if compiled == nil {
+		var err error
+		if compiled, err = compileExpr(ti.expr, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	rawValue, err := compiled.get(exprParameter(in, indexes, state), indexes)
+	if err != nil || rawValue == nil {
+		return nil, nil
+	}
+	if f, ok := rawValue.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		// ie a division by zero
+		return nil, nil
+	}
+	return ti.transformValue(rawValue, in, indexes, fieldType, compiled.render(indexes), state)
+}
+
+// valueTransform uses the literal value of the instruction, each use is given its own copy as operations may modify
+// the value.
+func (ti *transformInstruction) valueTransform(in interface{}, fieldType string, indexes []int, state *transformState) (interface{}, error) {
+	if ti.value == nil {
+		return nil, nil
+	}
+	return ti.transformValue(deepCopy(ti.value), in, indexes, fieldType, string(ti.rawValue), state)
+}
+
+// templateTransform executes the template with the values of the bindings, for XML input the text of the first node
+// matching each binding. If any binding isn't found there is no value.
+func (ti *transformInstruction) templateTransform(in interface{}, fieldType string, indexes []int, state *transformState) (interface{}, error) {
+	data := make(map[string]interface{}, len(ti.bindings))
+	for name, path := range ti.bindings {
+		var value interface{}
+		if node, ok := in.(*xmlquery.Node); ok {
+			if found := findOneXML(node, path, indexes, state); found != nil {
+				value = found.InnerText()
+			}
+		} else {
+			compiled := ti.compiledBindings[name]
+			if compiled == nil {
+				// instructions not built as part of a Transformer are compiled on use
+				var err error
+				if compiled, err = compileJSONPath(path, ""); err != nil {
+					return nil, nil
+				}
+			}
+			value, _ = compiled.get(in, indexes)
+		}
+		if value == nil {
+			return nil, nil
+		}
+		data[name] = value
+	}
+
+	var out strings.Builder
+	if err := ti.template.Execute(&out, data); err != nil {
+		return nil, &FieldError{SourcePath: ti.template.Root.String(), Err: fmt.Errorf("failed to execute template: %v", err)}
+	}
+	return ti.transformValue(out.String(), in, indexes, fieldType, ti.template.Root.String(), state)
+}
+
+// transformValue converts the value found by the instruction to the fieldType, unless the first operation takes the
+// raw input, and runs the operations on it.
+func (ti *transformInstruction) transformValue(rawValue, in interface{}, indexes []int, fieldType, source string, state *transformState) (interface{}, error) {
+	value, convertErr := rawValue, errRawInput
+	if !ti.rawInput() {
+		value, convertErr = convert(rawValue, fieldType)
+	}
+	if convertErr != nil {
 		// In some cases the conversion is helpful but in others like before a max operation it isn't
 		value = rawValue
 	}
@@ -151,25 +510,113 @@ func (ti *transformInstruction) jsonTransform(in interface{}, fieldType string,
 		return nil, nil
 	}
 
-	for _, op := range ti.Operations {
-		value, err = op.transform(value)
+	return ti.runOperations(value, in, indexes, fieldType, source, convertErr != nil, state)
+}
+
+// readsPath reports whether the instruction reads its value from the jsonPath or xmlPath.
+func (ti *transformInstruction) readsPath() bool {
+	return ti.expr == "" && ti.rawValue == nil && ti.template == nil
+}
+
+// errRawInput marks a value as not converted to the field type because the first operation takes the raw input.
+var errRawInput = errors.New("raw input for operation")
+
+// rawInput reports whether the first operation takes the value from the input without conversion.
+func (ti *transformInstruction) rawInput() bool {
+	if len(ti.Operations) == 0 {
+		return false
+	}
+	_, ok := ti.Operations[0].(rawInputOperation)
+	return ok
+}
+
+// arrayInput reports whether the first operation takes an array from the input.
+func (ti *transformInstruction) arrayInput() bool {
+	if len(ti.Operations) == 0 {
+		return false
+	}
+	_, ok := ti.Operations[0].(arrayInputOperation)
+	return ok
+}
+
+// runOperations chains the operations on the value read from the source path, in is the input the value was read
+// from. If the value was not converted to the fieldType before the operations and strict conversion is enabled the
+// result of the operations must be convertible.
+// Any failure is returned as a *FieldError.
+func (ti *transformInstruction) runOperations(value, in interface{}, indexes []int, fieldType, source string, unconverted bool, state *transformState) (interface{}, error) {
+	var err error
+	for i, op := range ti.Operations {
+		switch o := op.(type) {
+		case limitedOperation:
+			value, err = o.transformLimited(value, state.limit())
+		case fieldTypedOperation:
+			if i < len(ti.Operations)-1 {
+				// only the final result has to be of the field type, ie not rounded to an integer before a floor
+				value, err = o.transformField(value, "number")
+			} else {
+				value, err = o.transformField(value, fieldType)
+			}
+		case pathOperation:
+			value, err = o.transformPath(value, ti.inputPathValue(i, in, indexes, state))
+		default:
+			value, err = op.Transform(value)
+		}
+		if err != nil {
+			return nil, &FieldError{SourcePath: source, Operation: ti.operationType(i), Err: err}
+		}
+		if value == nil {
+			// nothing to pass on, ie no match for extract, so the next instruction is tried
+			return nil, nil
+		}
+		if i < len(ti.Operations)-1 {
+			if _, ok := ti.Operations[i+1].(arrayInputOperation); !ok {
+				// only the array operations take XML nodes, the others are given their text
+				value = xmlNodesText(value)
+			}
+		}
+	}
+
+	if t, ok := value.(time.Time); ok && (fieldType == "date" || fieldType == "time") {
+		// date and time fields are strings in the output so a time.Time from an operation must be formatted
+		value, _ = convert(t, fieldType)
+	}
+
+	// XML nodes from an operation, ie first or slice, can't be output so are always converted
+	if unconverted && (state.strictConversion() || isXMLNodes(value)) {
+		value, err = convert(value, fieldType)
 		if err != nil {
-			return nil, fmt.Errorf("failed operation on value from jsonPath %q: %v", path, err)
+			return nil, &FieldError{SourcePath: source, Err: fmt.Errorf("strict conversion to %s failed: %v", fieldType, err)}
 		}
 	}
 	return value, nil
 }
 
+// operationType returns the name of the operation at index i, this is empty for instructions not built from JSON.
+func (ti *transformInstruction) operationType(i int) string {
+	if i < len(ti.operationTypes) {
+		return ti.operationTypes[i]
+	}
+	return ""
+}
+
 // transform runs the instructions in this object returning the new transformed value or an error if unable to.
 // It handles the logic for finding the value to be transformed and chaining the Operations.
 // It will not error if the value is not found, rather it returns nil for the value.
 // If a conversion or operation fails an error is returned.
-func (ti *transformInstruction) transform(in interface{}, fieldType string, modifier pathModifier, format inputFormat) (interface{}, error) {
-	if format == xmlInput {
-		return ti.xmlTransform(in, fieldType, modifier)
+func (ti *transformInstruction) transform(in interface{}, fieldType string, indexes []int, format InputFormat, state *transformState) (interface{}, error) {
+	switch {
+	case ti.expr != "":
+		return ti.exprTransform(in, fieldType, indexes, state)
+	case ti.rawValue != nil:
+		return ti.valueTransform(in, fieldType, indexes, state)
+	case ti.template != nil:
+		return ti.templateTransform(in, fieldType, indexes, state)
 	}
-	if format == jsonInput {
-		return ti.jsonTransform(in, fieldType, modifier)
+	if format == XMLInput {
+		return ti.xmlTransform(in, fieldType, indexes, state)
+	}
+	if format == JSONInput {
+		return ti.jsonTransform(in, fieldType, indexes, state)
 	}
 	return nil, errors.New("no path type specified for transform")
 }
@@ -180,27 +627,174 @@ type transformInstructions struct {
 	From          []*transformInstruction `json:"from"`
 	Method        transformMethod         `json:"method"`
 	MethodOptions methodOptions           `json:"methodOptions"`
+	OnError       errorAction             `json:"onError"`
 }
 
 type transformInstructionsJSON struct {
-	From          []*transformInstruction `json:"from"`
-	Method        string                  `json:"method"`
-	MethodOptions methodOptions           `json:"methodOptions"`
+	From          []json.RawMessage `json:"from"`
+	Method        string            `json:"method"`
+	MethodOptions methodOptions     `json:"methodOptions"`
+	OnError       string            `json:"onError"`
 }
 
 type methodOptions struct {
 	ConcatenateDelimiter string `json:"concatenateDelimiter"`
+	// CollectFlatten adds the items of an array value to the collected array rather than the array itself.
+	CollectFlatten bool `json:"collectFlatten"`
+	// MergePrecedence is which value is kept when merged objects have the same key, first or last. The default is
+	// first.
+	MergePrecedence string `json:"mergePrecedence"`
+	// MergeArrays is how arrays with the same key are merged, replace where the array with precedence is kept or
+	// append. The default is replace.
+	MergeArrays string `json:"mergeArrays"`
+	// SumIgnoreInvalid skips values which aren't numbers rather than failing.
+	SumIgnoreInvalid bool `json:"sumIgnoreInvalid"`
+	// FirstNonEmptyTrim treats strings of only whitespace as empty.
+	FirstNonEmptyTrim bool `json:"firstNonEmptyTrim"`
+}
+
+// validate checks the options have known values.
+func (mo methodOptions) validate() error {
+	switch mo.MergePrecedence {
+	case "", "first", "last":
+	default:
+		return fmt.Errorf("unknown mergePrecedence %q", mo.MergePrecedence)
+	}
+	switch mo.MergeArrays {
+	case "", "replace", "append":
+	default:
+		return fmt.Errorf("unknown mergeArrays %q", mo.MergeArrays)
+	}
+	return nil
+}
+
+// collect adds the value to the collected array.
+func (mo methodOptions) collect(collected, value interface{}) (interface{}, error) {
+	items, _ := collected.([]interface{})
+	if values, ok := sliceValues(value); ok && mo.CollectFlatten {
+		return append(items, values...), nil
+	}
+	return append(items, value), nil
+}
+
+// merge deep merges the object value into the merged object.
+func (mo methodOptions) merge(merged, value interface{}) (interface{}, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("can't merge type %T, only objects can be merged", value)
+	}
+	if merged == nil {
+		// the value may be part of the input so is copied before it is modified
+		return deepCopy(obj), nil
+	}
+	return mo.mergeObjects(merged.(map[string]interface{}), obj), nil
+}
+
+// mergeObjects merges b into a, which are both already merged objects or the newest value.
+func (mo methodOptions) mergeObjects(a, b map[string]interface{}) map[string]interface{} {
+	for key, bValue := range b {
+		aValue, exists := a[key]
+		if !exists || aValue == nil {
+			a[key] = deepCopy(bValue)
+			continue
+		}
+
+		aObj, aIsObj := aValue.(map[string]interface{})
+		bObj, bIsObj := bValue.(map[string]interface{})
+		aItems, aIsArray := aValue.([]interface{})
+		bItems, bIsArray := bValue.([]interface{})
+		switch {
+		case aIsObj && bIsObj:
+			a[key] = mo.mergeObjects(aObj, bObj)
+		case aIsArray && bIsArray && mo.MergeArrays == "append":
+			a[key] = append(aItems, deepCopy(bItems).([]interface{})...)
+		case mo.MergePrecedence == "last" && bValue != nil:
+			a[key] = deepCopy(bValue)
+		}
+	}
+	return a
+}
+
+// sum adds the number value to the total. The total is an int64 while every value is an integer, otherwise it is a
+// float64. For an integer field whole numbers decoded from JSON as float64 are also integers.
+func (mo methodOptions) sum(total, value interface{}, integerField bool) (interface{}, error) {
+	number, ok := numberValue(value)
+	if !ok {
+		if mo.SumIgnoreInvalid {
+			return total, nil
+		}
+		return nil, fmt.Errorf("can't sum type %T, only numbers can be summed", value)
+	}
+
+	var (
+		integer   int64
+		isInteger bool
+	)
+	switch value.(type) {
+	case int, int64, json.Number:
+		integer, isInteger = intValue(value)
+	default:
+		if integerField {
+			integer, isInteger = intValue(value)
+		}
+	}
+
+	switch t := total.(type) {
+	case int64:
+		// an int64 total which would overflow becomes a float64
+		if result := t + integer; isInteger && (result > t) == (integer > 0) {
+			return result, nil
+		}
+		return float64(t) + number, nil
+	case float64:
+		return t + number, nil
+	}
+	if isInteger {
+		return integer, nil
+	}
+	return number, nil
+}
+
+// isEmpty reports whether the value is an empty string, array or object for the firstNonEmpty method.
+func (mo methodOptions) isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		if mo.FirstNonEmptyTrim {
+			v = strings.TrimSpace(v)
+		}
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface, this function exists to properly map the method.
 func (tis *transformInstructions) UnmarshalJSON(data []byte) error {
+	return tis.unmarshalJSON(data, nil)
+}
+
+// unmarshalJSON does the work of UnmarshalJSON looking up the operations of each instruction in the given registry.
+func (tis *transformInstructions) unmarshalJSON(data []byte, operations *OperationRegistry) error {
 	var jtis transformInstructionsJSON
 
 	if err := json.Unmarshal(data, &jtis); err != nil {
 		return fmt.Errorf("failed to extract transform from JSON: %v", err)
 	}
 
-	tis.From = jtis.From
+	tis.From = nil
+	for _, rawFrom := range jtis.From {
+		var from transformInstruction
+		if err := from.unmarshalJSON(rawFrom, operations); err != nil {
+			return err
+		}
+		tis.From = append(tis.From, &from)
+	}
+	if err := jtis.MethodOptions.validate(); err != nil {
+		return err
+	}
 	tis.MethodOptions = jtis.MethodOptions
 
 	switch jtis.Method {
@@ -212,50 +806,148 @@ func (tis *transformInstructions) UnmarshalJSON(data []byte) error {
 		tis.Method = last
 	case "concatenate":
 		tis.Method = concatenate
+	case "collect":
+		tis.Method = collect
+	case "merge":
+		tis.Method = merge
+	case "sum":
+		tis.Method = sum
+	case "firstNonEmpty":
+		tis.Method = firstNonEmpty
 	default:
 		return fmt.Errorf("unknown method %q", jtis.Method)
 	}
 
+	switch jtis.OnError {
+	case "", "fail":
+		tis.OnError = onErrorFail
+	case "skip":
+		tis.OnError = onErrorSkip
+	case "default":
+		tis.OnError = onErrorDefault
+	case "null":
+		tis.OnError = onErrorNull
+	default:
+		return fmt.Errorf("unknown onError %q", jtis.OnError)
+	}
+
 	return nil
 }
 
 // transform runs the instructions in this object returning the new transformed value or nil if none is found.
-// It handles the logic for concatenation, first or last methods.
-func (tis *transformInstructions) transform(in interface{}, fieldType string, modifier pathModifier, format inputFormat) (interface{}, error) {
-	var concatResult bool
+// It handles the logic for combining the values of each method. With the skip onError action an instruction which
+// fails is passed over as if it found no value.
+// When the state is recording sources the source path of the value is also returned, if no value is found the source
+// lists all the paths tried.
+func (tis *transformInstructions) transform(in interface{}, fieldType string, indexes []int, format InputFormat, state *transformState) (interface{}, string, error) {
+	// combine is set for the methods which use all the values rather than only the first one found
+	var (
+		combine func(result, value interface{}) (interface{}, error)
+		verb    string
+	)
+	instructions := tis.From
 	switch tis.Method {
 	case last:
-		var newFrom []*transformInstruction
-		for i := len(tis.From) - 1; i >= 0; i-- {
-			newFrom = append(newFrom, tis.From[i])
+		// the instructions are shared by concurrent transforms so reverse a copy rather than the original
+		instructions = make([]*transformInstruction, len(tis.From))
+		for i, instruction := range tis.From {
+			instructions[len(tis.From)-1-i] = instruction
 		}
-		tis.From = newFrom
 	case concatenate:
-		concatResult = true
+		combine = func(result, value interface{}) (interface{}, error) {
+			return concat(result, value, tis.MethodOptions.ConcatenateDelimiter)
+		}
+		verb = "concat"
+	case collect:
+		combine, verb = tis.MethodOptions.collect, "collect"
+	case merge:
+		combine, verb = tis.MethodOptions.merge, "merge"
+	case sum:
+		combine = func(result, value interface{}) (interface{}, error) {
+			return tis.MethodOptions.sum(result, value, fieldType == "integer")
+		}
+		verb = "sum"
 	}
 
-	var result interface{}
+	var (
+		result     interface{}
+		sources    []string
+		triedPaths []string
+	)
+
+	recording := state.recording()
+	for _, from := range instructions {
+		if !from.matches(in, indexes, state) {
+			continue
+		}
+
+		var path string
+		if recording {
+			path = from.sourcePath(indexes, format)
+			triedPaths = append(triedPaths, path)
+		}
 
-	for _, from := range tis.From {
-		value, err := from.transform(in, fieldType, modifier, format)
+		value, err := from.transform(in, fieldType, indexes, format, state)
 		if err != nil {
-			return nil, err
+			if tis.OnError != onErrorSkip || stopsTransform(err) {
+				return nil, "", err
+			}
+			continue
+		}
+		if tis.Method == firstNonEmpty && tis.MethodOptions.isEmpty(value) {
+			value = nil
 		}
-		if concatResult {
-			delimiter := tis.MethodOptions.ConcatenateDelimiter
-			result, err = concat(result, value, delimiter)
+		if value == nil {
+			// only concatenate has always been passed the missing values, the other methods skip them
+			if tis.Method != concatenate {
+				continue
+			}
+		} else if recording {
+			sources = append(sources, path)
+		}
+		if combine != nil {
+			result, err = combine(result, value)
 			if err != nil {
-				return nil, fmt.Errorf("failed to concat values: %v", err)
+				return nil, "", fmt.Errorf("failed to %s values: %v", verb, err)
 			}
 			continue
 		}
-		if value != nil {
-			result = value
-			break
-		}
+		result = value
+		break
 	}
 
-	return result, nil
+	if result == nil {
+		return nil, strings.Join(triedPaths, ", "), nil
+	}
+	return result, strings.Join(sources, ", "), nil
+}
+
+// failed applies the onError action to the failure of the instructions for the field at path. It returns the error if
+// the transform should stop, otherwise whether the field should take its default value rather than be left empty.
+func (tis *transformInstructions) failed(err error, path *compiledPath, indexes []int, state *transformState) (bool, error) {
+	if stopsTransform(err) {
+		return false, err
+	}
+	switch tis.OnError {
+	case onErrorDefault:
+		return true, nil
+	case onErrorNull:
+		return false, nil
+	}
+	if err := state.fieldFailed(err, path, indexes); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// compile prepares each instruction for evaluation within the schema instance at instancePath.
+func (tis *transformInstructions) compile(instancePath string, format InputFormat) error {
+	for _, instruction := range tis.From {
+		if err := instruction.compile(instancePath, format); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // replaceJSONPathPrefix will switch old for new in the path of the transform instructions if the path starts with
@@ -268,6 +960,34 @@ func (tis *transformInstructions) replaceJSONPathPrefix(old, new string) {
 		if strings.HasPrefix(instruction.xmlPath, old) {
 			instruction.xmlPath = strings.Replace(instruction.xmlPath, old, new, 1)
 		}
+		instruction.expr = replaceExprPathPrefix(instruction.expr, old, new)
+		instruction.when = replaceExprPathPrefix(instruction.when, old, new)
+		for name, path := range instruction.bindings {
+			if strings.HasPrefix(path, old) {
+				instruction.bindings[name] = strings.Replace(path, old, new, 1)
+			}
+		}
+		for i, path := range instruction.inputPaths {
+			if strings.HasPrefix(path, old) {
+				instruction.inputPaths[i] = strings.Replace(path, old, new, 1)
+			}
+		}
+	}
+}
+
+// replacePathAnchor will switch each use of the path anchor for path in the JSONPaths and expressions of the transform
+// instructions.
+func (tis *transformInstructions) replacePathAnchor(anchor, path string) {
+	for _, instruction := range tis.From {
+		instruction.jsonPath = replacePathAnchor(instruction.jsonPath, anchor, path)
+		instruction.expr = replacePathAnchor(instruction.expr, anchor, path)
+		instruction.when = replacePathAnchor(instruction.when, anchor, path)
+		for name, binding := range instruction.bindings {
+			instruction.bindings[name] = replacePathAnchor(binding, anchor, path)
+		}
+		for i, inputPath := range instruction.inputPaths {
+			instruction.inputPaths[i] = replacePathAnchor(inputPath, anchor, path)
+		}
 	}
 }
 
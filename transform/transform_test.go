@@ -3,9 +3,11 @@ package transform
 import (
 	"encoding/json"
 	"log"
+	"math"
 	"os"
 	"reflect"
 	"testing"
+	"text/template"
 )
 
 var (
@@ -39,7 +41,7 @@ func TestTransformInstruction(t *testing.T) {
 	tests := []struct {
 		description string
 		ti          transformInstruction
-		format      inputFormat
+		format      InputFormat
 		in          interface{}
 		want        interface{}
 		wantErr     bool
@@ -48,9 +50,9 @@ func TestTransformInstruction(t *testing.T) {
 			description: "Simple Instruction",
 			ti: transformInstruction{
 				jsonPath:   "$.group1.item1.itemA",
-				Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+				Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "out",
 		},
@@ -58,12 +60,12 @@ func TestTransformInstruction(t *testing.T) {
 			description: "Chained operations",
 			ti: transformInstruction{
 				jsonPath: "$.group1.item1.itemA",
-				Operations: []transformOperation{
+				Operations: []Operation{
 					&testOp{args: map[string]string{"out": "out"}},
 					&testOp{args: map[string]string{"out": "out2"}},
 				},
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "out2",
 		},
@@ -72,9 +74,9 @@ func TestTransformInstruction(t *testing.T) {
 			in:          testRaw,
 			ti: transformInstruction{
 				jsonPath:   "$.group1.item10.itemA",
-				Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+				Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 			},
-			format: jsonInput,
+			format: JSONInput,
 			want:   nil,
 		},
 		{
@@ -82,15 +84,15 @@ func TestTransformInstruction(t *testing.T) {
 			in:          testRaw,
 			ti: transformInstruction{
 				jsonPath:   "$.group1.item1.itemA",
-				Operations: []transformOperation{&testOp{fail: true}},
+				Operations: []Operation{&testOp{fail: true}},
 			},
-			format:  jsonInput,
+			format:  JSONInput,
 			wantErr: true,
 		},
 	}
 
 	for _, test := range tests {
-		got, err := test.ti.transform(test.in, "string", nil, test.format)
+		got, err := test.ti.transform(test.in, "string", nil, test.format, nil)
 
 		switch {
 		case test.wantErr && err != nil:
@@ -110,7 +112,8 @@ func TestTransformInstructions(t *testing.T) {
 	tests := []struct {
 		description string
 		tis         transformInstructions
-		format      inputFormat
+		format      InputFormat
+		fieldType   string
 		in          interface{}
 		want        interface{}
 		wantErr     bool
@@ -121,12 +124,12 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group1.item1.itemA",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 					},
 				},
 				Method: first,
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "out",
 		},
@@ -136,16 +139,16 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group1.item1.itemA",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 					},
 					{
 						jsonPath:   "$.group3[1]",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out2"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
 					},
 				},
 				Method: first,
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "out",
 		},
@@ -155,16 +158,16 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group1.item1.itemA",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 					},
 					{
 						jsonPath:   "$.group3[1]",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out2"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
 					},
 				},
 				Method: last,
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "out2",
 		},
@@ -174,16 +177,16 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group1.item1.itemA",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 					},
 					{
 						jsonPath:   "$.group3[1]",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out2"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
 					},
 				},
 				Method: concatenate,
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "outout2",
 		},
@@ -193,11 +196,11 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group1.item1.itemA",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 					},
 					{
 						jsonPath:   "$.group3[1]",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out2"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
 					},
 				},
 				Method: concatenate,
@@ -205,7 +208,7 @@ func TestTransformInstructions(t *testing.T) {
 					ConcatenateDelimiter: "/",
 				},
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "out/out2",
 		},
@@ -215,14 +218,14 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group1.item1.itemA",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 					},
 					{
 						jsonPath: "$.group3[5]",
 					},
 					{
 						jsonPath:   "$.group3[1]",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out2"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
 					},
 				},
 				Method: concatenate,
@@ -230,7 +233,7 @@ func TestTransformInstructions(t *testing.T) {
 					ConcatenateDelimiter: "/",
 				},
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "out/out2",
 		},
@@ -253,7 +256,7 @@ func TestTransformInstructions(t *testing.T) {
 					ConcatenateDelimiter: "/",
 				},
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   nil,
 		},
@@ -263,16 +266,16 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group10.item1.itemA",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 					},
 					{
 						jsonPath:   "$.group30[1]",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out2"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
 					},
 				},
 				Method: first,
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   nil,
 		},
@@ -282,16 +285,16 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group10.item1.itemA",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
 					},
 					{
 						jsonPath:   "$.group3[1]",
-						Operations: []transformOperation{&testOp{args: map[string]string{"out": "out2"}}},
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
 					},
 				},
 				Method: first,
 			},
-			format: jsonInput,
+			format: JSONInput,
 			in:     testRaw,
 			want:   "out2",
 		},
@@ -301,19 +304,398 @@ func TestTransformInstructions(t *testing.T) {
 				From: []*transformInstruction{
 					{
 						jsonPath:   "$.group1.item1.itemA",
-						Operations: []transformOperation{&testOp{fail: true}},
+						Operations: []Operation{&testOp{fail: true}},
 					},
 				},
 				Method: first,
 			},
-			format:  jsonInput,
+			format:  JSONInput,
 			in:      testRaw,
 			wantErr: true,
 		},
+		{
+			description: "when - method first",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{
+						jsonPath:   "$.group1.item1.itemA",
+						when:       `$.group2.item2 == "one"`,
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
+					},
+					{
+						jsonPath:   "$.group3[1]",
+						when:       "$.group2.item2",
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
+					},
+				},
+				Method: first,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   "out2",
+		},
+		{
+			description: "when - method last",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{
+						jsonPath:   "$.group1.item1.itemA",
+						when:       "$.group2.item1 < 1",
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
+					},
+					{
+						jsonPath:   "$.group3[1]",
+						when:       "$.missing",
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
+					},
+				},
+				Method: last,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   "out",
+		},
+		{
+			description: "when - method concat",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{
+						jsonPath:   "$.group1.item1.itemA",
+						when:       "len($.group3) == 2",
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
+					},
+					{
+						jsonPath:   "$.group3[1]",
+						when:       `$.group3[?(@ == "item3")]`,
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
+					},
+					{
+						jsonPath:   "$.group3[0]",
+						when:       `!hasPrefix($.group1.item1.itemA, "B")`,
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out3"}}},
+					},
+				},
+				Method: concatenate,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   "outout3",
+		},
+		{
+			description: "when - nothing matches",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{
+						jsonPath:   "$.group1.item1.itemA",
+						when:       "false",
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out"}}},
+					},
+				},
+				Method: first,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   nil,
+		},
+		{
+			description: "value - method first",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.missing"},
+					{rawValue: json.RawMessage(`"constant"`), value: "constant"},
+				},
+				Method: first,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   "constant",
+		},
+		{
+			description: "value and template - method concat",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`"https://www.example.com/"`), value: "https://www.example.com/"},
+					{
+						template: template.Must(template.New("template").Parse("{{.group}}/{{.item}}")),
+						bindings: map[string]string{"group": "$.group2.item2", "item": "$.group3[0]"},
+					},
+				},
+				Method: concatenate,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   "https://www.example.com/two/item1",
+		},
+		{
+			description: "template with a missing binding - method first",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{
+						template: template.Must(template.New("template").Parse("{{.a}}-{{.b}}")),
+						bindings: map[string]string{"a": "$.group2.item2", "b": "$.missing"},
+					},
+					{
+						template: template.Must(template.New("template").Parse("{{.a}}-{{.b}}")),
+						bindings: map[string]string{"a": "$.group2.item2", "b": "$.group2.item1"},
+					},
+				},
+				Method: first,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   "two-0",
+		},
+		{
+			description: "method concatenate - arrays",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.group3"},
+					{rawValue: json.RawMessage(`["item3"]`), value: []interface{}{"item3"}},
+					{rawValue: json.RawMessage(`"item4"`), value: "item4"},
+				},
+				Method: concatenate,
+			},
+			format:    JSONInput,
+			fieldType: "array",
+			in:        testRaw,
+			want:      []interface{}{"item1", "item2", "item3", "item4"},
+		},
+		{
+			description: "method collect",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.group2.item2"},
+					{jsonPath: "$.missing"},
+					{jsonPath: "$.group3"},
+				},
+				Method: collect,
+			},
+			format:    JSONInput,
+			fieldType: "array",
+			in:        testRaw,
+			want:      []interface{}{"two", []interface{}{"item1", "item2"}},
+		},
+		{
+			description: "method collect - flatten",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.group2.item2"},
+					{jsonPath: "$.group3"},
+				},
+				Method:        collect,
+				MethodOptions: methodOptions{CollectFlatten: true},
+			},
+			format:    JSONInput,
+			fieldType: "array",
+			in:        testRaw,
+			want:      []interface{}{"two", "item1", "item2"},
+		},
+		{
+			description: "method merge",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.group2"},
+					{
+						rawValue: json.RawMessage(`{"item2": "other", "item3": {"a": 1}}`),
+						value:    map[string]interface{}{"item2": "other", "item3": map[string]interface{}{"a": 1.0}},
+					},
+					{
+						rawValue: json.RawMessage(`{"item3": {"b": 2}}`),
+						value:    map[string]interface{}{"item3": map[string]interface{}{"b": 2.0}},
+					},
+				},
+				Method: merge,
+			},
+			format:    JSONInput,
+			fieldType: "object",
+			in:        testRaw,
+			want: map[string]interface{}{
+				"item1": 0.0,
+				"item2": "two",
+				"item3": map[string]interface{}{"a": 1.0, "b": 2.0},
+			},
+		},
+		{
+			description: "method merge - last precedence and appended arrays",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{
+						rawValue: json.RawMessage(`{"a": "first", "list": [1]}`),
+						value:    map[string]interface{}{"a": "first", "list": []interface{}{1.0}},
+					},
+					{
+						rawValue: json.RawMessage(`{"a": "last", "list": [2]}`),
+						value:    map[string]interface{}{"a": "last", "list": []interface{}{2.0}},
+					},
+				},
+				Method:        merge,
+				MethodOptions: methodOptions{MergePrecedence: "last", MergeArrays: "append"},
+			},
+			format:    JSONInput,
+			fieldType: "object",
+			in:        testRaw,
+			want:      map[string]interface{}{"a": "last", "list": []interface{}{1.0, 2.0}},
+		},
+		{
+			description: "method merge - not an object",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.group2"},
+					{jsonPath: "$.group3"},
+				},
+				Method: merge,
+			},
+			format:    JSONInput,
+			fieldType: "object",
+			in:        testRaw,
+			wantErr:   true,
+		},
+		{
+			description: "method sum",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`1.5`), value: 1.5},
+					{jsonPath: "$.missing"},
+					{jsonPath: "$.group2.item1"},
+					{rawValue: json.RawMessage(`2`), value: 2.0},
+				},
+				Method: sum,
+			},
+			format:    JSONInput,
+			fieldType: "number",
+			in:        testRaw,
+			want:      3.5,
+		},
+		{
+			description: "method sum - integer field",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`1`), value: 1.0},
+					{jsonPath: "$.group2.item1"},
+					{rawValue: json.RawMessage(`2`), value: 2.0},
+				},
+				Method: sum,
+			},
+			format:    JSONInput,
+			fieldType: "integer",
+			in:        testRaw,
+			want:      int64(3),
+		},
+		{
+			description: "method sum - integers",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`1`), value: 1},
+					{rawValue: json.RawMessage(`2`), value: int64(2)},
+				},
+				Method: sum,
+			},
+			format:    JSONInput,
+			fieldType: "number",
+			in:        testRaw,
+			want:      int64(3),
+		},
+		{
+			description: "method sum - integer overflow",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`9223372036854775807`), value: int64(math.MaxInt64)},
+					{rawValue: json.RawMessage(`1`), value: 1},
+				},
+				Method: sum,
+			},
+			format:    JSONInput,
+			fieldType: "integer",
+			in:        testRaw,
+			want:      float64(math.MaxInt64) + 1,
+		},
+		{
+			description: "method sum - not a number",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`1.5`), value: 1.5},
+					{jsonPath: "$.group2.item2"},
+				},
+				Method: sum,
+			},
+			format:    JSONInput,
+			fieldType: "any",
+			in:        testRaw,
+			wantErr:   true,
+		},
+		{
+			description: "method sum - ignore invalid",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`1.5`), value: 1.5},
+					{jsonPath: "$.group2.item2"},
+				},
+				Method:        sum,
+				MethodOptions: methodOptions{SumIgnoreInvalid: true},
+			},
+			format:    JSONInput,
+			fieldType: "any",
+			in:        testRaw,
+			want:      1.5,
+		},
+		{
+			description: "method firstNonEmpty",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`""`), value: ""},
+					{rawValue: json.RawMessage(`" "`), value: " "},
+					{jsonPath: "$.group2.item2"},
+				},
+				Method: firstNonEmpty,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   " ",
+		},
+		{
+			description: "method firstNonEmpty - trim and empty objects",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{rawValue: json.RawMessage(`{}`), value: map[string]interface{}{}},
+					{rawValue: json.RawMessage(`" "`), value: " "},
+					{jsonPath: "$.group2"},
+				},
+				Method:        firstNonEmpty,
+				MethodOptions: methodOptions{FirstNonEmptyTrim: true},
+			},
+			format:    JSONInput,
+			fieldType: "any",
+			in:        testRaw,
+			want:      map[string]interface{}{"item1": 0.0, "item2": "two"},
+		},
+		{
+			description: "failed operation skipped",
+			tis: transformInstructions{
+				From: []*transformInstruction{
+					{
+						jsonPath:   "$.group1.item1.itemA",
+						Operations: []Operation{&testOp{fail: true}},
+					},
+					{
+						jsonPath:   "$.group3[1]",
+						Operations: []Operation{&testOp{args: map[string]string{"out": "out2"}}},
+					},
+				},
+				Method:  first,
+				OnError: onErrorSkip,
+			},
+			format: JSONInput,
+			in:     testRaw,
+			want:   "out2",
+		},
 	}
 
 	for _, test := range tests {
-		got, err := test.tis.transform(test.in, "string", nil, test.format)
+		fieldType := test.fieldType
+		if fieldType == "" {
+			fieldType = "string"
+		}
+		got, _, err := test.tis.transform(test.in, fieldType, nil, test.format, nil)
 
 		switch {
 		case test.wantErr && err != nil:
@@ -355,12 +737,94 @@ func TestTransformUnmarshal(t *testing.T) {
 			),
 			want: transform{"cumulo": transformInstructions{
 				From: []*transformInstruction{
-					{jsonPath: "$.data.type", Operations: []transformOperation{}},
+					{jsonPath: "$.data.type", Operations: []Operation{}},
+				},
+				Method: first,
+			},
+			},
+		},
+		{
+			description: "Transform with onError",
+			value:       []byte(`{"cumulo": {"from": [{"jsonPath": "$.data.type"}], "onError": "skip"}}`),
+			want: transform{"cumulo": transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.data.type", Operations: []Operation{}},
+				},
+				Method:  first,
+				OnError: onErrorSkip,
+			},
+			},
+		},
+		{
+			description: "Non-string args are given to the operation as JSON",
+			value:       []byte(`{"cumulo": {"from": [{"jsonPath": "$.data.count", "operations": [{"type": "round", "args": {"precision": 2}}]}]}}`),
+			want: transform{"cumulo": transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.data.count", Operations: []Operation{&round{Args: map[string]string{"precision": "2"}}}},
+				},
+				Method: first,
+			},
+			},
+		},
+		{
+			description: "Structured args",
+			value:       []byte(`{"cumulo": {"from": [{"jsonPath": "$.data.code", "operations": [{"type": "map", "args": {"table": {"1": "one"}}}]}]}}`),
+			want: transform{"cumulo": transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.data.code", Operations: []Operation{&mapValue{Args: map[string]json.RawMessage{"table": json.RawMessage(`{"1": "one"}`)}}}},
+				},
+				Method: first,
+			},
+			},
+		},
+		{
+			description: "Expr transform",
+			value:       []byte(`{"cumulo": {"from": [{"expr": "$.width / $.height"}]}}`),
+			want: transform{"cumulo": transformInstructions{
+				From: []*transformInstruction{
+					{expr: "$.width / $.height", Operations: []Operation{}},
+				},
+				Method: first,
+			},
+			},
+		},
+		{
+			description: "Expr with a jsonPath",
+			value:       []byte(`{"cumulo": {"from": [{"expr": "$.width / $.height", "jsonPath": "$.width"}]}}`),
+			wantErr:     true,
+		},
+		{
+			description: "Value and template transforms",
+			value:       []byte(`{"cumulo": {"from": [{"value": {"a": [1]}}, {"template": "{{.id}}", "bindings": {"id": "$.id"}}]}}`),
+			want: transform{"cumulo": transformInstructions{
+				From: []*transformInstruction{
+					{Operations: []Operation{}, value: map[string]interface{}{"a": []interface{}{1.0}}, rawValue: json.RawMessage(`{"a": [1]}`)},
+					{Operations: []Operation{}, template: template.Must(template.New("template").Option("missingkey=error").Parse("{{.id}}")), bindings: map[string]string{"id": "$.id"}},
 				},
 				Method: first,
 			},
 			},
 		},
+		{
+			description: "Value with a template",
+			value:       []byte(`{"cumulo": {"from": [{"value": 1, "template": "{{.id}}"}]}}`),
+			wantErr:     true,
+		},
+		{
+			description: "Bindings without a template",
+			value:       []byte(`{"cumulo": {"from": [{"jsonPath": "$.id", "bindings": {"id": "$.id"}}]}}`),
+			wantErr:     true,
+		},
+		{
+			description: "Invalid template",
+			value:       []byte(`{"cumulo": {"from": [{"template": "{{.id"}]}}`),
+			wantErr:     true,
+		},
+		{
+			description: "Unknown onError",
+			value:       []byte(`{"cumulo": {"from": [{"jsonPath": "$.data.type"}], "onError": "ignore"}}`),
+			wantErr:     true,
+		},
 		{
 			description: "Basic transform, last method",
 			value: []byte(`
@@ -377,7 +841,7 @@ func TestTransformUnmarshal(t *testing.T) {
 			),
 			want: transform{"cumulo": transformInstructions{
 				From: []*transformInstruction{
-					{jsonPath: "$.data.type", Operations: []transformOperation{}},
+					{jsonPath: "$.data.type", Operations: []Operation{}},
 				},
 				Method: last,
 			},
@@ -399,7 +863,7 @@ func TestTransformUnmarshal(t *testing.T) {
 			),
 			want: transform{"cumulo": transformInstructions{
 				From: []*transformInstruction{
-					{jsonPath: "$.data.type", Operations: []transformOperation{}},
+					{jsonPath: "$.data.type", Operations: []Operation{}},
 				},
 				Method: concatenate,
 			},
@@ -424,7 +888,7 @@ func TestTransformUnmarshal(t *testing.T) {
 			),
 			want: transform{"cumulo": transformInstructions{
 				From: []*transformInstruction{
-					{jsonPath: "$.data.type", Operations: []transformOperation{}},
+					{jsonPath: "$.data.type", Operations: []Operation{}},
 				},
 				Method: concatenate,
 				MethodOptions: methodOptions{
@@ -433,6 +897,26 @@ func TestTransformUnmarshal(t *testing.T) {
 			},
 			},
 		},
+		{
+			description: "Basic transform, merge method with options",
+			value:       []byte(`{"cumulo": {"from": [{"jsonPath": "$.data"}], "method": "merge", "methodOptions": {"mergePrecedence": "last", "mergeArrays": "append"}}}`),
+			want: transform{"cumulo": transformInstructions{
+				From: []*transformInstruction{
+					{jsonPath: "$.data", Operations: []Operation{}},
+				},
+				Method: merge,
+				MethodOptions: methodOptions{
+					MergePrecedence: "last",
+					MergeArrays:     "append",
+				},
+			},
+			},
+		},
+		{
+			description: "Unknown mergePrecedence",
+			value:       []byte(`{"cumulo": {"from": [{"jsonPath": "$.data"}], "method": "merge", "methodOptions": {"mergePrecedence": "newest"}}}`),
+			wantErr:     true,
+		},
 		{
 			description: "Two options",
 			value: []byte(`
@@ -456,13 +940,13 @@ func TestTransformUnmarshal(t *testing.T) {
 			want: transform{
 				"cumulo": transformInstructions{
 					From: []*transformInstruction{
-						{jsonPath: "$.data.mobileBody[*]", Operations: []transformOperation{}},
+						{jsonPath: "$.data.mobileBody[*]", Operations: []Operation{}},
 					},
 					Method: first,
 				},
 				"presentationv4": transformInstructions{
 					From: []*transformInstruction{
-						{jsonPath: "$.mobileBody[*]", Operations: []transformOperation{}},
+						{jsonPath: "$.mobileBody[*]", Operations: []Operation{}},
 					},
 					Method: first,
 				},
@@ -490,9 +974,9 @@ func TestTransformUnmarshal(t *testing.T) {
 			want: transform{
 				"presentationv4": transformInstructions{
 					From: []*transformInstruction{
-						{jsonPath: "$.associatedAssetId", Operations: []transformOperation{}},
-						{jsonPath: "$._attributes.AssociatedAssetId", Operations: []transformOperation{}},
-						{jsonPath: "$._attributes.associatedassetid", Operations: []transformOperation{}},
+						{jsonPath: "$.associatedAssetId", Operations: []Operation{}},
+						{jsonPath: "$._attributes.AssociatedAssetId", Operations: []Operation{}},
+						{jsonPath: "$._attributes.associatedassetid", Operations: []Operation{}},
 					},
 					Method: first,
 				},
@@ -554,8 +1038,8 @@ func TestTransformUnmarshal(t *testing.T) {
 			want: transform{
 				"cumulo": transformInstructions{
 					From: []*transformInstruction{
-						{jsonPath: "$.data.renditions[*]", Operations: []transformOperation{
-							&max{Args: map[string]string{"by": "@.encodingRate", "return": "@.url"}},
+						{jsonPath: "$.data.renditions[*]", Operations: []Operation{
+							&aggregate{kind: "max", Args: map[string]string{"by": "@.encodingRate", "return": "@.url"}},
 							&replace{Args: map[string]string{"regex": `(http://.*net)/`, "new": "https://media.gannett-cdn.com"}},
 						}},
 					},
@@ -563,7 +1047,7 @@ func TestTransformUnmarshal(t *testing.T) {
 				},
 				"presentationv4": transformInstructions{
 					From: []*transformInstruction{
-						{jsonPath: "$.renditions[*]", Operations: []transformOperation{
+						{jsonPath: "$.renditions[*]", Operations: []Operation{
 							&changeCase{Args: map[string]string{"to": "lower"}},
 							&inverse{},
 							&split{Args: map[string]string{"on": "|"}},
@@ -4,9 +4,11 @@ package transform
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"strconv"
 	"strings"
 
@@ -17,12 +19,12 @@ import (
 	"github.com/buger/jsonparser"
 )
 
-// inputFormat denotes the type of transform to perfrom, the options are 'JSON' or 'XML'
-type inputFormat string
+// InputFormat denotes the type of transform to perfrom, the options are 'JSON' or 'XML'
+type InputFormat string
 
 const (
-	jsonInput = inputFormat("JSON")
-	xmlInput  = inputFormat("XML")
+	JSONInput = InputFormat("JSON")
+	XMLInput  = InputFormat("XML")
 )
 
 // JSONTransformer - a type implemented by the jstransform.Transformer
@@ -32,37 +34,77 @@ type JSONTransformer interface {
 
 // Transformer uses a JSON schema and the transform sections within it to take a set of JSON and transform it to
 // matching the schema.
+// A Transformer is immutable once created so a single Transformer can be shared by many goroutines.
 // More details on the transform section of the schema are found at
 // https://github.com/GannettDigital/jstransform/blob/master/transform.adoc
 type Transformer struct {
 	schema              *jsonschema.Schema
 	transformIdentifier string // Used to select the proper transform Instructions
 	root                instanceTransformer
-	format              inputFormat
+	format              InputFormat
+	operations          *OperationRegistry
+	validation          ValidationMode
+	logger              *log.Logger
+	strict              bool
+	indentPrefix        string
+	indent              string
+	limits              Limits
+	lookupFiles         map[string]string
 }
 
 // NewTransformer returns a Transformer using the schema given.
 // The transformIdentifier is used to select the appropriate transform section from the schema.
 // It expects the transforms to be performed on JSON data
 func NewTransformer(schema *jsonschema.Schema, tranformIdentifier string) (*Transformer, error) {
-	return newTransformer(schema, tranformIdentifier, jsonInput)
+	return NewTransformerWithOptions(schema, tranformIdentifier)
+}
+
+// NewTransformerWithOperations returns a Transformer like NewTransformer but the operations in the transform sections
+// are looked up in the given registry, allowing operations to be added or overridden for this Transformer only.
+func NewTransformerWithOperations(schema *jsonschema.Schema, tranformIdentifier string, operations *OperationRegistry) (*Transformer, error) {
+	return NewTransformerWithOptions(schema, tranformIdentifier, WithOperations(operations))
 }
 
 // NewXMLTransformer returns a Transformer using the schema given.
 // The transformIdentifier is used to select the appropriate transform section from the schema.
 // It expects the transforms to be performed on XML data
 func NewXMLTransformer(schema *jsonschema.Schema, tranformIdentifier string) (*Transformer, error) {
-	return newTransformer(schema, tranformIdentifier, xmlInput)
+	return NewTransformerWithOptions(schema, tranformIdentifier, WithInputFormat(XMLInput))
+}
+
+// NewXMLTransformerWithOperations returns a Transformer like NewXMLTransformer but the operations in the transform
+// sections are looked up in the given registry, allowing operations to be added or overridden for this Transformer
+// only.
+func NewXMLTransformerWithOperations(schema *jsonschema.Schema, tranformIdentifier string, operations *OperationRegistry) (*Transformer, error) {
+	return NewTransformerWithOptions(schema, tranformIdentifier, WithInputFormat(XMLInput), WithOperations(operations))
 }
 
-func newTransformer(schema *jsonschema.Schema, tranformIdentifier string, format inputFormat) (*Transformer, error) {
-	tr := &Transformer{schema: schema, transformIdentifier: tranformIdentifier, format: format}
+// NewTransformerWithOptions returns a Transformer using the schema given configured by the options.
+// The transformIdentifier is used to select the appropriate transform section from the schema.
+// Without any options it is the same as NewTransformer.
+func NewTransformerWithOptions(schema *jsonschema.Schema, tranformIdentifier string, options ...Option) (*Transformer, error) {
+	tr := &Transformer{schema: schema, transformIdentifier: tranformIdentifier, format: JSONInput}
+	for _, option := range options {
+		option(tr)
+	}
+	if tr.format != JSONInput && tr.format != XMLInput {
+		return nil, fmt.Errorf("unknown transform type %s, must be 'JSON' or 'XML'", tr.format)
+	}
+
+	if len(tr.lookupFiles) > 0 {
+		lookups, err := loadLookupFiles(tr.lookupFiles)
+		if err != nil {
+			return nil, err
+		}
+		tr.operations = withLookups(tr.operations, lookups)
+	}
+
 	emptyJSON := []byte(`{}`)
 	var err error
 	if schema.Properties != nil {
-		tr.root, err = newObjectTransformer("$", tranformIdentifier, emptyJSON, format)
+		tr.root, err = newObjectTransformer("$", tranformIdentifier, emptyJSON, tr.format, tr.operations)
 	} else if schema.Items != nil {
-		tr.root, err = newArrayTransformer("$", tranformIdentifier, emptyJSON, format)
+		tr.root, err = newArrayTransformer("$", tranformIdentifier, emptyJSON, tr.format, tr.operations)
 	} else {
 		return nil, errors.New("no Properties nor Items found for schema")
 	}
@@ -86,69 +128,181 @@ func newTransformer(schema *jsonschema.Schema, tranformIdentifier string, format
 // Errors are returned for failures to perform operations but are not returned for empty fields which are either
 // omitted from the output or set to an empty value.
 //
-// Validation of the output against the schema is the final step in the process.
+// Validation of the output against the schema is the final step in the process, if the output is invalid a
+// *ValidationError is returned detailing each violation.
+//
+// Transform is safe for concurrent use by multiple goroutines.
 func (tr *Transformer) Transform(raw json.RawMessage) (json.RawMessage, error) {
-	if tr.format == jsonInput {
-		return tr.jsonTransform(raw)
-	}
-	if tr.format == xmlInput {
-		return tr.xmlTransform(raw)
+	return tr.TransformContext(context.Background(), raw)
+}
+
+// TransformContext is Transform with a context, the transform stops with the context error if the context is done
+// before it completes. The context is checked between the transforms of each field and array item.
+//
+// If any of the Limits configured with WithLimits are exceeded the returned error wraps a *LimitError.
+func (tr *Transformer) TransformContext(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
+	return tr.transformRaw(raw, tr.newState(ctx))
+}
+
+// TransformPartial is TransformContext except a field which fails to transform, for example an operation failing on a
+// malformed value, doesn't stop the transform. The field is left at its schema default and the failure is returned
+// as a FieldError alongside the rest of the output.
+//
+// Other failures, including exceeding a limit, a canceled context or, depending on the validation mode, the output
+// failing validation, still return an error along with any field errors up to that point.
+func (tr *Transformer) TransformPartial(ctx context.Context, raw json.RawMessage) (json.RawMessage, []*FieldError, error) {
+	state := tr.newState(ctx)
+	state.partial = true
+	out, err := tr.transformRaw(raw, state)
+	if err != nil {
+		return nil, state.fieldErrors, err
 	}
-	return nil, fmt.Errorf("unknown transform type %s, must be 'JSON' or 'XML'", tr.format)
+	return out, state.fieldErrors, nil
 }
 
-func (tr *Transformer) jsonTransform(raw json.RawMessage) (json.RawMessage, error) {
-	var in interface{}
-	if err := json.Unmarshal(raw, &in); err != nil {
-		return nil, fmt.Errorf("failed to parse input JSON: %v", err)
+// transformRaw decodes, transforms and marshals the raw input with the given state.
+func (tr *Transformer) transformRaw(raw json.RawMessage, state *transformState) (json.RawMessage, error) {
+	if tr.format != JSONInput && tr.format != XMLInput {
+		return nil, fmt.Errorf("unknown transform type %s, must be 'JSON' or 'XML'", tr.format)
+	}
+	if err := tr.limits.checkInputBytes(len(raw)); err != nil {
+		return nil, err
 	}
 
-	transformed, err := tr.root.transform(in, nil)
+	decode := tr.decoder(raw)
+	in, err := decode()
 	if err != nil {
-		return nil, fmt.Errorf("failed transformation: %v", err)
+		return nil, err
 	}
 
-	out, err := json.Marshal(transformed)
+	transformed, err := tr.transformDecoded(in, state)
 	if err != nil {
-		return nil, fmt.Errorf("failed to JSON marsal transformed data: %v", err)
+		return nil, err
 	}
 
-	valid, err := tr.schema.Validate(out)
-	if err != nil {
-		return nil, fmt.Errorf("transformed result validation error: %v", err)
+	return tr.marshal(transformed, decode)
+}
+
+// decoder returns a function which decodes the raw input according to the input format. Each call returns a new
+// copy of the decoded input.
+func (tr *Transformer) decoder(raw []byte) func() (interface{}, error) {
+	if tr.format == XMLInput {
+		return func() (interface{}, error) {
+			xmlDoc, err := xmlquery.Parse(bytes.NewReader(raw))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse input XML: %v", err)
+			}
+			return xmlDoc, nil
+		}
 	}
-	if !valid {
-		return nil, errors.New("schema validation of the transformed result reports invalid")
+	return func() (interface{}, error) {
+		var in interface{}
+		if err := json.Unmarshal(raw, &in); err != nil {
+			return nil, fmt.Errorf("failed to parse input JSON: %v", err)
+		}
+		return in, nil
 	}
-
-	return out, nil
 }
 
-func (tr *Transformer) xmlTransform(raw []byte) ([]byte, error) {
-	xmlDoc, err := xmlquery.Parse(bytes.NewReader(raw))
+// transformDecoded runs the transform on the decoded input with the given state, for JSON input the input may be modified.
+func (tr *Transformer) transformDecoded(in interface{}, state *transformState) (interface{}, error) {
+	if err := tr.limits.checkDepth(in); err != nil {
+		return nil, err
+	}
+	transformed, err := tr.root.transform(in, nil, state)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse input XML: %v", err)
+		return nil, fmt.Errorf("failed transformation: %w", err)
 	}
+	return transformed, nil
+}
+
+// newState returns the state for a new transform.
+func (tr *Transformer) newState(ctx context.Context) *transformState {
+	return &transformState{strict: tr.strict, ctx: ctx, limits: tr.limits}
+}
 
-	transformed, err := tr.root.transform(xmlDoc, nil)
+// marshal converts the transformed value to JSON and validates it according to the validation mode.
+// The decode function returns a new copy of the decoded input, it is used to find the sources of any validation
+// violations.
+func (tr *Transformer) marshal(transformed interface{}, decode func() (interface{}, error)) (json.RawMessage, error) {
+	var (
+		out json.RawMessage
+		err error
+	)
+	if tr.indent != "" || tr.indentPrefix != "" {
+		out, err = json.MarshalIndent(transformed, tr.indentPrefix, tr.indent)
+	} else {
+		out, err = json.Marshal(transformed)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed transformation: %v", err)
+		return nil, fmt.Errorf("failed to JSON marshal transformed data: %v", err)
 	}
 
-	out, err := json.Marshal(transformed)
-	if err != nil {
-		return nil, fmt.Errorf("failed to JSON marsal transformed data: %v", err)
+	if err := tr.checkValidation(out, decode); err != nil {
+		return nil, err
 	}
+	return out, nil
+}
 
+// checkValidation validates the JSON output according to the validation mode, returning an error only if the
+// output is invalid and validation is on.
+func (tr *Transformer) checkValidation(out json.RawMessage, decode func() (interface{}, error)) error {
+	switch tr.validation {
+	case ValidationOff:
+	case ValidationLogOnly:
+		if err := tr.validate(out, decode); err != nil {
+			tr.logf("jstransform: %v", err)
+		}
+	default:
+		return tr.validate(out, decode)
+	}
+	return nil
+}
+
+// logf logs to the configured logger or the standard logger if none is configured.
+func (tr *Transformer) logf(format string, v ...interface{}) {
+	if tr.logger != nil {
+		tr.logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// validate checks the transformed output against the schema. If it is invalid a *ValidationError is returned
+// detailing each violation, to find the source of each violation the decoded input is transformed again recording
+// the sources.
+func (tr *Transformer) validate(out json.RawMessage, decode func() (interface{}, error)) error {
 	valid, err := tr.schema.Validate(out)
+	var schemaErr *jsonschema.ValidationError
+	if errors.As(err, &schemaErr) {
+		return tr.validationError(schemaErr, decode)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("transformed result validation error: %v", err)
+		return fmt.Errorf("transformed result validation error: %v", err)
 	}
 	if !valid {
-		return nil, errors.New("schema validation of the transformed result reports invalid")
+		return errors.New("schema validation of the transformed result reports invalid")
 	}
+	return nil
+}
 
-	return out, nil
+// validationError builds a ValidationError for the schema violations adding in the source path of each.
+func (tr *Transformer) validationError(schemaErr *jsonschema.ValidationError, decode func() (interface{}, error)) error {
+	state := tr.newState(context.Background())
+	state.sources = make(map[string]string)
+	// the output may be from a partial transform so any failed fields are skipped here too
+	state.partial = true
+
+	if in, err := decode(); err == nil {
+		// the transform succeeded the first time so any error here is ignored, it just means no sources are found
+		_, _ = tr.root.transform(in, nil, state)
+	}
+
+	verr := &ValidationError{Violations: make([]Violation, len(schemaErr.Violations))}
+	for i, v := range schemaErr.Violations {
+		verr.Violations[i] = Violation{Violation: v, SourcePath: state.sources[v.Pointer]}
+	}
+	return verr
 }
 
 // findParent walks the instanceTransformer tree to find the parent of the given path
@@ -185,11 +339,11 @@ func (tr *Transformer) walker(path string, value json.RawMessage) error {
 	var iTransformer instanceTransformer
 	switch instanceType {
 	case "object":
-		iTransformer, err = newObjectTransformer(path, tr.transformIdentifier, value, tr.format)
+		iTransformer, err = newObjectTransformer(path, tr.transformIdentifier, value, tr.format, tr.operations)
 	case "array":
-		iTransformer, err = newArrayTransformer(path, tr.transformIdentifier, value, tr.format)
+		iTransformer, err = newArrayTransformer(path, tr.transformIdentifier, value, tr.format, tr.operations)
 	default:
-		iTransformer, err = newScalarTransformer(path, tr.transformIdentifier, value, instanceType, tr.format)
+		iTransformer, err = newScalarTransformer(path, tr.transformIdentifier, value, instanceType, tr.format, tr.operations)
 	}
 	if err != nil {
 		return fmt.Errorf("failed to initialize transformer: %v", err)
@@ -1,10 +1,15 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/GannettDigital/jstransform/jsonschema"
@@ -18,6 +23,8 @@ var (
 	operationsSchema, _      = jsonschema.SchemaFromFile("./test_data/operations.json", "")
 	dateTimesSchema, _       = jsonschema.SchemaFromFile("./test_data/date-times.json", "")
 	frontSchema, _           = jsonschema.SchemaFromFile("./test_data/front.json", "")
+	lastAndDefaultsSchema, _ = jsonschema.SchemaFromFile("./test_data/last-and-defaults.json", "")
+	sourcesSchema, _         = jsonschema.SchemaFromFile("./test_data/sources.json", "")
 
 	transformerTests = []struct {
 		description         string
@@ -119,13 +126,46 @@ var (
 								"contributors": [
 									{"id": 1, "fullname": "one"},
 									{"id": 2, "fullname": "two"}
+								],
+								"assetBase": "https://www.example.com/assets/",
+								"caption": "Caption",
+								"altText": "Alt text",
+								"images": [
+									{"path": "a.jpg?utm_source=feed&w=100"},
+									{"path": "//cdn.example.com/b.jpg"},
+									{"path": "/c.jpg", "host": "http://img.example.com"}
 								]
 							},
 							"mixedCase": "a|B|c|D",
+							"promo": {"title": "Promo", "enabled": false},
 							"invalid": false,
 							"url": "http://foo.com/blah"
 						}`),
-			want: json.RawMessage(`{"caseSplit":["a","b","c","d"],"contributor":"two","duration":13,"url":"http://gannettdigital.com/blah","valid":true}`),
+			want: json.RawMessage(`{"caseSplit":["a","b","c","d"],"contributor":"two","duration":13,"headline":"Alt text","images":[{"local":false,"thumbnail":"a.jpg?utm_source=feed\u0026w=100#thumb","url":"https://www.example.com/assets/a.jpg?w=100"},{"local":false,"thumbnail":"//cdn.example.com/b.jpg#thumb","url":"https://cdn.example.com/b.jpg"},{"local":true,"thumbnail":"/c.jpg#thumb","url":"http://img.example.com/c.jpg"}],"summary":"image: 3 images","url":"http://gannettdigital.com/blah","valid":true}`),
+		},
+		{
+			description:         "Value and template sources",
+			schema:              sourcesSchema,
+			transformIdentifier: "cumulo",
+			in: json.RawMessage(`
+						{
+							"type": "video",
+							"data": {
+								"id": 42,
+								"contributors": [
+									{"name": "Jane", "role": "producer"},
+									{"name": "John"}
+								]
+							}
+						}`),
+			want: json.RawMessage(`{"canonicalUrl":"https://www.example.com/videos/42","credits":[{"credit":"Jane (producer)"},{"credit":"John"}],"source":"feed","tags":["untagged"]}`),
+		},
+		{
+			description:         "Value and template sources, template without bindings found",
+			schema:              sourcesSchema,
+			transformIdentifier: "cumulo",
+			in:                  json.RawMessage(`{"type": "video", "data": {"tags": ["a", "b"]}}`),
+			want:                json.RawMessage(`{"canonicalUrl":"https://www.example.com/","source":"feed","tags":["a","b"]}`),
 		},
 		{
 			description:         "Test empty non-required object",
@@ -184,7 +224,8 @@ var (
 						"double": [
 							["1-1", "1-2"],
 							["2-1", "2-2"]
-						]
+						],
+						"label": "doubles"
 					},
 					"array1": [
 						{
@@ -208,7 +249,7 @@ var (
 						}
 					]
 				}`),
-			want: json.RawMessage(`{"array1":[{"array2":[{"level2Name":"array1-1-1"},{"level2Name":"array1-1-2"}],"level1Name":"array1-1"},{"array2":[{"level2Name":"array1-2-1"}],"level1Name":"array1-2"}],"double":[["1-1","1-2"],["2-1","2-2"]]}`),
+			want: json.RawMessage(`{"array1":[{"array2":[{"label":"doubles","level2Name":"array1-1-1","parentName":"array1-1","position":"0.0","rank":1},{"label":"doubles","level2Name":"array1-1-2","parentName":"array1-1","position":"0.1","rank":2}],"level1Index":0,"level1Name":"array1-1"},{"array2":[{"label":"doubles","level2Name":"array1-2-1","parentName":"array1-2","position":"1.0","rank":11}],"level1Index":1,"level1Name":"array1-2"}],"double":[["1-1","1-2"],["2-1","2-2"]]}`),
 		},
 		{
 			description:         "Test format: date-time strings",
@@ -241,6 +282,28 @@ var (
 						}`),
 			want: json.RawMessage(`{"attributes":[{"canonicalURL":"canURL","frontListModulePosition":"frontlistmoduleposition"}],"ogImage":"testOGIMAGE"}`),
 		},
+		{
+			description:         "Test method last and defaults with children",
+			schema:              lastAndDefaultsSchema,
+			transformIdentifier: "cumulo",
+			in: json.RawMessage(`
+						{
+							"headline": "headline",
+							"title": "title",
+							"id": "1"
+						}`),
+			want: json.RawMessage(`{"meta":{"id":"1","source":"unknown"},"tags":[{"id":"1","name":"default"}],"title":"title"}`),
+		},
+		{
+			description:         "Test method last and defaults without children",
+			schema:              lastAndDefaultsSchema,
+			transformIdentifier: "cumulo",
+			in: json.RawMessage(`
+						{
+							"headline": "headline"
+						}`),
+			want: json.RawMessage(`{"meta":{"source":"unknown"},"tags":[{"name":"default"}],"title":"headline"}`),
+		},
 	}
 
 	saveValueTests = []struct {
@@ -380,6 +443,65 @@ var (
 	}
 )
 
+// xmlTransformerTests are used for the XML Transformer tests
+var xmlTransformerTests = []struct {
+	description         string
+	transformIdentifier string
+	schemaFilePath      string
+	xmlFilePath         string
+	wantFilePath        string
+}{
+	{
+		description:         "teams NBA",
+		transformIdentifier: "sport",
+		schemaFilePath:      "./test_data/xml/sports/teams/teams.json",
+		xmlFilePath:         "./test_data/xml/sports/teams/teams_NBA.xml",
+		wantFilePath:        "./test_data/xml/sports/teams/teamsNBA.out.json",
+	},
+	{
+		description:         "teams MLB",
+		transformIdentifier: "sport",
+		schemaFilePath:      "./test_data/xml/sports/teams/teams.json",
+		xmlFilePath:         "./test_data/xml/sports/teams/teams_MLB.xml",
+		wantFilePath:        "./test_data/xml/sports/teams/teamsMLB.out.json",
+	},
+	{
+		description:         "array-transforms",
+		transformIdentifier: "sport",
+		schemaFilePath:      "./test_data/xml/array-transforms.json",
+		xmlFilePath:         "./test_data/xml/array-transforms.xml",
+		wantFilePath:        "./test_data/xml/array-transforms.out.json",
+	},
+	{
+		description:         "multiple-array-transforms",
+		transformIdentifier: "sport",
+		schemaFilePath:      "./test_data/xml/multiple-arrays.json",
+		xmlFilePath:         "./test_data/xml/multiple-arrays.xml",
+		wantFilePath:        "./test_data/xml/multiple-arrays.out.json",
+	},
+	{
+		description:         "conversion-transforms",
+		transformIdentifier: "sport",
+		schemaFilePath:      "./test_data/xml/conversion-transforms.json",
+		xmlFilePath:         "./test_data/xml/conversion-transforms.xml",
+		wantFilePath:        "./test_data/xml/conversion-transforms.out.json",
+	},
+	{
+		description:         "attribute-selection",
+		transformIdentifier: "sport",
+		schemaFilePath:      "./test_data/xml/attribute-selection.json",
+		xmlFilePath:         "./test_data/xml/attribute-selection.xml",
+		wantFilePath:        "./test_data/xml/attribute-selection.out.json",
+	},
+	{
+		description:         "operations",
+		transformIdentifier: "sport",
+		schemaFilePath:      "./test_data/xml/operations.json",
+		xmlFilePath:         "./test_data/xml/operations.xml",
+		wantFilePath:        "./test_data/xml/operations.out.json",
+	},
+}
+
 func TestSaveValue(t *testing.T) {
 	for _, test := range saveValueTests {
 		err := saveInTree(test.tree, test.jsonPath, test.value)
@@ -427,66 +549,98 @@ func TestTransformer(t *testing.T) {
 	}
 }
 
-func TestNewXMLTransformer(t *testing.T) {
-	tests := []struct {
-		description         string
+// TestTransformerConcurrency runs many transforms in parallel with a single Transformer per schema, it is most
+// useful when run with the race detector.
+func TestTransformerConcurrency(t *testing.T) {
+	const goroutines = 25
+
+	type transformerKey struct {
+		schema              *jsonschema.Schema
 		transformIdentifier string
-		schemaFilePath      string
-		xmlFilePath         string
-		wantFilePath        string
-	}{
-		{
-			description:         "teams NBA",
-			transformIdentifier: "sport",
-			schemaFilePath:      "./test_data/xml/sports/teams/teams.json",
-			xmlFilePath:         "./test_data/xml/sports/teams/teams_NBA.xml",
-			wantFilePath:        "./test_data/xml/sports/teams/teamsNBA.out.json",
-		},
-		{
-			description:         "teams MLB",
-			transformIdentifier: "sport",
-			schemaFilePath:      "./test_data/xml/sports/teams/teams.json",
-			xmlFilePath:         "./test_data/xml/sports/teams/teams_MLB.xml",
-			wantFilePath:        "./test_data/xml/sports/teams/teamsMLB.out.json",
-		},
-		{
-			description:         "array-transforms",
-			transformIdentifier: "sport",
-			schemaFilePath:      "./test_data/xml/array-transforms.json",
-			xmlFilePath:         "./test_data/xml/array-transforms.xml",
-			wantFilePath:        "./test_data/xml/array-transforms.out.json",
-		},
-		{
-			description:         "multiple-array-transforms",
-			transformIdentifier: "sport",
-			schemaFilePath:      "./test_data/xml/multiple-arrays.json",
-			xmlFilePath:         "./test_data/xml/multiple-arrays.xml",
-			wantFilePath:        "./test_data/xml/multiple-arrays.out.json",
-		},
-		{
-			description:         "conversion-transforms",
-			transformIdentifier: "sport",
-			schemaFilePath:      "./test_data/xml/conversion-transforms.json",
-			xmlFilePath:         "./test_data/xml/conversion-transforms.xml",
-			wantFilePath:        "./test_data/xml/conversion-transforms.out.json",
-		},
-		{
-			description:         "attribute-selection",
-			transformIdentifier: "sport",
-			schemaFilePath:      "./test_data/xml/attribute-selection.json",
-			xmlFilePath:         "./test_data/xml/attribute-selection.xml",
-			wantFilePath:        "./test_data/xml/attribute-selection.out.json",
-		},
-		{
-			description:         "operations",
-			transformIdentifier: "sport",
-			schemaFilePath:      "./test_data/xml/operations.json",
-			xmlFilePath:         "./test_data/xml/operations.xml",
-			wantFilePath:        "./test_data/xml/operations.out.json",
-		},
+	}
+	transformers := make(map[transformerKey]*Transformer)
+	for _, test := range transformerTests {
+		key := transformerKey{schema: test.schema, transformIdentifier: test.transformIdentifier}
+		if _, ok := transformers[key]; ok {
+			continue
+		}
+		tr, err := NewTransformer(test.schema, test.transformIdentifier)
+		if err != nil {
+			t.Fatalf("Test %q - failed to initialize transformer: %v", test.description, err)
+		}
+		transformers[key] = tr
 	}
 
-	for _, test := range tests {
+	xmlTransformers := make([]*Transformer, len(xmlTransformerTests))
+	xmlInputs := make([][]byte, len(xmlTransformerTests))
+	xmlWants := make([]map[string]interface{}, len(xmlTransformerTests))
+	for i, test := range xmlTransformerTests {
+		schema, err := jsonschema.SchemaFromFile(test.schemaFilePath, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if xmlTransformers[i], err = NewXMLTransformer(schema, test.transformIdentifier); err != nil {
+			t.Fatal(err)
+		}
+		if xmlInputs[i], err = ioutil.ReadFile(test.xmlFilePath); err != nil {
+			t.Fatal(err)
+		}
+		want, err := ioutil.ReadFile(test.wantFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(want, &xmlWants[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		for _, test := range transformerTests {
+			wg.Add(1)
+			go func(tr *Transformer, description string, in json.RawMessage, wantErr bool, want json.RawMessage) {
+				defer wg.Done()
+				got, err := tr.Transform(in)
+
+				switch {
+				case wantErr && err != nil:
+					return
+				case wantErr && err == nil:
+					t.Errorf("Test %q - got nil, want error", description)
+				case !wantErr && err != nil:
+					t.Errorf("Test %q - got error, want nil: %v", description, err)
+				case !reflect.DeepEqual(got, want):
+					t.Errorf("Test %q - got\n%s\nwant\n%s", description, got, want)
+				}
+			}(transformers[transformerKey{schema: test.schema, transformIdentifier: test.transformIdentifier}], test.description, test.in, test.wantErr, test.want)
+		}
+
+		for j, test := range xmlTransformerTests {
+			wg.Add(1)
+			go func(tr *Transformer, description string, in []byte, want map[string]interface{}) {
+				defer wg.Done()
+				output, err := tr.Transform(in)
+				if err != nil {
+					t.Errorf("Test %q - got error, want nil: %v", description, err)
+					return
+				}
+
+				var got map[string]interface{}
+				if err := json.Unmarshal(output, &got); err != nil {
+					t.Errorf("Test %q - failed to parse output: %v", description, err)
+					return
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Test %q - got\n%s\nwant\n%v", description, output, want)
+				}
+			}(xmlTransformers[j], test.description, xmlInputs[j], xmlWants[j])
+		}
+	}
+	wg.Wait()
+}
+
+func TestNewXMLTransformer(t *testing.T) {
+	for _, test := range xmlTransformerTests {
 		schema, err := jsonschema.SchemaFromFile(test.schemaFilePath, "")
 		if err != nil {
 			t.Fatal(err)
@@ -529,6 +683,254 @@ func TestNewXMLTransformer(t *testing.T) {
 
 }
 
+func TestTransformerLimits(t *testing.T) {
+	operationsIn := json.RawMessage(`{"type": "image", "data": {"contributors": [{"id": 1, "fullname": "one"}]}, "mixedCase": "a", "url": "http://foo.com/blah"}`)
+	imageIn := json.RawMessage(`{"type": "image", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": 1}, {"height": 2, "path": "path", "relativePath": "", "width": 2}]}`)
+
+	tests := []struct {
+		description string
+		schema      *jsonschema.Schema
+		limits      Limits
+		in          json.RawMessage
+		wantLimit   string
+	}{
+		{
+			description: "Within all limits",
+			schema:      operationsSchema,
+			limits:      Limits{MaxInputBytes: 1000, MaxDepth: 4, MaxArrayLength: 1, MaxRegexWork: 1000},
+			in:          operationsIn,
+		},
+		{
+			description: "Input too large",
+			schema:      operationsSchema,
+			limits:      Limits{MaxInputBytes: 10},
+			in:          operationsIn,
+			wantLimit:   "MaxInputBytes",
+		},
+		{
+			description: "Input nested too deeply",
+			schema:      operationsSchema,
+			limits:      Limits{MaxDepth: 3},
+			in:          operationsIn,
+			wantLimit:   "MaxDepth",
+		},
+		{
+			description: "Array too long",
+			schema:      imageSchema,
+			limits:      Limits{MaxArrayLength: 1},
+			in:          imageIn,
+			wantLimit:   "MaxArrayLength",
+		},
+		{
+			description: "Regex work exceeded",
+			schema:      operationsSchema,
+			limits:      Limits{MaxRegexWork: 50},
+			in:          operationsIn,
+			wantLimit:   "MaxRegexWork",
+		},
+	}
+
+	for _, test := range tests {
+		tr, err := NewTransformerWithOptions(test.schema, "cumulo", WithLimits(test.limits))
+		if err != nil {
+			t.Fatalf("Test %q - failed to initialize transformer: %v", test.description, err)
+		}
+
+		_, err = tr.Transform(test.in)
+
+		var limitErr *LimitError
+		switch {
+		case test.wantLimit == "" && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case test.wantLimit != "" && !errors.As(err, &limitErr):
+			t.Errorf("Test %q - got error %v, want a *LimitError", test.description, err)
+		case test.wantLimit != "" && limitErr.Limit != test.wantLimit:
+			t.Errorf("Test %q - got limit %q exceeded, want %q", test.description, limitErr.Limit, test.wantLimit)
+		}
+	}
+}
+
+// identityOp is an Operation which returns its input, used to replace a built-in operation.
+type identityOp struct{}
+
+func (i *identityOp) Init(args map[string]string) error { return nil }
+
+func (i *identityOp) Transform(in interface{}) (interface{}, error) { return in, nil }
+
+func TestTransformerLookupFiles(t *testing.T) {
+	schema, err := jsonschema.SchemaFromFile("./test_data/lookup.json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	customMap := NewOperationRegistry()
+	customMap.Register("map", func() Operation { return &identityOp{} })
+
+	tests := []struct {
+		description string
+		files       map[string]string
+		operations  *OperationRegistry
+		in          json.RawMessage
+		want        string
+		wantErr     bool
+	}{
+		{
+			description: "Lookup file and inline tables",
+			files:       map[string]string{"leagues": "./test_data/leagues-lookup.json"},
+			in:          json.RawMessage(`{"league": "nfl_sch", "priority": 2, "tags": ["a", "b"]}`),
+			want:        `{"league":"nfl","priority":20,"tags":["alpha","beta"]}`,
+		},
+		{
+			description: "Defaults for unmatched values",
+			files:       map[string]string{"leagues": "./test_data/leagues-lookup.json"},
+			in:          json.RawMessage(`{"league": "MLB_SCH", "priority": "3"}`),
+			want:        `{"league":"unknown","priority":0}`,
+		},
+		{
+			description: "Lookup files with a custom map operation",
+			files:       map[string]string{"leagues": "./test_data/leagues-lookup.json"},
+			operations:  customMap,
+			in:          json.RawMessage(`{"league": "nfl", "priority": 2, "tags": ["a", "b"]}`),
+			want:        `{"league":"nfl","priority":2,"tags":["a","b"]}`,
+		},
+		{
+			description: "Missing lookup file",
+			files:       map[string]string{"leagues": "./test_data/missing.json"},
+			wantErr:     true,
+		},
+		{
+			description: "Lookup file isn't an object",
+			files:       map[string]string{"leagues": "./test_data/xml/operations.xml"},
+			wantErr:     true,
+		},
+		{
+			description: "Unknown lookup table",
+			files:       map[string]string{"teams": "./test_data/leagues-lookup.json"},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		tr, err := NewTransformerWithOptions(schema, "cumulo", WithLookupFiles(test.files), WithOperations(test.operations))
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+			continue
+		case err != nil:
+			t.Errorf("Test %q - failed to initialize transformer: %v", test.description, err)
+			continue
+		}
+
+		got, err := tr.Transform(test.in)
+		switch {
+		case err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case string(got) != test.want:
+			t.Errorf("Test %q - got %s, want %s", test.description, got, test.want)
+		}
+	}
+}
+
+func TestTransformContext(t *testing.T) {
+	tr, err := NewTransformer(imageSchema, "cumulo")
+	if err != nil {
+		t.Fatalf("failed to initialize transformer: %v", err)
+	}
+	in := json.RawMessage(`{"type": "image", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": 1}]}`)
+
+	if _, err := tr.TransformContext(context.Background(), in); err != nil {
+		t.Errorf("got error, want nil: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tr.TransformContext(ctx, in); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestTransformPartial(t *testing.T) {
+	tests := []struct {
+		description     string
+		in              json.RawMessage
+		limits          Limits
+		want            json.RawMessage
+		wantFieldErrors []FieldError
+		wantErr         bool
+	}{
+		{
+			description: "No failures",
+			in:          json.RawMessage(`{"data": {"attributes": [{"name": "length", "value": "00:13"}]}, "mixedCase": "a|B", "url": "http://foo.com/blah"}`),
+			want:        json.RawMessage(`{"caseSplit":["a","b"],"duration":13,"url":"http://gannettdigital.com/blah"}`),
+		},
+		{
+			description: "Failed fields are left out",
+			in:          json.RawMessage(`{"data": {"attributes": [{"name": "length", "value": "1:2:3:4"}]}, "mixedCase": 5, "url": "http://foo.com/blah"}`),
+			want:        json.RawMessage(`{"url":"http://gannettdigital.com/blah"}`),
+			wantFieldErrors: []FieldError{
+				{SchemaPath: "$.caseSplit", SourcePath: "$.mixedCase", Operation: "changeCase"},
+				{SchemaPath: "$.duration", SourcePath: `$.data.attributes[?(@.name=="length")].value`, Operation: "duration"},
+			},
+		},
+		{
+			description: "Limits still fail the transform",
+			in:          json.RawMessage(`{"data": {"attributes": [{"name": "length", "value": "1:2:3:4"}]}, "url": "http://foo.com/blah"}`),
+			limits:      Limits{MaxRegexWork: 10},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		tr, err := NewTransformerWithOptions(operationsSchema, "cumulo", WithLimits(test.limits))
+		if err != nil {
+			t.Fatalf("Test %q - failed to initialize transformer: %v", test.description, err)
+		}
+
+		got, fieldErrors, err := tr.TransformPartial(context.Background(), test.in)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case string(got) != string(test.want):
+			t.Errorf("Test %q - got %s, want %s", test.description, got, test.want)
+		}
+
+		sort.Slice(fieldErrors, func(i, j int) bool { return fieldErrors[i].SchemaPath < fieldErrors[j].SchemaPath })
+		if len(fieldErrors) != len(test.wantFieldErrors) {
+			t.Errorf("Test %q - got %d field errors, want %d: %v", test.description, len(fieldErrors), len(test.wantFieldErrors), fieldErrors)
+			continue
+		}
+		for i, want := range test.wantFieldErrors {
+			got := *fieldErrors[i]
+			if got.Err == nil {
+				t.Errorf("Test %q - field error %d has no underlying error", test.description, i)
+			}
+			got.Err = nil
+			if got != want {
+				t.Errorf("Test %q - got field error %+v, want %+v", test.description, got, want)
+			}
+		}
+	}
+
+	// without partial results the first failure stops the transform
+	tr, err := NewTransformer(operationsSchema, "cumulo")
+	if err != nil {
+		t.Fatalf("failed to initialize transformer: %v", err)
+	}
+	_, err = tr.Transform(json.RawMessage(`{"data": {"attributes": [{"name": "length", "value": "1:2:3:4"}]}}`))
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Operation != "duration" {
+		t.Errorf("got error %v, want a *FieldError for the duration operation", err)
+	}
+}
+
 func BenchmarkTransformer(b *testing.B) {
 	for _, test := range transformerTests {
 		if test.wantErr {
@@ -561,3 +963,63 @@ func BenchmarkSaveInTree(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkTransformerArrays measures transforms of the image and front schemas with inputs having many array items,
+// exercising the binding of array indexes in the compiled JSONPaths.
+func BenchmarkTransformerArrays(b *testing.B) {
+	var crops, attributes []string
+	for i := 0; i < 20; i++ {
+		crops = append(crops, fmt.Sprintf(`{"name": "crop%d", "height": %d, "path": "path%d", "relativePath": "rel%d", "width": %d}`, i, i, i, i, i))
+		attributes = append(attributes, fmt.Sprintf(`{"canonicalurl": "canURL%d", "front-list-module-position": "position%d"}`, i, i))
+	}
+
+	benchmarks := []struct {
+		description         string
+		schema              *jsonschema.Schema
+		transformIdentifier string
+		in                  json.RawMessage
+	}{
+		{
+			description:         "image",
+			schema:              imageSchema,
+			transformIdentifier: "cumulo",
+			in:                  json.RawMessage(`{"type": "image", "crops": [` + strings.Join(crops, ",") + `], "publishUrl": "publishURL", "absoluteUrl": "absoluteURL"}`),
+		},
+		{
+			description:         "front",
+			schema:              frontSchema,
+			transformIdentifier: "frontInput",
+			in:                  json.RawMessage(`{"attributes": [` + strings.Join(attributes, ",") + `], "og:image": "testOGIMAGE"}`),
+		},
+	}
+
+	for _, bm := range benchmarks {
+		tr, err := NewTransformer(bm.schema, bm.transformIdentifier)
+		if err != nil {
+			b.Fatalf("%s - failed to initialize transformer: %v", bm.description, err)
+		}
+		b.Run(bm.description, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := tr.Transform(bm.in); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTransformerMalformedWhen(t *testing.T) {
+	schema, err := jsonschema.SchemaFromFile("./test_data/malformed-when.json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewTransformer(schema, "cumulo")
+	if err == nil {
+		t.Fatal("got nil, want error")
+	}
+	if want := "$.video.title"; !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, want it to name the field %q", err, want)
+	}
+}
@@ -9,12 +9,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/antchfx/xmlquery"
 	"github.com/buger/jsonparser"
 )
 
 var indexRe = regexp.MustCompile(`\[([\d]+)\]`)
 
-// Concat will combine any two arbitrary values, though only strings are supported for non-trivial concatenation.
+// Layouts of the JSON schema date and time formats.
+const (
+	dateFormatLayout      = "2006-01-02"
+	timeFormatLayout      = "15:04:05Z07:00"
+	localTimeFormatLayout = "15:04:05"
+)
+
+// Concat will combine any two arbitrary values, though only strings and arrays are supported for non-trivial
+// concatenation. When either value is an array the other is appended to it, as items if it is also an array.
 func concat(a, b interface{}, delimiter string) (interface{}, error) {
 	switch {
 	case a == nil && b == nil:
@@ -25,6 +34,17 @@ func concat(a, b interface{}, delimiter string) (interface{}, error) {
 		return a, nil
 	}
 
+	aItems, aIsArray := sliceValues(a)
+	bItems, bIsArray := sliceValues(b)
+	switch {
+	case aIsArray && bIsArray:
+		return append(append([]interface{}{}, aItems...), bItems...), nil
+	case aIsArray:
+		return append(append([]interface{}{}, aItems...), b), nil
+	case bIsArray:
+		return append([]interface{}{a}, bItems...), nil
+	}
+
 	atype := reflect.TypeOf(a).String()
 	btype := reflect.TypeOf(b).String()
 	if atype != btype {
@@ -42,6 +62,43 @@ func concat(a, b interface{}, delimiter string) (interface{}, error) {
 	}
 }
 
+// sliceValues returns the items of the value if it is a slice of any type.
+func sliceValues(value interface{}) ([]interface{}, bool) {
+	if items, ok := value.([]interface{}); ok {
+		return items, true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return nil, false
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, true
+}
+
+// deepCopy returns a copy of the value with any nested maps and slices, as created by json.Unmarshal, also copied.
+// Other types are returned as is.
+func deepCopy(value interface{}) interface{} {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		newMap := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			newMap[k] = deepCopy(v)
+		}
+		return newMap
+	case []interface{}:
+		newSlice := make([]interface{}, len(t))
+		for i, v := range t {
+			newSlice[i] = deepCopy(v)
+		}
+		return newSlice
+	default:
+		return value
+	}
+}
+
 // convert takes the raw value and checks to see if it matches the jsonType, if not it will attempt to convert it
 // to the correct type. The function does not set defaults so a nil value will be returned as nil not as the desired
 // types empty type.
@@ -49,6 +106,10 @@ func convert(raw interface{}, jsonType string) (interface{}, error) {
 	if raw == nil {
 		return nil, nil
 	}
+	if isXMLNodes(raw) && jsonType != "object" && jsonType != "array" {
+		// XML nodes from an operation, ie first or slice, are converted by their text
+		raw = xmlNodesText(raw)
+	}
 	if rawArray, ok := raw.([]interface{}); ok && len(rawArray) == 1 {
 		raw = rawArray[0]
 	} else if ok && len(rawArray) == 0 {
@@ -63,10 +124,39 @@ func convert(raw interface{}, jsonType string) (interface{}, error) {
 		return convertString(raw)
 	case "date-time":
 		return convertDateTime(raw)
+	case "date":
+		return convertDate(raw)
+	case "time":
+		return convertTime(raw)
 	}
 	return raw, nil
 }
 
+// isXMLNodes reports whether the value is an XML node or nodes, as returned by the array operations for XML input.
+func isXMLNodes(value interface{}) bool {
+	switch value.(type) {
+	case *xmlquery.Node, []*xmlquery.Node:
+		return true
+	}
+	return false
+}
+
+// xmlNodesText returns the text of an XML node or an array of the text of XML nodes, any other value is returned as
+// is.
+func xmlNodesText(value interface{}) interface{} {
+	switch t := value.(type) {
+	case *xmlquery.Node:
+		return t.InnerText()
+	case []*xmlquery.Node:
+		texts := make([]interface{}, len(t))
+		for i, node := range t {
+			texts[i] = node.InnerText()
+		}
+		return texts
+	}
+	return value
+}
+
 func convertBoolean(raw interface{}) (interface{}, error) {
 	switch t := raw.(type) {
 	case bool:
@@ -114,8 +204,28 @@ func convertNumber(raw interface{}) (interface{}, error) {
 	}
 }
 
+// numberValue returns the numeric values produced by a transform as a float64.
+func numberValue(value interface{}) (float64, bool) {
+	switch t := value.(type) {
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
 func convertDateTime(raw interface{}) (interface{}, error) {
 	switch t := raw.(type) {
+	case time.Time:
+		return t, nil
 	case string:
 		if t == "" {
 			return nil, nil
@@ -130,6 +240,38 @@ func convertDateTime(raw interface{}) (interface{}, error) {
 	}
 }
 
+// convertDate converts to a full-date string as used for the JSON schema date format, ie "2006-01-02".
+func convertDate(raw interface{}) (interface{}, error) {
+	if t, ok := raw.(string); ok {
+		if _, err := time.Parse(dateFormatLayout, t); err == nil {
+			return t, nil
+		}
+	}
+	dateTime, err := convertDateTime(raw)
+	if err != nil || dateTime == nil {
+		return nil, err
+	}
+	return dateTime.(time.Time).Format(dateFormatLayout), nil
+}
+
+// convertTime converts to a full-time string as used for the JSON schema time format, ie "15:04:05Z07:00". A time
+// without a zone, ie "15:04:05", is left as is.
+func convertTime(raw interface{}) (interface{}, error) {
+	if t, ok := raw.(string); ok {
+		if _, err := time.Parse(timeFormatLayout, t); err == nil {
+			return t, nil
+		}
+		if _, err := time.Parse(localTimeFormatLayout, t); err == nil {
+			return t, nil
+		}
+	}
+	dateTime, err := convertDateTime(raw)
+	if err != nil || dateTime == nil {
+		return nil, err
+	}
+	return dateTime.(time.Time).Format(timeFormatLayout), nil
+}
+
 func convertString(raw interface{}) (interface{}, error) {
 	switch t := raw.(type) {
 	case bool:
@@ -145,6 +287,8 @@ func convertString(raw interface{}) (interface{}, error) {
 		return strconv.FormatFloat(t64, 'f', -1, 32), nil
 	case float64:
 		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case time.Time:
+		return t.Format(time.RFC3339Nano), nil
 	case nil:
 		return nil, nil
 	default:
@@ -152,7 +296,9 @@ func convertString(raw interface{}) (interface{}, error) {
 	}
 }
 
-func extractTransformInstructions(raw json.RawMessage, transformIdentifier, path string) (*transformInstructions, error) {
+// extractTransformInstructions parses the transform instructions for the transformIdentifier from the raw schema
+// instance at path. The expressions of the instructions and for JSON input their JSONPaths are compiled.
+func extractTransformInstructions(raw json.RawMessage, transformIdentifier, path string, format InputFormat, operations *OperationRegistry) (*transformInstructions, error) {
 	rawTransformInstruction, _, _, err := jsonparser.Get(raw, "transform", transformIdentifier)
 	if err != nil && err != jsonparser.KeyPathNotFoundError {
 		return nil, fmt.Errorf("failed to extract raw instance transform: %v", err)
@@ -164,14 +310,24 @@ func extractTransformInstructions(raw json.RawMessage, transformIdentifier, path
 	parentPath := strings.Join(splits[:len(splits)-1], ".")
 
 	var tis transformInstructions
-	if err := json.Unmarshal(rawTransformInstruction, &tis); err != nil {
+	if err := tis.unmarshalJSON(rawTransformInstruction, operations); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal instance transform: %v", err)
 	}
+	if format == JSONInput {
+		// the anchors are replaced first as they also start with @, for XML input they are resolved on use
+		for _, replacement := range jsonPathAnchors(parentPath) {
+			tis.replacePathAnchor(replacement.anchor, replacement.path)
+		}
+	}
 	// replaces the @. format
 	tis.replaceJSONPathPrefix("@.", parentPath+".")
 	// replaces the @[] format
 	tis.replaceJSONPathPrefix("@[", parentPath+"[")
 
+	if err := tis.compile(path, format); err != nil {
+		return nil, err
+	}
+
 	return &tis, nil
 }
 
@@ -193,6 +349,25 @@ func schemaDefault(schema json.RawMessage) (interface{}, error) {
 	return nil, nil
 }
 
+// pointerFromPath converts a JSONPath, as used for the schema instances, into a JSON Pointer (RFC 6901).
+// The path may only include child and array index selectors, ie `$.a[0].b`.
+func pointerFromPath(path string) string {
+	var pointer string
+	for _, key := range strings.Split(strings.TrimPrefix(path, "$"), ".") {
+		if key == "" {
+			continue
+		}
+		indexes := strings.Split(key, "[")
+		if indexes[0] != "" {
+			pointer += "/" + strings.Replace(strings.Replace(indexes[0], "~", "~0", -1), "/", "~1", -1)
+		}
+		for _, index := range indexes[1:] {
+			pointer += "/" + strings.TrimSuffix(index, "]")
+		}
+	}
+	return pointer
+}
+
 // replaceIndex takes a path which may include array index values like `a[0].b.c[23].d` with the index values replaced
 // with "*", ie `a[*].b.c[*].d`
 func replaceIndex(path string) string {
@@ -35,6 +35,24 @@ func TestConcat(t *testing.T) {
 			delimiter:   "/",
 			want:        "con/cat",
 		},
+		{
+			description: "array concat",
+			a:           []interface{}{"a", "b"},
+			b:           []interface{}{"c"},
+			want:        []interface{}{"a", "b", "c"},
+		},
+		{
+			description: "array and value concat",
+			a:           []interface{}{"a"},
+			b:           1,
+			want:        []interface{}{"a", 1},
+		},
+		{
+			description: "value and array concat",
+			a:           "a",
+			b:           []string{"b", "c"},
+			want:        []interface{}{"a", "b", "c"},
+		},
 		{
 			description: "int concat",
 			a:           0,
@@ -304,6 +322,66 @@ func TestConvert(t *testing.T) {
 			jsonType:    "date-time",
 			wantErr:     true,
 		},
+		{
+			description: "date-time -> date-time",
+			raw:         time.Unix(1529958073, 0).UTC(),
+			jsonType:    "date-time",
+			want:        time.Unix(1529958073, 0).UTC(),
+		},
+		{
+			description: "date-time -> string",
+			raw:         time.Date(2018, 6, 25, 20, 21, 13, 0, time.UTC),
+			jsonType:    "string",
+			want:        "2018-06-25T20:21:13Z",
+		},
+		{
+			description: "valid date -> date",
+			raw:         "2018-06-25",
+			jsonType:    "date",
+			want:        "2018-06-25",
+		},
+		{
+			description: "valid RFC3339 string -> date",
+			raw:         "2018-06-25T20:21:13Z",
+			jsonType:    "date",
+			want:        "2018-06-25",
+		},
+		{
+			description: "unix epoch -> date",
+			raw:         1529958073,
+			jsonType:    "date",
+			want:        "2018-06-25",
+		},
+		{
+			description: "invalid string -> date",
+			raw:         "June 25th",
+			jsonType:    "date",
+			wantErr:     true,
+		},
+		{
+			description: "valid time -> time",
+			raw:         "20:21:13",
+			jsonType:    "time",
+			want:        "20:21:13",
+		},
+		{
+			description: "valid RFC3339 string -> time",
+			raw:         "2018-06-25T20:21:13-04:00",
+			jsonType:    "time",
+			want:        "20:21:13-04:00",
+		},
+		{
+			description: "date-time -> time",
+			raw:         time.Date(2018, 6, 25, 20, 21, 13, 0, time.UTC),
+			jsonType:    "time",
+			want:        "20:21:13Z",
+		},
+		{
+			description: "empty string -> nil time",
+			raw:         "",
+			jsonType:    "time",
+			want:        nil,
+		},
 	}
 
 	for _, test := range tests {
@@ -371,6 +449,86 @@ func TestSchemaDefault(t *testing.T) {
 	}
 }
 
+func TestDeepCopy(t *testing.T) {
+	tests := []struct {
+		description string
+		value       interface{}
+	}{
+		{
+			description: "Scalar",
+			value:       "a",
+		},
+		{
+			description: "Map with nested values",
+			value:       map[string]interface{}{"a": map[string]interface{}{"b": "c"}, "d": []interface{}{"e"}},
+		},
+		{
+			description: "Slice with nested values",
+			value:       []interface{}{map[string]interface{}{"a": "b"}, []interface{}{"c"}},
+		},
+	}
+
+	for _, test := range tests {
+		got := deepCopy(test.value)
+		if !reflect.DeepEqual(got, test.value) {
+			t.Errorf("Test %q - got %v, want %v", test.description, got, test.value)
+		}
+
+		// changes to the copy must not be reflected in the original
+		switch v := got.(type) {
+		case map[string]interface{}:
+			v["a"] = "changed"
+		case []interface{}:
+			v[0] = "changed"
+		default:
+			continue
+		}
+		if reflect.DeepEqual(got, test.value) {
+			t.Errorf("Test %q - modifying the copy modified the original", test.description)
+		}
+	}
+}
+
+func TestPointerFromPath(t *testing.T) {
+	tests := []struct {
+		description string
+		path        string
+		want        string
+	}{
+		{
+			description: "Root",
+			path:        "$",
+			want:        "",
+		},
+		{
+			description: "Nested objects",
+			path:        "$.a.b",
+			want:        "/a/b",
+		},
+		{
+			description: "Arrays",
+			path:        "$.a[0].b[1][2]",
+			want:        "/a/0/b/1/2",
+		},
+		{
+			description: "Root array",
+			path:        "$[3].a",
+			want:        "/3/a",
+		},
+		{
+			description: "Escaped characters",
+			path:        "$.a/b.c~d",
+			want:        "/a~1b/c~0d",
+		},
+	}
+
+	for _, test := range tests {
+		if got, want := pointerFromPath(test.path), test.want; got != want {
+			t.Errorf("Test %q - got %q, want %q", test.description, got, want)
+		}
+	}
+}
+
 func TestReplaceIndex(t *testing.T) {
 	tests := []struct {
 		description string
@@ -0,0 +1,556 @@
+package transform
+
+import (
+	"context"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// TransformValue transforms already decoded input returning the transformed value rather than JSON.
+//
+// For JSON input, in is the result of decoding JSON into an interface{}, ie made up of map[string]interface{} and
+// []interface{}, it is not modified by the transform. For XML input, in is the *xmlquery.Node of a parsed document.
+//
+// The transformed value is made up of map[string]interface{}, []interface{} and scalar values with date-time fields
+// as time.Time. As with Transform the result is validated against the schema according to the validation mode.
+func (tr *Transformer) TransformValue(in interface{}) (interface{}, error) {
+	var decode func() (interface{}, error)
+	switch tr.format {
+	case JSONInput:
+		decode = func() (interface{}, error) { return deepCopy(in), nil }
+	case XMLInput:
+		if _, ok := in.(*xmlquery.Node); !ok {
+			return nil, fmt.Errorf("XML input must be a *xmlquery.Node not %T", in)
+		}
+		decode = func() (interface{}, error) { return in, nil }
+	default:
+		return nil, fmt.Errorf("unknown transform type %s, must be 'JSON' or 'XML'", tr.format)
+	}
+
+	working, _ := decode()
+	transformed, err := tr.transformDecoded(working, tr.newState(context.Background()))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tr.validateValue(transformed, decode); err != nil {
+		return nil, err
+	}
+	return transformed, nil
+}
+
+// TransformInto transforms the raw input, as with Transform, and saves the result into dst which must be a non-nil
+// pointer, typically to a struct created with the generate package.
+// The result is assigned to dst directly rather than marshaled to JSON and unmarshaled, following the rules of
+// encoding/json for struct fields, including embedded structs and the json tag options, and for types implementing
+// json.Unmarshaler or encoding.TextUnmarshaler. The result is only marshaled to JSON when it is validated.
+func (tr *Transformer) TransformInto(raw []byte, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer not %T", dst)
+	}
+
+	if err := tr.limits.checkInputBytes(len(raw)); err != nil {
+		return err
+	}
+
+	decode := tr.decoder(raw)
+	in, err := decode()
+	if err != nil {
+		return err
+	}
+
+	transformed, err := tr.transformDecoded(in, tr.newState(context.Background()))
+	if err != nil {
+		return err
+	}
+
+	if err := tr.validateValue(transformed, decode); err != nil {
+		return err
+	}
+
+	if err := assignValue(rv.Elem(), transformed); err != nil {
+		return fmt.Errorf("failed to assign transformed data: %v", err)
+	}
+	return nil
+}
+
+// validateValue validates the transformed value according to the validation mode.
+func (tr *Transformer) validateValue(transformed interface{}, decode func() (interface{}, error)) error {
+	if tr.validation == ValidationOff {
+		return nil
+	}
+	out, err := json.Marshal(transformed)
+	if err != nil {
+		return fmt.Errorf("failed to JSON marshal transformed data: %v", err)
+	}
+	return tr.checkValidation(out, decode)
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// assignError is a transformed value which can't be assigned to a Go value, path is the location of the value built
+// up as the error is returned.
+type assignError struct {
+	path  []string
+	value interface{}
+	typ   reflect.Type
+	msg   string
+}
+
+func (e *assignError) Error() string {
+	path := "$"
+	for i := len(e.path) - 1; i >= 0; i-- {
+		path += e.path[i]
+	}
+	if e.msg != "" {
+		return fmt.Sprintf("%s at %s", e.msg, path)
+	}
+	return fmt.Sprintf("cannot assign %T value at %s to Go value of type %s", e.value, path, e.typ)
+}
+
+// inPath adds the path element to an assignError.
+func inPath(err error, element string) error {
+	if aerr, ok := err.(*assignError); ok {
+		aerr.path = append(aerr.path, element)
+	}
+	return err
+}
+
+// assignValue saves the transformed value into dst as json.Unmarshal would for the JSON of the value.
+func assignValue(dst reflect.Value, value interface{}) error {
+	if value == nil {
+		// as with JSON null only pointers, interfaces, maps and slices are changed, except by a json.Unmarshaler
+		switch dst.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			dst.Set(reflect.Zero(dst.Type()))
+		default:
+			if dst.CanAddr() && dst.Addr().Type().Implements(unmarshalerType) {
+				return dst.Addr().Interface().(json.Unmarshaler).UnmarshalJSON([]byte("null"))
+			}
+		}
+		return nil
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignValue(dst.Elem(), value)
+	}
+
+	if dst.CanAddr() {
+		ptr := dst.Addr()
+		switch {
+		case dst.Type() == timeType:
+			if t, ok := value.(time.Time); ok {
+				dst.Set(reflect.ValueOf(t))
+				return nil
+			}
+			return assignUnmarshaler(ptr.Interface().(json.Unmarshaler), value)
+		case ptr.Type().Implements(unmarshalerType):
+			return assignUnmarshaler(ptr.Interface().(json.Unmarshaler), value)
+		case ptr.Type().Implements(textUnmarshalerType):
+			text, ok := value.(string)
+			if !ok {
+				return &assignError{value: value, typ: dst.Type()}
+			}
+			return ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return &assignError{value: value, typ: dst.Type()}
+		}
+		dst.Set(reflect.ValueOf(jsonValue(value)))
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return &assignError{value: value, typ: dst.Type()}
+		}
+		plan := structPlanFor(dst.Type())
+		for key, v := range obj {
+			f := plan.lookup(key)
+			if f == nil {
+				continue
+			}
+			if err := f.assign(dst, v); err != nil {
+				return inPath(err, "."+key)
+			}
+		}
+	case reflect.Map:
+		return assignMap(dst, value)
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			if text, ok := value.(string); ok {
+				// as encoding/json a []byte is base64 encoded
+				b, err := base64.StdEncoding.DecodeString(text)
+				if err != nil {
+					return &assignError{msg: fmt.Sprintf("invalid base64 for %s: %v", dst.Type(), err)}
+				}
+				dst.SetBytes(b)
+				return nil
+			}
+		}
+		arr, ok := value.([]interface{})
+		if !ok {
+			return &assignError{value: value, typ: dst.Type()}
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, v := range arr {
+			if err := assignValue(slice.Index(i), v); err != nil {
+				return inPath(err, "["+strconv.Itoa(i)+"]")
+			}
+		}
+		dst.Set(slice)
+	case reflect.Array:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return &assignError{value: value, typ: dst.Type()}
+		}
+		for i := 0; i < dst.Len(); i++ {
+			if i >= len(arr) {
+				dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+				continue
+			}
+			if err := assignValue(dst.Index(i), arr[i]); err != nil {
+				return inPath(err, "["+strconv.Itoa(i)+"]")
+			}
+		}
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return &assignError{value: value, typ: dst.Type()}
+		}
+		dst.SetBool(b)
+	case reflect.String:
+		switch t := value.(type) {
+		case string:
+			dst.SetString(t)
+		case time.Time:
+			dst.SetString(t.Format(time.RFC3339Nano))
+		default:
+			return &assignError{value: value, typ: dst.Type()}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := intValue(value)
+		if !ok || dst.OverflowInt(i) {
+			return &assignError{value: value, typ: dst.Type()}
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := intValue(value)
+		if !ok || i < 0 || dst.OverflowUint(uint64(i)) {
+			return &assignError{value: value, typ: dst.Type()}
+		}
+		dst.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, ok := numberValue(value)
+		if !ok || dst.OverflowFloat(f) {
+			return &assignError{value: value, typ: dst.Type()}
+		}
+		dst.SetFloat(f)
+	default:
+		return &assignError{value: value, typ: dst.Type()}
+	}
+	return nil
+}
+
+// assignUnmarshaler gives the JSON of the value to the json.Unmarshaler.
+func assignUnmarshaler(u json.Unmarshaler, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return u.UnmarshalJSON(raw)
+}
+
+// assignMap adds the items of the transformed object to the map, which is created if nil. Keys may be strings or
+// integers as with encoding/json.
+func assignMap(dst reflect.Value, value interface{}) error {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return &assignError{value: value, typ: dst.Type()}
+	}
+	keyType, elemType := dst.Type().Key(), dst.Type().Elem()
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(dst.Type(), len(obj)))
+	}
+	for key, v := range obj {
+		var k reflect.Value
+		switch keyType.Kind() {
+		case reflect.String:
+			k = reflect.ValueOf(key).Convert(keyType)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, err := strconv.ParseInt(key, 10, 64)
+			if err != nil || reflect.Zero(keyType).OverflowInt(i) {
+				return &assignError{value: key, typ: keyType}
+			}
+			k = reflect.ValueOf(i).Convert(keyType)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			i, err := strconv.ParseUint(key, 10, 64)
+			if err != nil || reflect.Zero(keyType).OverflowUint(i) {
+				return &assignError{value: key, typ: keyType}
+			}
+			k = reflect.ValueOf(i).Convert(keyType)
+		default:
+			return &assignError{value: value, typ: dst.Type()}
+		}
+
+		elem := reflect.New(elemType).Elem()
+		if err := assignValue(elem, v); err != nil {
+			return inPath(err, "."+key)
+		}
+		dst.SetMapIndex(k, elem)
+	}
+	return nil
+}
+
+// intValue returns a transformed number as an int64 if it is a whole number.
+func intValue(value interface{}) (int64, bool) {
+	switch t := value.(type) {
+	case int:
+		return int64(t), true
+	case int64:
+		return t, true
+	case json.Number:
+		i, err := t.Int64()
+		return i, err == nil
+	}
+	f, ok := numberValue(value)
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// jsonValue returns the transformed value as json.Unmarshal would decode its JSON into an interface{}, numbers are
+// float64 and date-times are strings.
+func jsonValue(value interface{}) interface{} {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			obj[k] = jsonValue(v)
+		}
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, len(t))
+		for i, v := range t {
+			arr[i] = jsonValue(v)
+		}
+		return arr
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case string, bool, float64:
+		return t
+	}
+	if f, ok := numberValue(value); ok {
+		return f
+	}
+	return value
+}
+
+// structField is a field of a struct found as encoding/json does, the name is the JSON name and the index is the
+// path of field indexes through any embedded structs.
+type structField struct {
+	name   string
+	index  []int
+	tagged bool
+	// quoted is set by the string tag option, the value is a string holding the JSON of the field.
+	quoted bool
+}
+
+// assign saves the value into the field of the struct v, allocating any nil embedded struct pointers on the way.
+func (f *structField) assign(v reflect.Value, value interface{}) error {
+	for i, x := range f.index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return &assignError{msg: fmt.Sprintf("cannot set embedded pointer to unexported struct %s", v.Type().Elem())}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	if f.quoted && value != nil {
+		text, ok := value.(string)
+		if !ok {
+			return &assignError{msg: fmt.Sprintf("invalid use of ,string struct tag with a %T value", value)}
+		}
+		if err := json.Unmarshal([]byte(text), v.Addr().Interface()); err != nil {
+			return &assignError{msg: fmt.Sprintf("invalid use of ,string struct tag with %q: %v", text, err)}
+		}
+		return nil
+	}
+	return assignValue(v, value)
+}
+
+// structPlan holds the fields of a struct type by JSON name.
+type structPlan struct {
+	fields []structField
+	byName map[string]*structField
+}
+
+// lookup finds the field for the JSON key, preferring an exact match but otherwise matching case insensitively as
+// encoding/json does.
+func (p *structPlan) lookup(key string) *structField {
+	if f, ok := p.byName[key]; ok {
+		return f
+	}
+	for i := range p.fields {
+		if strings.EqualFold(p.fields[i].name, key) {
+			return &p.fields[i]
+		}
+	}
+	return nil
+}
+
+// structPlans caches the structPlan of each struct type assigned to.
+var structPlans sync.Map
+
+func structPlanFor(t reflect.Type) *structPlan {
+	if cached, ok := structPlans.Load(t); ok {
+		return cached.(*structPlan)
+	}
+	fields := structFields(t)
+	plan := &structPlan{fields: fields, byName: make(map[string]*structField, len(fields))}
+	for i := range plan.fields {
+		plan.byName[plan.fields[i].name] = &plan.fields[i]
+	}
+	cached, _ := structPlans.LoadOrStore(t, plan)
+	return cached.(*structPlan)
+}
+
+// structFields returns the fields of the struct type found by the rules of encoding/json. The fields of embedded
+// structs are promoted, a field at a shallower depth hides deeper fields of the same name and of fields at the same
+// depth a tagged field hides untagged ones, otherwise fields of the same name at the same depth are all dropped.
+func structFields(t reflect.Type) []structField {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []structField
+	current, next := []embedded{}, []embedded{{typ: t}}
+	count, nextCount := map[reflect.Type]int{}, map[reflect.Type]int{t: 1}
+	visited := map[reflect.Type]bool{}
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				exported := sf.PkgPath == ""
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if !exported && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !exported {
+					continue
+				}
+
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				options := strings.Split(tag, ",")
+				name := options[0]
+
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+
+				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
+					f := structField{name: name, index: index, tagged: name != ""}
+					if f.name == "" {
+						f.name = sf.Name
+					}
+					for _, option := range options[1:] {
+						if option != "string" {
+							continue
+						}
+						switch ft.Kind() {
+						case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+							reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+							reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+							f.quoted = true
+						}
+					}
+					fields = append(fields, f)
+					if count[e.typ] > 1 {
+						// the struct is embedded more than once at this depth so its fields are ambiguous, a second
+						// copy makes sure they are dropped below
+						fields = append(fields, f)
+					}
+					continue
+				}
+
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, embedded{typ: ft, index: index})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, b := fields[i], fields[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.index) != len(b.index) {
+			return len(a.index) < len(b.index)
+		}
+		return a.tagged && !b.tagged
+	})
+
+	var out []structField
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		// the first field of the name is the dominant one unless the next is at the same depth and equally tagged
+		if j-i == 1 || len(fields[i].index) != len(fields[i+1].index) || fields[i].tagged != fields[i+1].tagged {
+			out = append(out, fields[i])
+		}
+		i = j
+	}
+	return out
+}
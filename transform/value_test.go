@@ -0,0 +1,394 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+
+	"github.com/GannettDigital/jstransform/jsonschema"
+)
+
+func TestTransformValue(t *testing.T) {
+	arrayIn := `{"data": {"contributors": [{"id": 1, "fullname": "one"}], "lines": ["line1"]}, "aSingleObject": [{"id": 1, "name": "test1"}]}`
+
+	tests := []struct {
+		description string
+		tr          func() (*Transformer, error)
+		in          func() interface{}
+		want        interface{}
+		wantErr     bool
+	}{
+		{
+			description: "JSON input with array transforms",
+			tr:          func() (*Transformer, error) { return NewTransformer(arrayTransformsSchema, "cumulo") },
+			in: func() interface{} {
+				var in interface{}
+				json.Unmarshal([]byte(arrayIn), &in)
+				return in
+			},
+			want: map[string]interface{}{
+				"contributors":    []interface{}{map[string]interface{}{"id": "1", "name": "one"}},
+				"lines":           []interface{}{"line1"},
+				"wasSingleObject": []interface{}{map[string]interface{}{"id": "1", "name": "test1"}},
+			},
+		},
+		{
+			description: "Date-times are time.Time",
+			tr:          func() (*Transformer, error) { return NewTransformer(dateTimesSchema, "cumulo") },
+			in: func() interface{} {
+				return map[string]interface{}{"dates": []interface{}{"2018-06-25T20:21:13Z"}, "requiredDate": "2018-06-25T20:21:13Z"}
+			},
+			want: map[string]interface{}{
+				"dates":        []interface{}{time.Date(2018, 6, 25, 20, 21, 13, 0, time.UTC)},
+				"requiredDate": time.Date(2018, 6, 25, 20, 21, 13, 0, time.UTC),
+			},
+		},
+		{
+			description: "Invalid result",
+			tr:          func() (*Transformer, error) { return NewTransformer(imageSchema, "cumulo") },
+			in:          func() interface{} { return map[string]interface{}{"type": "video"} },
+			wantErr:     true,
+		},
+		{
+			description: "Invalid result without validation",
+			tr: func() (*Transformer, error) {
+				return NewTransformerWithOptions(imageSchema, "cumulo", WithValidation(ValidationOff))
+			},
+			in:   func() interface{} { return map[string]interface{}{"type": "video"} },
+			want: map[string]interface{}{"type": "video"},
+		},
+		{
+			description: "XML input",
+			tr: func() (*Transformer, error) {
+				schema, err := jsonschema.SchemaFromFile("./test_data/xml/conversion-transforms.json", "")
+				if err != nil {
+					return nil, err
+				}
+				return NewXMLTransformer(schema, "sport")
+			},
+			in: func() interface{} {
+				doc, _ := xmlquery.Parse(strings.NewReader(`<content><hits>4</hits><average>1.23</average><raining>true</raining></content>`))
+				return doc
+			},
+			want: map[string]interface{}{"averageFloat": 1.23, "defaultBoolean": true, "hitsInt": 4, "rainingBoolean": true},
+		},
+		{
+			description: "XML input must be a node",
+			tr:          func() (*Transformer, error) { return NewXMLTransformer(imageSchema, "cumulo") },
+			in:          func() interface{} { return map[string]interface{}{} },
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		tr, err := test.tr()
+		if err != nil {
+			t.Fatalf("Test %q - failed to initialize transformer: %v", test.description, err)
+		}
+
+		in := test.in()
+		original := deepCopy(in)
+		got, err := tr.TransformValue(in)
+
+		switch {
+		case test.wantErr && err != nil:
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+
+		if _, ok := in.(*xmlquery.Node); !ok && !reflect.DeepEqual(in, original) {
+			t.Errorf("Test %q - input was modified, got %#v, want %#v", test.description, in, original)
+		}
+	}
+}
+
+// imageURL and image mimic the structs created by the generate package for the image schema.
+type imageURL struct {
+	Absolute string `json:"absolute"`
+	Publish  string `json:"publish"`
+}
+
+type image struct {
+	Type  string `json:"type"`
+	Crops []struct {
+		Height       float64 `json:"height"`
+		Name         string  `json:"name"`
+		Path         string  `json:"path"`
+		RelativePath string  `json:"relativePath"`
+		Width        int64   `json:"width"`
+	} `json:"crops"`
+	URL *imageURL `json:"URL"`
+}
+
+type embeddedDates struct {
+	RequiredDate time.Time `json:"requiredDate"`
+}
+
+type dates struct {
+	embeddedDates
+
+	Dates        []time.Time `json:"dates,omitempty"`
+	OptionalDate *time.Time  `json:"optionalDate,omitempty"`
+}
+
+// typed, typedA and typedB are embedded to check struct fields are found as encoding/json does.
+type typed struct {
+	Type string `json:"type"`
+}
+
+type typedA struct {
+	Type string
+}
+
+type typedB struct {
+	Type string
+}
+
+type contributors struct {
+	Contributors []struct {
+		ID   int64  `json:"id,string"`
+		Name string `json:"name"`
+	} `json:"contributors"`
+}
+
+func TestTransformInto(t *testing.T) {
+	tests := []struct {
+		description string
+		tr          func() (*Transformer, error)
+		in          string
+		dst         func() interface{}
+		want        interface{}
+		wantErr     bool
+	}{
+		{
+			description: "Nested structs and slices",
+			tr:          func() (*Transformer, error) { return NewTransformer(imageSchema, "cumulo") },
+			in:          `{"type": "image", "crops": [{"height": 1.5, "path": "path", "relativePath": "", "width": 2}], "publishUrl": "publish", "absoluteUrl": "absolute"}`,
+			dst:         func() interface{} { return &image{} },
+			want: func() interface{} {
+				want := &image{Type: "image", URL: &imageURL{Absolute: "absolute", Publish: "publish"}}
+				want.Crops = append(want.Crops, struct {
+					Height       float64 `json:"height"`
+					Name         string  `json:"name"`
+					Path         string  `json:"path"`
+					RelativePath string  `json:"relativePath"`
+					Width        int64   `json:"width"`
+				}{Height: 1.5, Name: "name", Path: "path", Width: 2})
+				return want
+			}(),
+		},
+		{
+			description: "Embedded structs and times",
+			tr:          func() (*Transformer, error) { return NewTransformer(dateTimesSchema, "cumulo") },
+			in:          `{"dates": ["2018-06-25T20:21:13Z"], "requiredDate": "2018-06-25T20:21:13Z"}`,
+			dst:         func() interface{} { return &dates{} },
+			want: &dates{
+				embeddedDates: embeddedDates{RequiredDate: time.Date(2018, 6, 25, 20, 21, 13, 0, time.UTC)},
+				Dates:         []time.Time{time.Date(2018, 6, 25, 20, 21, 13, 0, time.UTC)},
+			},
+		},
+		{
+			description: "String tag option",
+			tr:          func() (*Transformer, error) { return NewTransformer(arrayTransformsSchema, "cumulo") },
+			in:          `{"data": {"contributors": [{"id": 1, "fullname": "one"}]}}`,
+			dst:         func() interface{} { return &contributors{} },
+			want: func() interface{} {
+				want := &contributors{}
+				want.Contributors = append(want.Contributors, struct {
+					ID   int64  `json:"id,string"`
+					Name string `json:"name"`
+				}{ID: 1, Name: "one"})
+				return want
+			}(),
+		},
+		{
+			description: "Ambiguous embedded fields are ignored",
+			tr:          func() (*Transformer, error) { return NewTransformer(imageSchema, "cumulo") },
+			in:          `{"type": "image", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": 2}]}`,
+			dst: func() interface{} {
+				return &struct {
+					typedA
+					typedB
+				}{}
+			},
+			want: &struct {
+				typedA
+				typedB
+			}{},
+		},
+		{
+			description: "Nil pointer to unexported embedded struct",
+			tr:          func() (*Transformer, error) { return NewTransformer(imageSchema, "cumulo") },
+			in:          `{"type": "image", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": 2}]}`,
+			dst:         func() interface{} { return &struct{ *typed }{} },
+			wantErr:     true,
+		},
+		{
+			description: "Map destination",
+			tr:          func() (*Transformer, error) { return NewTransformer(imageSchema, "cumulo") },
+			in:          `{"type": "image", "crops": [{"height": 1, "path": "path", "relativePath": "", "width": 2}], "publishUrl": "publish", "absoluteUrl": "absolute"}`,
+			dst:         func() interface{} { return &map[string]interface{}{} },
+			want: &map[string]interface{}{
+				"type":  "image",
+				"crops": []interface{}{map[string]interface{}{"height": 1.0, "name": "name", "path": "path", "relativePath": "", "width": 2.0}},
+				"URL":   map[string]interface{}{"absolute": "absolute", "publish": "publish"},
+			},
+		},
+		{
+			description: "Mismatched type",
+			tr: func() (*Transformer, error) {
+				return NewTransformerWithOptions(imageSchema, "cumulo", WithValidation(ValidationOff))
+			},
+			in:      `{"type": "image", "crops": [{"width": 2.5}]}`,
+			dst:     func() interface{} { return &image{} },
+			wantErr: true,
+		},
+		{
+			description: "Invalid result",
+			tr:          func() (*Transformer, error) { return NewTransformer(imageSchema, "cumulo") },
+			in:          `{"type": "video"}`,
+			dst:         func() interface{} { return &image{} },
+			wantErr:     true,
+		},
+		{
+			description: "Not a pointer",
+			tr:          func() (*Transformer, error) { return NewTransformer(imageSchema, "cumulo") },
+			in:          `{"type": "image"}`,
+			dst:         func() interface{} { return image{} },
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		tr, err := test.tr()
+		if err != nil {
+			t.Fatalf("Test %q - failed to initialize transformer: %v", test.description, err)
+		}
+
+		got := test.dst()
+		err = tr.TransformInto([]byte(test.in), got)
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+// textID implements encoding.TextUnmarshaler.
+type textID struct {
+	id string
+}
+
+func (t *textID) UnmarshalText(text []byte) error {
+	t.id = "id-" + string(text)
+	return nil
+}
+
+func TestAssignValue(t *testing.T) {
+	tests := []struct {
+		description string
+		dst         interface{}
+		value       interface{}
+		want        interface{}
+		wantErr     bool
+	}{
+		{description: "int to int64", dst: new(int64), value: 3, want: int64(3)},
+		{description: "float to int", dst: new(int), value: 3.0, want: 3},
+		{description: "fractional float to int", dst: new(int), value: 3.5, wantErr: true},
+		{description: "negative to uint", dst: new(uint), value: -1, wantErr: true},
+		{description: "overflow", dst: new(int8), value: 300, wantErr: true},
+		{description: "int to float", dst: new(float64), value: 3, want: 3.0},
+		{description: "time to string", dst: new(string), value: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), want: "2018-01-01T00:00:00Z"},
+		{description: "string to time", dst: new(time.Time), value: "2018-01-01T00:00:00.5+01:00", want: time.Date(2018, 1, 1, 0, 0, 0, 5e8, time.FixedZone("", 3600))},
+		{description: "invalid time", dst: new(time.Time), value: "2018-01-01", wantErr: true},
+		{description: "string to bool", dst: new(bool), value: "true", wantErr: true},
+		{description: "interface has JSON types", dst: new(interface{}), value: []interface{}{"a", 1}, want: []interface{}{"a", 1.0}},
+		{description: "map", dst: new(map[string]int), value: map[string]interface{}{"a": 1}, want: map[string]int{"a": 1}},
+		{description: "map with integer keys", dst: new(map[int]string), value: map[string]interface{}{"1": "a"}, want: map[int]string{1: "a"}},
+		{description: "nil to pointer", dst: func() interface{} { i := 1; p := &i; return &p }(), value: nil, want: (*int)(nil)},
+		{description: "json.Unmarshaler", dst: new(json.RawMessage), value: map[string]interface{}{"a": 1}, want: json.RawMessage(`{"a":1}`)},
+		{description: "encoding.TextUnmarshaler", dst: new(textID), value: "a", want: textID{id: "id-a"}},
+		{description: "base64 bytes", dst: new([]byte), value: "aGk=", want: []byte("hi")},
+		{description: "array", dst: new([2]string), value: []interface{}{"a"}, want: [2]string{"a", ""}},
+		{description: "nested error", dst: new(map[string][]int), value: map[string]interface{}{"a": []interface{}{1, "b"}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := assignValue(reflect.ValueOf(test.dst).Elem(), test.value)
+		got := reflect.ValueOf(test.dst).Elem().Interface()
+
+		switch {
+		case test.wantErr && err != nil:
+			continue
+		case test.wantErr && err == nil:
+			t.Errorf("Test %q - got nil, want error", test.description)
+		case !test.wantErr && err != nil:
+			t.Errorf("Test %q - got error, want nil: %v", test.description, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("Test %q - got %#v, want %#v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestAssignValueErrorPath(t *testing.T) {
+	err := assignValue(reflect.ValueOf(&image{}).Elem(), map[string]interface{}{
+		"crops": []interface{}{map[string]interface{}{"width": 1}, map[string]interface{}{"width": 2.5}},
+	})
+	want := "cannot assign float64 value at $.crops[1].width to Go value of type int64"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+// BenchmarkTransformInto compares TransformInto with Transform followed by json.Unmarshal.
+func BenchmarkTransformInto(b *testing.B) {
+	var crops []string
+	for i := 0; i < 20; i++ {
+		crops = append(crops, fmt.Sprintf(`{"name": "crop%d", "height": %d, "path": "path%d", "relativePath": "rel%d", "width": %d}`, i, i, i, i, i))
+	}
+	in := json.RawMessage(`{"type": "image", "crops": [` + strings.Join(crops, ",") + `], "publishUrl": "publishURL", "absoluteUrl": "absoluteURL"}`)
+
+	for name, validation := range map[string]ValidationMode{"validated": ValidationOn, "unvalidated": ValidationOff} {
+		tr, err := NewTransformerWithOptions(imageSchema, "cumulo", WithValidation(validation))
+		if err != nil {
+			b.Fatalf("failed to initialize transformer: %v", err)
+		}
+
+		b.Run("TransformInto "+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var got image
+				if err := tr.TransformInto(in, &got); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("Transform and Unmarshal "+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				out, err := tr.Transform(in)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var got image
+				if err := json.Unmarshal(out, &got); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}